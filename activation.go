@@ -0,0 +1,69 @@
+package benchserve
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdListenFDsStart is the first file descriptor passed
+// by systemd socket activation.
+const sdListenFDsStart = 3
+
+// activatedListener returns the listener passed by systemd socket
+// activation, following the LISTEN_FDS protocol of sd_listen_fds(3),
+// if any. The unit's socket must be a single TCP stream socket.
+func activatedListener() (*net.TCPListener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+	// Keep the variables from leaking into test processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != strconv.Itoa(os.Getpid()) {
+		// Meant for some other process.
+		return nil, nil
+	}
+	if fds != "1" {
+		return nil, fmt.Errorf("socket activation passed %s sockets, want 1", fds)
+	}
+	f := os.NewFile(sdListenFDsStart, "systemd socket")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %v", err)
+	}
+	tcp, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("socket activation: socket is not TCP")
+	}
+	return tcp, nil
+}
+
+// exitWhenIdle exits the server once it has been idle for d:
+// no client connected, nothing running, and no jobs waiting.
+// With socket activation, systemd starts it again on the next connection.
+func (s *server) exitWhenIdle(d time.Duration) {
+	tick := d / 4
+	if tick > time.Second {
+		tick = time.Second
+	}
+	for range time.Tick(tick) {
+		s.mu.Lock()
+		busy := s.conns > 0 || s.running != "" || len(s.jobQueue) > 0
+		if busy {
+			s.lastActive = time.Now()
+		}
+		idle := time.Since(s.lastActive)
+		s.mu.Unlock()
+		if idle >= d {
+			logger.Info("exiting after idling", "idle", idle.Round(time.Second))
+			s.shutdown(0)
+		}
+	}
+}
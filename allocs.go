@@ -0,0 +1,72 @@
+package benchserve
+
+import (
+	"context"
+	"fmt"
+)
+
+// AllocsPerOp requests a count of a benchmark's allocations per iteration.
+type AllocsPerOp struct {
+	Name string // name of the benchmark to measure
+
+	// Runs is the number of iterations to average over, default 100.
+	Runs int
+}
+
+// AllocsResult is the result of an AllocsPerOp measurement.
+type AllocsResult struct {
+	Runs        int     // number of iterations measured
+	AllocsPerOp float64 // average number of allocations, rounded down as by testing.AllocsPerRun
+	BytesPerOp  float64 // average number of bytes allocated
+}
+
+// AllocsPerOp reports the allocations per iteration of a benchmark,
+// with the semantics of testing.AllocsPerRun: after a warm-up iteration,
+// it runs Runs iterations with GOMAXPROCS set to 1
+// and reports the average count, rounded down.
+// It is much cheaper than a timed run, for gating code
+// that must not allocate. The runs are not recorded or cached.
+// Together, they are subject to -test.benchserve.maxrun.
+func (s *Server) AllocsPerOp(args AllocsPerOp, reply *AllocsResult) error {
+	b, ok := s.m[args.Name]
+	if !ok {
+		return fmt.Errorf("%s not found", args.Name)
+	}
+	runs := args.Runs
+	if runs <= 0 {
+		runs = 100
+	}
+
+	run := Run{Name: args.Name, Procs: 1, N: runs}
+	if err := s.checkMaxRun(run); err != nil {
+		return err
+	}
+
+	ctx, done, err := s.acquire(b.Name)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if *benchServeMaxRun > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, *benchServeMaxRun)
+		defer cancel()
+	}
+
+	// Warm up, as AllocsPerRun does.
+	_, err = s.measure(ctx, b, Run{Name: args.Name, Procs: 1, N: 1})
+	var r Result
+	if err == nil {
+		r, err = s.measure(ctx, b, run)
+	}
+	if err == errCanceled && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%s stopped after -test.benchserve.maxrun of %v", args.Name, *benchServeMaxRun)
+	}
+	if err != nil {
+		return err
+	}
+	reply.Runs = runs
+	reply.AllocsPerOp = float64(r.MemAllocs / uint64(runs))
+	reply.BytesPerOp = float64(r.MemBytes) / float64(runs)
+	return nil
+}
@@ -0,0 +1,213 @@
+package benchserve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FetchArtifact requests part of an artifact.
+type FetchArtifact struct {
+	ID     string // ID of the artifact, as reported in Result.Artifacts
+	Offset int64  // offset of the first byte to fetch
+	Length int64  // maximum number of bytes to fetch, default and maximum 1MB
+
+	// Gzip requests that Data be compressed with gzip.
+	// The server only compresses chunks when that makes them smaller.
+	Gzip bool
+}
+
+// ArtifactChunk is part of an artifact.
+type ArtifactChunk struct {
+	Data []byte // the requested bytes
+	Gzip bool   // whether Data is compressed with gzip
+	Size int64  // total size of the artifact, uncompressed
+	EOF  bool   // whether Data reaches the end of the artifact
+}
+
+// maxChunk is the largest chunk returned by FetchArtifact.
+const maxChunk = 1 << 20
+
+// validArtifactID matches well-formed artifact IDs.
+var validArtifactID = regexp.MustCompile(`^[a-z]+-[0-9a-f]{16}$`)
+
+// FetchArtifact returns part of an artifact.
+// To fetch a large artifact, call FetchArtifact repeatedly with increasing
+// offsets until EOF is set.
+// If the -test.benchserve.http flag is set, artifacts are also available
+// over HTTP at /artifacts/ID, with support for range requests
+// and gzip content encoding.
+func (s *Server) FetchArtifact(args FetchArtifact, reply *ArtifactChunk) error {
+	path, err := artifactPath(args.ID)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("artifact %s not found", args.ID)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if args.Offset < 0 || args.Offset > fi.Size() {
+		return fmt.Errorf("offset %d out of range for artifact of size %d", args.Offset, fi.Size())
+	}
+	n := args.Length
+	if n <= 0 || n > maxChunk {
+		n = maxChunk
+	}
+	if rest := fi.Size() - args.Offset; n > rest {
+		n = rest
+	}
+	reply.Data = make([]byte, n)
+	if _, err := f.ReadAt(reply.Data, args.Offset); err != nil && err != io.EOF {
+		return err
+	}
+	reply.Size = fi.Size()
+	reply.EOF = args.Offset+n == fi.Size()
+	if args.Gzip {
+		if z := gzipBytes(reply.Data); len(z) < len(reply.Data) {
+			reply.Data, reply.Gzip = z, true
+		}
+	}
+	return nil
+}
+
+// gzipBytes returns data compressed with gzip.
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// artifactPath returns the path of the artifact with the given ID.
+func artifactPath(id string) (string, error) {
+	if !validArtifactID.MatchString(id) {
+		return "", fmt.Errorf("malformed artifact ID %q", id)
+	}
+	dir, err := artifactDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id), nil
+}
+
+var (
+	artifactDirOnce sync.Once
+	artifactDirPath string
+	artifactDirErr  error
+	artifactDirTemp bool // artifactDirPath is temporary
+)
+
+// artifactDirEnv is the environment variable through which a server
+// passes its temporary artifact directory to its replacement,
+// which takes over removing it.
+const artifactDirEnv = "BENCHSERVE_ARTIFACT_DIR"
+
+// artifactDir returns the artifact directory, creating it if necessary.
+// It is the directory named by -test.benchserve.artifacts,
+// or, if that flag is not set, a temporary directory, either new
+// or inherited from the predecessor of a server started by Reload or Restart.
+func artifactDir() (string, error) {
+	artifactDirOnce.Do(func() {
+		dir := *benchServeArtifacts
+		switch {
+		case dir != "":
+			artifactDirErr = os.MkdirAll(dir, 0o755)
+		case os.Getenv(artifactDirEnv) != "":
+			dir, artifactDirTemp = os.Getenv(artifactDirEnv), true
+			// Keep the variable from leaking into test processes.
+			os.Unsetenv(artifactDirEnv)
+			artifactDirErr = os.MkdirAll(dir, 0o755)
+		default:
+			dir, artifactDirErr = os.MkdirTemp("", "benchserve-artifacts")
+			artifactDirTemp = true
+		}
+		artifactDirPath = dir
+	})
+	return artifactDirPath, artifactDirErr
+}
+
+// tempArtifactDir returns the artifact directory if it is temporary, or "".
+func tempArtifactDir() string {
+	if dir, err := artifactDir(); err == nil && artifactDirTemp {
+		return dir
+	}
+	return ""
+}
+
+// removeArtifactDir removes the artifact directory if it is temporary.
+// The server calls it when it exits.
+func removeArtifactDir() {
+	if dir := tempArtifactDir(); dir != "" {
+		os.RemoveAll(dir)
+	}
+}
+
+// pruneArtifacts removes all but the newest -test.benchserve.maxartifacts
+// artifacts in dir.
+func pruneArtifacts(dir string) {
+	keep := *benchServeMaxArtifacts
+	if keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) <= keep {
+		return
+	}
+	type artifact struct {
+		name string
+		mod  time.Time
+	}
+	var artifacts []artifact
+	for _, e := range entries {
+		if !validArtifactID.MatchString(e.Name()) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			artifacts = append(artifacts, artifact{e.Name(), info.ModTime()})
+		}
+	}
+	if len(artifacts) <= keep {
+		return
+	}
+	sort.Slice(artifacts, func(i, k int) bool { return artifacts[i].mod.After(artifacts[k].mod) })
+	for _, a := range artifacts[keep:] {
+		os.Remove(filepath.Join(dir, a.name))
+	}
+}
+
+// saveArtifact stores data as an artifact of the given kind
+// and returns its ID. The ID is derived from the kind and contents,
+// so identical artifacts have identical IDs.
+func saveArtifact(kind string, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	id := kind + "-" + hex.EncodeToString(sum[:8])
+	path, err := artifactPath(id)
+	if err != nil {
+		return "", err
+	}
+	// Write and rename, so that no one fetches a partial artifact.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	pruneArtifacts(filepath.Dir(path))
+	return id, nil
+}
@@ -0,0 +1,47 @@
+package benchserve
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPruneArtifacts(t *testing.T) {
+	defer func(n int) { *benchServeMaxArtifacts = n }(*benchServeMaxArtifacts)
+	*benchServeMaxArtifacts = 3
+
+	dir := t.TempDir()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("cpu-%016x", i))
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mod := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pruneArtifacts(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{"README", "cpu-0000000000000002", "cpu-0000000000000003", "cpu-0000000000000004"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after pruning to 3 artifacts: %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,236 @@
+package benchserve
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An AuditEntry records a request served by the server.
+type AuditEntry struct {
+	Time     time.Time     // when the request arrived
+	Client   string        // address of the client
+	Method   string        // name of the method, such as "Server.Run"
+	Params   string        // JSON encoding of the arguments, redacted and truncated to 1 KiB
+	Duration time.Duration // time taken to serve the request
+	Error    string        // error returned, or empty on success
+}
+
+const (
+	auditSize      = 1000 // number of entries kept in memory
+	maxAuditParams = 1024 // maximum length of AuditEntry.Params
+)
+
+// redactedParams lists, by method, the arguments that AuditEntry.Params
+// leaves out: Audit returns entries to any client, and these would let
+// one read another's environment or files or join their session.
+var redactedParams = map[string][]string{
+	"Server.Setenv":  {"Value"},
+	"Server.PutFile": {"Data"},
+	"Server.Session": {"Token"},
+}
+
+// auditParams returns AuditEntry.Params for a request for method
+// with the JSON-encoded arguments params.
+func auditParams(method string, params []byte) string {
+	if names := redactedParams[method]; names != nil {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(params, &m); err != nil {
+			return `"redacted"`
+		}
+		for k := range m {
+			for _, name := range names {
+				// As in decoding, the names are case-insensitive.
+				if strings.EqualFold(k, name) {
+					m[k] = json.RawMessage(`"redacted"`)
+				}
+			}
+		}
+		params, _ = json.Marshal(m)
+	}
+	if len(params) > maxAuditParams {
+		params = params[:maxAuditParams]
+	}
+	return string(params)
+}
+
+// An auditLog records the requests served by the server:
+// the most recent in memory and, if -test.benchserve.audit is set,
+// all of them in a file.
+type auditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry // oldest first
+	f       *os.File
+
+	traffic *trafficLog // full requests and responses, if -test.benchserve.record is set; set before serving
+}
+
+// openAuditLog opens the audit log.
+func openAuditLog() (*auditLog, error) {
+	a := new(auditLog)
+	if *benchServeAudit == "" {
+		return a, nil
+	}
+	f, err := os.OpenFile(*benchServeAudit, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	a.f = f
+	return a, nil
+}
+
+func (a *auditLog) add(e AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.entries) == auditSize {
+		copy(a.entries, a.entries[1:])
+		a.entries = a.entries[:auditSize-1]
+	}
+	a.entries = append(a.entries, e)
+	if a.f == nil {
+		return
+	}
+	buf, err := json.Marshal(e)
+	if err == nil {
+		_, err = a.f.Write(append(buf, '\n'))
+	}
+	if err != nil {
+		logger.Warn("write audit log", "err", err)
+	}
+}
+
+// close flushes the audit log file, if any, to stable storage and closes it,
+// along with the recording, if any.
+func (a *auditLog) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Keep a.traffic, which requests still being served use without a.mu;
+	// once closed, it drops their exchanges.
+	a.traffic.close()
+	if a.f == nil {
+		return
+	}
+	a.f.Sync()
+	if err := a.f.Close(); err != nil {
+		logger.Warn("close audit log", "err", err)
+	}
+	a.f = nil
+}
+
+// Audit requests entries from the server's audit log.
+type Audit struct {
+	Since time.Time // only entries for requests that arrived after Since
+	Limit int       // at most this many of the most recent entries; zero means no limit
+}
+
+// Audit returns the server's record of the requests it has served,
+// oldest first: who asked for what, when, and with what outcome.
+// The server keeps the most recent 1000 entries in memory;
+// the -test.benchserve.audit flag appends all of them to a file.
+// The Audit request itself appears in the log once it has been served.
+func (s *Server) Audit(args Audit, reply *[]AuditEntry) error {
+	s.audit.mu.Lock()
+	defer s.audit.mu.Unlock()
+	var entries []AuditEntry
+	for _, e := range s.audit.entries {
+		if e.Time.After(args.Since) {
+			entries = append(entries, e)
+		}
+	}
+	if args.Limit > 0 && len(entries) > args.Limit {
+		entries = entries[len(entries)-args.Limit:]
+	}
+	*reply = entries
+	return nil
+}
+
+// A requestCodec records each request served by its ServerCodec
+// in the audit log and, at level Debug, the server's log.
+type requestCodec struct {
+	rpc.ServerCodec
+	audit *auditLog
+
+	mu      sync.Mutex
+	entry   AuditEntry             // request being read
+	pending map[uint64]*AuditEntry // by request sequence number
+	lastSeq uint64                 // of the request being read
+
+	params map[uint64][]byte // untruncated Params of pending requests, if recording
+}
+
+func newRequestCodec(c rpc.ServerCodec, addr string, audit *auditLog) *requestCodec {
+	return &requestCodec{ServerCodec: c, audit: audit, entry: AuditEntry{Client: addr}, pending: make(map[uint64]*AuditEntry), params: make(map[uint64][]byte)}
+}
+
+func (c *requestCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		e := c.entry
+		e.Time, e.Method = time.Now(), r.ServiceMethod
+		c.mu.Lock()
+		c.pending[r.Seq] = &e
+		c.lastSeq = r.Seq
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// ReadRequestBody is always called right after ReadRequestHeader,
+// for the same request.
+func (c *requestCodec) ReadRequestBody(body interface{}) error {
+	err := c.ServerCodec.ReadRequestBody(body)
+	if err != nil || body == nil {
+		return err
+	}
+	buf, _ := json.Marshal(body)
+	c.mu.Lock()
+	if e := c.pending[c.lastSeq]; e != nil {
+		e.Params = auditParams(e.Method, buf)
+		if c.audit.traffic != nil {
+			c.params[c.lastSeq] = buf
+		}
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *requestCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	e := c.pending[r.Seq]
+	params := c.params[r.Seq]
+	delete(c.pending, r.Seq)
+	delete(c.params, r.Seq)
+	c.mu.Unlock()
+	err := c.ServerCodec.WriteResponse(r, body)
+	if e == nil {
+		return err
+	}
+	e.Duration, e.Error = time.Since(e.Time), r.Error
+	c.audit.served(*e)
+	if c.audit.traffic != nil {
+		x := Exchange{Time: e.Time, Client: e.Client, Method: e.Method, Duration: e.Duration, Params: params}
+		if r.Error != "" {
+			x.Error = &Error{Code: ErrFailed, Message: r.Error}
+		}
+		c.audit.traffic.add(x, body)
+	}
+	return err
+}
+
+// served records a served request in the audit log and,
+// at level Debug, the server's log.
+func (a *auditLog) served(e AuditEntry) {
+	a.add(e)
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		args := []interface{}{"method", e.Method, "client", e.Client, "duration", e.Duration}
+		if e.Error != "" {
+			args = append(args, "err", e.Error)
+		}
+		logger.Debug("request", args...)
+	}
+}
@@ -0,0 +1,184 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Baseline is a named set of results of a known-good test binary,
+// kept for later regression checks on the same machine.
+type Baseline struct {
+	Name   string
+	Binary string    // hash of the test binary whose runs the baseline holds
+	Saved  time.Time // when the baseline was saved
+	Info   Info      // the server's build and platform when it was saved
+
+	Runs    int      // number of runs in Records
+	Records []Record `json:",omitempty"` // the runs, oldest first; omitted by ListBaselines
+}
+
+// SaveBaseline requests saving a baseline.
+type SaveBaseline struct {
+	Name string // name of the baseline; an existing baseline of the same name is replaced
+
+	// Binary is the hash of the test binary whose runs to save,
+	// as reported by History, default the running binary.
+	Binary string
+
+	// Pattern selects the benchmarks to include,
+	// with the same semantics as -test.bench.
+	Pattern string
+
+	Since time.Time // if non-zero, only include runs completed at or after Since
+}
+
+// BaselineName names a baseline.
+type BaselineName struct {
+	Name string
+}
+
+// baselineStore is a persistent store of Baselines, kept as a JSON file
+// next to the history store, named by -test.benchserve.history
+// with ".baselines" appended.
+type baselineStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// load returns the stored baselines, by name.
+func (b *baselineStore) load() (map[string]Baseline, error) {
+	m := make(map[string]Baseline)
+	buf, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", b.path, err)
+	}
+	return m, nil
+}
+
+// store replaces the stored baselines with m.
+func (b *baselineStore) store(m map[string]Baseline) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// Write and rename, so that a crash cannot lose the existing baselines.
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// get returns the named baseline.
+func (b *baselineStore) get(name string) (Baseline, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m, err := b.load()
+	bl, ok := m[name]
+	return bl, ok, err
+}
+
+// checkBaselines returns an error if the server has no baseline store.
+func (s *Server) checkBaselines() error {
+	if s.baselines == nil {
+		return errors.New("baselines require the history store; set -test.benchserve.history")
+	}
+	return nil
+}
+
+// SaveBaseline saves the runs of a test binary in the history store,
+// with the server's Info, as a named baseline, for CheckRegression.
+// Baselines persist across server restarts and test binaries.
+func (s *Server) SaveBaseline(args SaveBaseline, reply *Baseline) error {
+	if err := s.checkBaselines(); err != nil {
+		return err
+	}
+	if args.Name == "" {
+		return errors.New("no baseline name")
+	}
+	binary := args.Binary
+	if binary == "" {
+		binary = binaryHash()
+	}
+	var h HistoryResult
+	if err := s.History(History{Pattern: args.Pattern, Binary: binary, Since: args.Since}, &h); err != nil {
+		return err
+	}
+	var recs []Record
+	for _, rec := range h.Records {
+		if rec.Error == "" {
+			recs = append(recs, rec)
+		}
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("history has no successful runs matching %q by binary %s", args.Pattern, binary)
+	}
+	bl := Baseline{Name: args.Name, Binary: binary, Saved: time.Now(), Runs: len(recs), Records: recs}
+	if err := s.Info(struct{}{}, &bl.Info); err != nil {
+		return err
+	}
+
+	s.baselines.mu.Lock()
+	defer s.baselines.mu.Unlock()
+	m, err := s.baselines.load()
+	if err != nil {
+		return err
+	}
+	m[args.Name] = bl
+	if err := s.baselines.store(m); err != nil {
+		return err
+	}
+	bl.Records = nil
+	*reply = bl
+	return nil
+}
+
+// ListBaselines lists the saved baselines, sorted by name, without their Records.
+func (s *Server) ListBaselines(args struct{}, reply *[]Baseline) error {
+	if err := s.checkBaselines(); err != nil {
+		return err
+	}
+	s.baselines.mu.Lock()
+	m, err := s.baselines.load()
+	s.baselines.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	list := []Baseline{}
+	for _, bl := range m {
+		bl.Records = nil
+		list = append(list, bl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	*reply = list
+	return nil
+}
+
+// DeleteBaseline deletes a saved baseline.
+func (s *Server) DeleteBaseline(args BaselineName, reply *struct{}) error {
+	if err := s.checkBaselines(); err != nil {
+		return err
+	}
+	s.baselines.mu.Lock()
+	defer s.baselines.mu.Unlock()
+	m, err := s.baselines.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := m[args.Name]; !ok {
+		return fmt.Errorf("baseline %s not found", args.Name)
+	}
+	delete(m, args.Name)
+	return s.baselines.store(m)
+}
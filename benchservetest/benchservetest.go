@@ -0,0 +1,513 @@
+// Package benchservetest provides a fake benchmark server,
+// for testing programs that drive benchserve servers.
+//
+// A Server speaks JSON-RPC, as implemented by net/rpc/jsonrpc,
+// on a local port, like a real server started with -test.benchserve,
+// but runs in the test's own process, and its benchmarks only
+// pretend to run: each reports the results that the test scripts for it.
+// This lets driver authors test their orchestration code
+// without compiling and launching a real test binary:
+//
+//	srv := benchservetest.NewServer(
+//		benchservetest.Benchmark{Name: "BenchmarkFoo", NsPerOp: 120},
+//		benchservetest.Benchmark{Name: "BenchmarkBar", Err: "BenchmarkBar failed"},
+//	)
+//	defer srv.Close()
+//	c := srv.Client()
+//	var r benchserve.Result
+//	err := c.Call("Server.Run", benchserve.Run{Name: "BenchmarkFoo", Procs: 1, N: 1000}, &r)
+//
+// The fake implements Server.Info, List, Run, Cancel, Submit, Job,
+// Queue, CancelJob, and CancelAll, with the same arguments and results
+// as the real ones, with these exceptions: Run ignores the options
+// that change how a benchmark is measured, such as Isolate and Batches;
+// Submit runs each of a batch's Runs once, in order, ignoring its Order,
+// Select, Budget, and Labels; and CancelAll selects jobs only by State.
+// Jobs run one at a time, by Priority and then in the order submitted.
+// Calls returns the calls made to the server,
+// for checking what a driver requested.
+package benchservetest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/josharian/benchserve"
+)
+
+// Benchmark describes a fake benchmark.
+type Benchmark struct {
+	Name string   // name of the benchmark, such as "BenchmarkFoo"
+	Tags []string // tags selected by List.Tags, as attached by benchserve.Tag
+
+	// NsPerOp is the ns/op reported by each run, default 100.
+	// AllocsPerOp and BytesPerOp are the allocations reported.
+	NsPerOp     float64
+	AllocsPerOp uint64
+	BytesPerOp  uint64
+
+	// Err, if set, makes each run fail with this error.
+	Err string
+
+	// Duration, if positive, is how long each run takes in real time,
+	// so that drivers can test Cancel, which ends the run early.
+	Duration time.Duration
+
+	// Func, if set, computes the result of each run instead,
+	// for benchmarks whose results change between runs.
+	// The Server fills in the Result's N if Func leaves it zero,
+	// and its per-op values, such as NsPerOp, from its totals,
+	// as a real server does. Totals that Func leaves zero
+	// are computed from the per-op values instead.
+	Func func(benchserve.Run) (benchserve.Result, error)
+}
+
+// Call is a call made to a Server.
+type Call struct {
+	Method string      // such as "Server.Run"
+	Args   interface{} // the arguments, such as a benchserve.Run
+}
+
+// Server is a fake benchmark server.
+type Server struct {
+	Addr string // address on which the server listens, as host:port
+
+	l   net.Listener
+	rpc *rpc.Server
+
+	runMu sync.Mutex // held while running a benchmark, as in a real server
+
+	mu         sync.Mutex
+	benchmarks map[string]Benchmark
+	calls      []Call
+	jobs       map[string]*job
+	queue      []*job // jobs waiting to run, in order
+	running    bool   // runJobs is running
+	nextID     int
+	stop       func() // cancels the running benchmark, if any
+}
+
+// A job is a Batch submitted to a Server.
+type job struct {
+	batch    benchserve.Batch
+	status   benchserve.JobStatus // guarded by Server.mu
+	canceled bool                 // guarded by Server.mu
+}
+
+// NewServer starts a fake server with the given benchmarks,
+// listening on a local port. The caller should call Close when done.
+func NewServer(benchmarks ...Benchmark) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("benchservetest: failed to listen: %v", err))
+	}
+	s := &Server{
+		Addr:       l.Addr().String(),
+		l:          l,
+		rpc:        rpc.NewServer(),
+		benchmarks: make(map[string]Benchmark),
+		jobs:       make(map[string]*job),
+	}
+	for _, b := range benchmarks {
+		s.benchmarks[b.Name] = b
+	}
+	s.rpc.RegisterName("Server", &service{s})
+	go s.serve()
+	return s
+}
+
+// serve serves connections until the listener is closed.
+func (s *Server) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.rpc.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// Close stops the server listening. Connected clients are not disconnected.
+func (s *Server) Close() {
+	s.l.Close()
+}
+
+// Client returns a new client connected to s.
+func (s *Server) Client() *rpc.Client {
+	c, err := jsonrpc.Dial("tcp", s.Addr)
+	if err != nil {
+		panic(fmt.Sprintf("benchservetest: failed to dial: %v", err))
+	}
+	return c
+}
+
+// Calls returns the calls made to s so far, in order.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// record records a call to method. s.mu must be held.
+func (s *Server) record(method string, args interface{}) {
+	s.calls = append(s.calls, Call{Method: method, Args: args})
+}
+
+// run performs a fake run.
+// A canceled run succeeds with a Result marked Canceled, as with a real server,
+// whose Run returns it with a nil error.
+func (s *Server) run(run benchserve.Run) (benchserve.Result, error) {
+	s.mu.Lock()
+	b, ok := s.benchmarks[run.Name]
+	s.mu.Unlock()
+	if !ok {
+		return benchserve.Result{}, fmt.Errorf("%s not found", run.Name)
+	}
+	if run.N <= 0 || run.Procs <= 0 {
+		return benchserve.Result{}, fmt.Errorf("%s: N and Procs must be positive", run.Name)
+	}
+
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.mu.Lock()
+	s.stop = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.stop = nil
+		s.mu.Unlock()
+	}()
+
+	if b.Duration > 0 {
+		t := time.NewTimer(b.Duration)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+	r, err := measure(b, run)
+	if ctx.Err() != nil {
+		r.Canceled = true
+		return r, errCanceled
+	}
+	return r, err
+}
+
+// errCanceled is returned by run when Cancel interrupts it.
+var errCanceled = fmt.Errorf("canceled")
+
+// measure returns the result of a run of b.
+func measure(b Benchmark, run benchserve.Run) (benchserve.Result, error) {
+	if b.Func != nil {
+		r, err := b.Func(run)
+		if r.N == 0 {
+			r.N = run.N
+		}
+		perOp(&r)
+		return r, err
+	}
+	if b.Err != "" {
+		return benchserve.Result{}, fmt.Errorf("%s", b.Err)
+	}
+	ns := b.NsPerOp
+	if ns == 0 {
+		ns = 100
+	}
+	var r benchserve.Result
+	r.N = run.N
+	r.T = time.Duration(ns * float64(run.N))
+	r.MemAllocs = b.AllocsPerOp * uint64(run.N)
+	r.MemBytes = b.BytesPerOp * uint64(run.N)
+	perOp(&r)
+	r.Labels = run.Labels
+	r.Seed = run.Seed
+	r.Config = benchserve.Config{N: run.N, Procs: run.Procs, Parallelism: 1, GOGC: 100}
+	r.End = time.Now()
+	r.Start = r.End.Add(-r.T)
+	return r, nil
+}
+
+// perOp sets r's per-iteration values from its totals, as a real server does.
+// It first sets any zero totals from the per-iteration values.
+func perOp(r *benchserve.Result) {
+	if r.N <= 0 {
+		return
+	}
+	n := float64(r.N)
+	if r.T == 0 {
+		r.T = time.Duration(r.NsPerOp * n)
+	}
+	if r.MemAllocs == 0 {
+		r.MemAllocs = uint64(r.AllocsPerOp * n)
+	}
+	if r.MemBytes == 0 {
+		r.MemBytes = uint64(r.AllocedBytesPerOp * n)
+	}
+	r.NsPerOp = float64(r.T.Nanoseconds()) / n
+	r.AllocsPerOp = float64(r.MemAllocs) / n
+	r.AllocedBytesPerOp = float64(r.MemBytes) / n
+	r.MBPerSec = 0
+	if r.Bytes > 0 && r.T > 0 {
+		r.MBPerSec = float64(r.Bytes) * n / 1e6 / r.T.Seconds()
+	}
+}
+
+// runJobs runs queued jobs, one at a time, until the queue is empty.
+func (s *Server) runJobs() {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		j := s.queue[0]
+		s.queue = s.queue[1:]
+		j.status.State = benchserve.JobRunning
+		s.mu.Unlock()
+
+		failed := false
+		for _, run := range j.batch.Runs {
+			s.mu.Lock()
+			canceled := j.canceled
+			s.mu.Unlock()
+			if canceled {
+				break
+			}
+			r, err := s.run(run)
+			if err == errCanceled {
+				err = nil
+			}
+			msg := ""
+			if err != nil {
+				msg, failed = err.Error(), true
+			}
+			s.mu.Lock()
+			j.status.Runs = append(j.status.Runs, run)
+			j.status.Results = append(j.status.Results, r)
+			j.status.Errors = append(j.status.Errors, msg)
+			j.status.Reasons = append(j.status.Reasons, "requested")
+			s.mu.Unlock()
+		}
+
+		s.mu.Lock()
+		switch {
+		case j.canceled:
+			j.status.State = benchserve.JobCanceled
+		case failed:
+			j.status.State = benchserve.JobFailed
+		default:
+			j.status.State = benchserve.JobDone
+		}
+		j.status.Finished = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// WaitJobs waits until every job submitted to s has finished.
+func (s *Server) WaitJobs() {
+	for {
+		s.mu.Lock()
+		busy := false
+		for _, j := range s.jobs {
+			if j.status.Finished.IsZero() {
+				busy = true
+			}
+		}
+		s.mu.Unlock()
+		if !busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// service holds the RPC methods of a Server.
+type service struct {
+	s *Server
+}
+
+func (v *service) Info(args struct{}, reply *benchserve.Info) error {
+	v.s.mu.Lock()
+	v.s.record("Server.Info", args)
+	v.s.mu.Unlock()
+	*reply = benchserve.Info{
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Package:   "benchservetest",
+		Binary:    "benchservetest",
+	}
+	return nil
+}
+
+func (v *service) List(args benchserve.List, names *[]string) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.List", args)
+	for name, b := range s.benchmarks {
+		ok, err := args.Matches(name, b.Tags)
+		if err != nil {
+			return err
+		}
+		if ok {
+			*names = append(*names, name)
+		}
+	}
+	sort.Strings(*names)
+	return nil
+}
+
+func (v *service) Run(args benchserve.Run, reply *benchserve.Result) error {
+	v.s.mu.Lock()
+	v.s.record("Server.Run", args)
+	v.s.mu.Unlock()
+	r, err := v.s.run(args)
+	*reply = r
+	if err == errCanceled {
+		return nil
+	}
+	return err
+}
+
+func (v *service) Cancel(args struct{}, reply *struct{}) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.Cancel", args)
+	if s.stop == nil {
+		return fmt.Errorf("no benchmark running")
+	}
+	s.stop()
+	return nil
+}
+
+func (v *service) Submit(args benchserve.Batch, reply *benchserve.JobID) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.Submit", args)
+	if len(args.Runs) == 0 {
+		return fmt.Errorf("invalid batch: empty batch")
+	}
+	id := args.ID
+	if id == "" {
+		s.nextID++
+		id = fmt.Sprintf("job-%d", s.nextID)
+	}
+	if _, ok := s.jobs[id]; ok {
+		reply.ID = id
+		return nil
+	}
+	j := &job{batch: args, status: benchserve.JobStatus{ID: id, State: benchserve.JobQueued, Submitted: time.Now()}}
+	s.jobs[id] = j
+	i := len(s.queue)
+	for i > 0 && s.queue[i-1].batch.Priority < args.Priority {
+		i--
+	}
+	s.queue = append(s.queue, nil)
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = j
+	if !s.running {
+		s.running = true
+		go s.runJobs()
+	}
+	reply.ID = id
+	return nil
+}
+
+func (v *service) Job(args benchserve.JobID, reply *benchserve.JobStatus) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.Job", args)
+	j, ok := s.jobs[args.ID]
+	if !ok {
+		return fmt.Errorf("job %s not found", args.ID)
+	}
+	st := j.status
+	st.Runs = append([]benchserve.Run(nil), st.Runs...)
+	st.Results = append([]benchserve.Result(nil), st.Results...)
+	st.Errors = append([]string(nil), st.Errors...)
+	st.Reasons = append([]string(nil), st.Reasons...)
+	*reply = st
+	return nil
+}
+
+func (v *service) Queue(args struct{}, reply *benchserve.QueueInfo) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.Queue", args)
+	for _, j := range s.jobs {
+		if j.status.State == benchserve.JobRunning {
+			reply.Running = &benchserve.QueueEntry{ID: j.status.ID, State: j.status.State, Submitted: j.status.Submitted, Batch: j.batch, Done: len(j.status.Runs)}
+		}
+	}
+	for _, j := range s.queue {
+		reply.Queued = append(reply.Queued, benchserve.QueueEntry{ID: j.status.ID, State: j.status.State, Submitted: j.status.Submitted, Batch: j.batch})
+	}
+	return nil
+}
+
+func (v *service) CancelJob(args benchserve.JobID, reply *struct{}) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.CancelJob", args)
+	j, ok := s.jobs[args.ID]
+	if !ok {
+		return fmt.Errorf("job %s not found", args.ID)
+	}
+	if !s.cancel(j) {
+		return fmt.Errorf("job %s has already finished", args.ID)
+	}
+	return nil
+}
+
+func (v *service) CancelAll(args benchserve.JobFilter, reply *benchserve.CanceledJobs) error {
+	s := v.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record("Server.CancelAll", args)
+	for id, j := range s.jobs {
+		if args.State != "" && j.status.State != args.State {
+			continue
+		}
+		if s.cancel(j) {
+			reply.IDs = append(reply.IDs, id)
+		}
+	}
+	sort.Strings(reply.IDs)
+	return nil
+}
+
+// cancel cancels j, reporting false if it has already finished.
+// s.mu must be held.
+func (s *Server) cancel(j *job) bool {
+	if !j.status.Finished.IsZero() {
+		return false
+	}
+	j.canceled = true
+	for i, k := range s.queue {
+		if k == j {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			j.status.State = benchserve.JobCanceled
+			j.status.Finished = time.Now()
+			break
+		}
+	}
+	return true
+}
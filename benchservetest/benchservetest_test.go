@@ -0,0 +1,193 @@
+package benchservetest_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/josharian/benchserve"
+	"github.com/josharian/benchserve/benchservetest"
+)
+
+// The test binary doubles as a real server, with these benchmarks,
+// against which the fake is checked.
+
+func TestMain(m *testing.M) {
+	benchserve.Tag("BenchmarkFoo", "quick")
+	benchserve.Tag("BenchmarkBar", "quick", "slow")
+	benchserve.Main(m)
+}
+
+func BenchmarkFoo(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+	}
+}
+
+func BenchmarkBar(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+	}
+}
+
+func BenchmarkSleep(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newFake returns a fake server with the same benchmarks as the real one.
+func newFake(t *testing.T) *rpc.Client {
+	srv := benchservetest.NewServer(
+		benchservetest.Benchmark{Name: "BenchmarkFoo", Tags: []string{"quick"}},
+		benchservetest.Benchmark{Name: "BenchmarkBar", Tags: []string{"quick", "slow"}},
+		benchservetest.Benchmark{Name: "BenchmarkSleep", Duration: 10 * time.Second},
+	)
+	t.Cleanup(srv.Close)
+	c := srv.Client()
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// newReal starts a real server in a copy of the test binary, and connects to it.
+func newReal(t *testing.T) *rpc.Client {
+	if testing.Short() {
+		t.Skip("skipping real server in short mode")
+	}
+	portfile := filepath.Join(t.TempDir(), "port")
+	cmd := exec.Command(os.Args[0], "-test.benchserve", "-test.benchserve.addr=127.0.0.1:0", "-test.benchserve.portfile="+portfile)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	var info struct{ Addr string }
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		data, err := os.ReadFile(portfile)
+		if err == nil && json.Unmarshal(data, &info) == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("real server did not start")
+		}
+	}
+	c, err := jsonrpc.Dial("tcp", info.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestList(t *testing.T) {
+	fake, server := newFake(t), newReal(t)
+	for _, l := range []benchserve.List{
+		{},
+		{Pattern: "Foo"},
+		{Pattern: "Bar|Sleep"},
+		{Pattern: "^BenchmarkFoo$/sub"},
+		{Pattern: "NoSuch"},
+		{Tags: []string{"quick"}},
+		{Tags: []string{"quick", "slow"}},
+		{Pattern: "Foo", Tags: []string{"slow"}},
+		{Pattern: "["},
+	} {
+		var want, got []string
+		wantErr := server.Call("Server.List", l, &want)
+		gotErr := fake.Call("Server.List", l, &got)
+		if (gotErr == nil) != (wantErr == nil) || !reflect.DeepEqual(got, want) {
+			t.Errorf("List(%+v) = %q, %v; real server: %q, %v", l, got, gotErr, want, wantErr)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	fake, server := newFake(t), newReal(t)
+	for _, c := range []*rpc.Client{server, fake} {
+		run := benchserve.Run{Name: "BenchmarkFoo", Procs: 1, N: 1000, Seed: 3, Labels: map[string]string{"commit": "abc"}}
+		var r benchserve.Result
+		if err := c.Call("Server.Run", run, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.N != run.N || r.Config.N != run.N || r.Config.Procs != run.Procs || r.Seed != run.Seed || r.Labels["commit"] != "abc" {
+			t.Errorf("Run(%+v) = %+v", run, r)
+		}
+		if ns := float64(r.T.Nanoseconds()) / float64(r.N); r.NsPerOp != ns {
+			t.Errorf("Run(%+v): NsPerOp = %v, want T/N = %v", run, r.NsPerOp, ns)
+		}
+	}
+
+	var got, want benchserve.Result
+	run := benchserve.Run{Name: "BenchmarkNoSuch", Procs: 1, N: 1}
+	wantErr := server.Call("Server.Run", run, &want)
+	gotErr := fake.Call("Server.Run", run, &got)
+	if gotErr == nil || wantErr == nil || gotErr.Error() != wantErr.Error() {
+		t.Errorf("Run(%+v) error = %v; real server: %v", run, gotErr, wantErr)
+	}
+}
+
+func TestRunFunc(t *testing.T) {
+	srv := benchservetest.NewServer(
+		benchservetest.Benchmark{Name: "BenchmarkTotals", Func: func(run benchserve.Run) (benchserve.Result, error) {
+			var r benchserve.Result
+			r.T = time.Duration(run.N) * time.Microsecond
+			r.MemAllocs = 2 * uint64(run.N)
+			r.Bytes = 1000
+			return r, nil
+		}},
+		benchservetest.Benchmark{Name: "BenchmarkPerOp", Func: func(run benchserve.Run) (benchserve.Result, error) {
+			var r benchserve.Result
+			r.NsPerOp, r.AllocsPerOp = 1000, 2
+			r.Bytes = 1000
+			return r, nil
+		}},
+	)
+	defer srv.Close()
+	c := srv.Client()
+	defer c.Close()
+	for _, name := range []string{"BenchmarkTotals", "BenchmarkPerOp"} {
+		var r benchserve.Result
+		if err := c.Call("Server.Run", benchserve.Run{Name: name, Procs: 1, N: 10}, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.N != 10 || r.T != 10*time.Microsecond || r.MemAllocs != 20 || r.NsPerOp != 1000 || r.AllocsPerOp != 2 || math.Abs(r.MBPerSec-1000) > 1e-9 {
+			t.Errorf("%s: Run: N=%d T=%v MemAllocs=%d NsPerOp=%v AllocsPerOp=%v MBPerSec=%v; want 10, 10µs, 20, 1000, 2, 1000", name, r.N, r.T, r.MemAllocs, r.NsPerOp, r.AllocsPerOp, r.MBPerSec)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	fake, server := newFake(t), newReal(t)
+	for _, c := range []*rpc.Client{server, fake} {
+		var want, got error
+		want = server.Call("Server.Cancel", struct{}{}, &struct{}{})
+		got = c.Call("Server.Cancel", struct{}{}, &struct{}{})
+		if got == nil || want == nil || got.Error() != want.Error() {
+			t.Errorf("Cancel with no run = %v; real server: %v", got, want)
+		}
+
+		done := make(chan error, 1)
+		var r benchserve.Result
+		go func() {
+			done <- c.Call("Server.Run", benchserve.Run{Name: "BenchmarkSleep", Procs: 1, N: 300}, &r)
+		}()
+		for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if c.Call("Server.Cancel", struct{}{}, &struct{}{}) == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Cancel never found the run")
+			}
+		}
+		if err := <-done; err != nil || !r.Canceled {
+			t.Errorf("canceled Run = %+v, %v; want Canceled and no error", r, err)
+		}
+	}
+}
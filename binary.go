@@ -0,0 +1,36 @@
+package benchserve
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	binaryHashOnce sync.Once
+	binaryHashHex  string
+)
+
+// binaryHash returns the hex-encoded SHA-256 hash of the running test binary,
+// or the empty string if the binary cannot be read.
+func binaryHash() string {
+	binaryHashOnce.Do(func() {
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return
+		}
+		binaryHashHex = hex.EncodeToString(h.Sum(nil))
+	})
+	return binaryHashHex
+}
@@ -0,0 +1,63 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// A resultCache holds results of successful runs,
+// enabled by the -test.benchserve.cache flag.
+type resultCache struct {
+	mu sync.Mutex
+	m  map[string]Result // keyed by cacheKey
+}
+
+// cacheKey returns the cache key for run with options opt in the given binary.
+func cacheKey(binary string, run Run, opt Options) string {
+	run.Fresh = false
+	run.Labels = nil // do not affect the measurement
+	buf, _ := json.Marshal(struct {
+		Binary  string
+		Run     Run
+		Options Options
+	}{binary, run, opt})
+	return string(buf)
+}
+
+// cacheable reports whether the result of run may be reused.
+// A zero Seed and RandomizeLayout each choose afresh for every run.
+func cacheable(run Run) bool {
+	return run.Seed != 0 && !run.RandomizeLayout
+}
+
+func (c *resultCache) get(key string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.m[key]
+	return r, ok
+}
+
+func (c *resultCache) put(key string, r Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]Result)
+	}
+	c.m[key] = r
+}
+
+// newResultCache returns a cache seeded with the successful runs
+// of this binary found in h, if h is non-nil.
+func newResultCache(h *history) (*resultCache, error) {
+	c := new(resultCache)
+	if h == nil {
+		return c, nil
+	}
+	binary := binaryHash()
+	err := h.scan(func(rec Record) {
+		if rec.Binary == binary && rec.Error == "" && !rec.Result.Canceled && cacheable(rec.Run) {
+			c.put(cacheKey(rec.Binary, rec.Run, rec.Options), rec.Result)
+		}
+	})
+	return c, err
+}
@@ -0,0 +1,125 @@
+package benchserve
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// campaignFirstRound is the number of samples a campaign takes
+// of each run before allocating samples by uncertainty.
+const campaignFirstRound = 3
+
+// campaign repeats j's runs within its budget, as described at Batch.Budget.
+// It reports whether any run failed.
+func (j *job) campaign() (failed bool) {
+	runs := j.batch.Runs
+	samples := make([][]float64, len(runs))
+	spent := make([]time.Duration, len(runs)) // total time of each run's samples
+	dead := make([]bool, len(runs))           // failed; not sampled further
+	sampled := make([]bool, len(runs))        // sampled successfully at least once
+	start := time.Now()
+	deadline := start.Add(j.batch.Budget)
+
+	// sample takes a sample of run i, reporting false if the campaign should stop.
+	sample := func(i int, reason string) bool {
+		t := time.Now()
+		r, err := j.perform(runs[i], reason)
+		spent[i] += time.Since(t)
+		switch {
+		case err == errJobCanceled:
+			return false
+		case err != nil:
+			failed, dead[i] = true, true
+		case r.Canceled:
+			return false
+		default:
+			samples[i] = append(samples[i], nsPerOp(r))
+			sampled[i] = true
+		}
+		return true
+	}
+
+	// fits reports whether another sample of run i fits in the budget,
+	// assuming it takes as long as its earlier ones.
+	fits := func(i int) bool {
+		n := len(samples[i])
+		if n == 0 {
+			return time.Now().Before(deadline)
+		}
+		return time.Now().Add(spent[i] / time.Duration(n)).Before(deadline)
+	}
+
+	defer func() {
+		s := j.srv
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, x := range samples {
+			mean, hw := ci95(x)
+			if math.IsInf(hw, 0) {
+				hw = 0
+			}
+			sum := Summary{Run: runs[i], Samples: len(x), Mean: mean, HalfWidth: hw}
+			sum.Outliers, sum.All, sum.Inliers = tukey(x)
+			j.status.Summary = append(j.status.Summary, sum)
+		}
+	}()
+
+	plan, _ := j.batch.plan() // checked by Submit
+	for round := 0; round < campaignFirstRound; round++ {
+		for _, i := range plan {
+			if dead[i] {
+				continue
+			}
+			// Wait for the runs that must precede i to be sampled,
+			// and give up on i if one of them failed.
+			if k := j.batch.blocker(i, sampled); k >= 0 {
+				if dead[k] {
+					j.skip(i, k)
+					failed, dead[i] = true, true
+				}
+				continue
+			}
+			if !fits(i) {
+				continue
+			}
+			if !sample(i, fmt.Sprintf("first round, sample %d of %d", round+1, campaignFirstRound)) {
+				return failed
+			}
+		}
+	}
+
+	for {
+		// Sample the run whose relative confidence interval
+		// another sample is expected to narrow the most per unit time,
+		// among those that fit in the budget. With n samples,
+		// the half-width shrinks roughly as 1/sqrt(n).
+		best, bestGain, bestWidth := -1, 0.0, 0.0
+		for i, x := range samples {
+			if dead[i] || len(x) == 0 || !fits(i) {
+				continue
+			}
+			mean, hw := ci95(x)
+			width := math.Inf(1)
+			if mean > 0 && !math.IsInf(hw, 0) {
+				width = hw / mean
+			}
+			n := float64(len(x))
+			cost := spent[i].Seconds() / n
+			gain := width * (1 - math.Sqrt(n/(n+1))) / math.Max(cost, 1e-9)
+			if best < 0 || gain > bestGain {
+				best, bestGain, bestWidth = i, gain, width
+			}
+		}
+		if best < 0 {
+			return failed
+		}
+		reason := fmt.Sprintf("most improvable: ±%.2f%%", 100*bestWidth)
+		if math.IsInf(bestWidth, 0) {
+			reason = "most improvable: too few samples"
+		}
+		if !sample(best, reason) {
+			return failed
+		}
+	}
+}
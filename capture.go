@@ -0,0 +1,163 @@
+package benchserve
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// startCapture starts the profiling requested by args.
+// The returned stop function ends it and saves the results as artifacts,
+// returning their IDs by kind.
+func startCapture(args Run) (stop func() (map[string]string, error), err error) {
+	var cpu, tr *bytes.Buffer
+	if args.CPUProfile {
+		cpu = new(bytes.Buffer)
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			return nil, fmt.Errorf("start CPU profile: %v", err)
+		}
+	}
+	if args.Trace {
+		tr = new(bytes.Buffer)
+		if err := trace.Start(tr); err != nil {
+			if cpu != nil {
+				pprof.StopCPUProfile()
+			}
+			return nil, fmt.Errorf("start trace: %v", err)
+		}
+	}
+
+	var blockBefore, mutexBefore []runtime.BlockProfileRecord
+	blockRate := -1
+	if args.BlockProfile {
+		blockBefore = contentionRecords(runtime.BlockProfile)
+		blockRate = setBlockProfileRate(1)
+	}
+	mutexFraction := -1
+	if args.MutexProfile {
+		mutexBefore = contentionRecords(runtime.MutexProfile)
+		mutexFraction = runtime.SetMutexProfileFraction(1)
+	}
+
+	stop = func() (map[string]string, error) {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+		}
+		if tr != nil {
+			trace.Stop()
+		}
+		var block, mutex *bytes.Buffer
+		if args.BlockProfile {
+			setBlockProfileRate(blockRate)
+			block = contentionProfile(blockBefore, contentionRecords(runtime.BlockProfile), false)
+		}
+		if args.MutexProfile {
+			runtime.SetMutexProfileFraction(mutexFraction)
+			mutex = contentionProfile(mutexBefore, contentionRecords(runtime.MutexProfile), true)
+		}
+		var ids map[string]string
+		for _, a := range []struct {
+			kind string
+			buf  *bytes.Buffer
+		}{{"cpu", cpu}, {"trace", tr}, {"block", block}, {"mutex", mutex}} {
+			if a.buf == nil {
+				continue
+			}
+			id, err := saveArtifact(a.kind, a.buf.Bytes())
+			if err != nil {
+				return ids, err
+			}
+			if ids == nil {
+				ids = make(map[string]string)
+			}
+			ids[a.kind] = id
+		}
+		return ids, nil
+	}
+	return stop, nil
+}
+
+// blockProfileRate is the block profile rate last set by setBlockProfileRate.
+// Unlike SetMutexProfileFraction, runtime.SetBlockProfileRate does not
+// report the previous rate, so the server keeps track of it,
+// starting from the runtime's default of 0.
+var blockProfileRate int
+
+// setBlockProfileRate sets the block profile rate, returning the previous rate.
+// Captures happen during runs, so runMu serializes calls.
+func setBlockProfileRate(rate int) (prev int) {
+	prev, blockProfileRate = blockProfileRate, rate
+	runtime.SetBlockProfileRate(rate)
+	return prev
+}
+
+// contentionRecords returns all the records of a block or mutex profile,
+// as returned by runtime.BlockProfile or runtime.MutexProfile.
+func contentionRecords(profile func([]runtime.BlockProfileRecord) (int, bool)) []runtime.BlockProfileRecord {
+	n, _ := profile(nil)
+	for {
+		recs := make([]runtime.BlockProfileRecord, n+50)
+		var ok bool
+		if n, ok = profile(recs); ok {
+			return recs[:n]
+		}
+	}
+}
+
+// contentionProfile returns the contention recorded between the profile
+// records before and after, in the legacy text format that
+// go tool pprof reads, as written by runtime/pprof with debug=1.
+// The profiles are cumulative for the life of the process,
+// so the records of earlier runs must be subtracted.
+func contentionProfile(before, after []runtime.BlockProfileRecord, mutex bool) *bytes.Buffer {
+	prev := make(map[[32]uintptr]runtime.BlockProfileRecord, len(before))
+	for _, r := range before {
+		prev[r.Stack0] = r
+	}
+	var recs []runtime.BlockProfileRecord
+	for _, r := range after {
+		p := prev[r.Stack0]
+		r.Count -= p.Count
+		r.Cycles -= p.Cycles
+		if r.Count > 0 {
+			recs = append(recs, r)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Cycles > recs[j].Cycles })
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- contention:\ncycles/second=%d\n", cyclesPerSecond())
+	if mutex {
+		fmt.Fprintf(buf, "sampling period=1\n")
+	}
+	for _, r := range recs {
+		fmt.Fprintf(buf, "%d %d @", r.Cycles, r.Count)
+		for _, pc := range r.Stack() {
+			fmt.Fprintf(buf, " %#x", pc)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf
+}
+
+// cyclesPerSecond returns the rate of the clock in which block and mutex
+// profiles measure delays. The runtime does not export it,
+// but runtime/pprof writes it in the header of its text format.
+func cyclesPerSecond() int64 {
+	var buf bytes.Buffer
+	pprof.Lookup("block").WriteTo(&buf, 1)
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "cycles/second="); ok {
+			n, _ := strconv.ParseInt(v, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
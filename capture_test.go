@@ -0,0 +1,20 @@
+package benchserve
+
+import "testing"
+
+func TestCaptureRestoresBlockProfileRate(t *testing.T) {
+	defer setBlockProfileRate(setBlockProfileRate(1000))
+	stop, err := startCapture(Run{BlockProfile: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blockProfileRate != 1 {
+		t.Errorf("during capture, block profile rate = %d, want 1", blockProfileRate)
+	}
+	if _, err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if blockProfileRate != 1000 {
+		t.Errorf("after capture, block profile rate = %d, want 1000", blockProfileRate)
+	}
+}
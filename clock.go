@@ -0,0 +1,47 @@
+package benchserve
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	clockOnce       sync.Once
+	clockSource     string
+	clockResolution time.Duration
+)
+
+// clockInfo returns the operating system's clock source, if known,
+// and the observed resolution of time.Now.
+func clockInfo() (source string, resolution time.Duration) {
+	clockOnce.Do(func() {
+		if runtime.GOOS == "linux" {
+			buf, err := os.ReadFile("/sys/devices/system/clocksource/clocksource0/current_clocksource")
+			if err == nil {
+				clockSource = strings.TrimSpace(string(buf))
+			}
+		}
+		clockResolution = timerResolution()
+	})
+	return clockSource, clockResolution
+}
+
+// timerResolution returns the smallest positive difference
+// observed between successive monotonic clock readings.
+func timerResolution() time.Duration {
+	min := time.Duration(1<<63 - 1)
+	for i := 0; i < 100; i++ {
+		t0 := time.Now()
+		t1 := time.Now()
+		for t1 == t0 {
+			t1 = time.Now()
+		}
+		if d := t1.Sub(t0); d > 0 && d < min {
+			min = d
+		}
+	}
+	return min
+}
@@ -0,0 +1,242 @@
+// Command benchci runs a suite of benchmarks on a benchmark server
+// and summarizes the results as a markdown table, for a GitHub Actions
+// job summary or a pull request comment.
+//
+// Usage:
+//
+//	benchci [flags] addr
+//
+// With -baseline, benchci checks each benchmark against the named
+// baseline (or baseline binary hash) with Server.CheckRegression,
+// and exits with status 1 if any regressed. The server must have been
+// started with -test.benchserve.history. Without -baseline, it only
+// reports the median ns/op of each benchmark.
+//
+// The table is printed to standard output and, if the GITHUB_STEP_SUMMARY
+// environment variable names a file, as in a GitHub Actions step,
+// appended to that file too.
+//
+// The suite is selected by -bench and -cpu, or given by -suite as a file
+// holding a JSON array of benchserve.Run. Unless -n or the suite sets N,
+// benchci picks each benchmark's iteration count aiming for -benchtime
+// per run. With -save, benchci saves the runs as a baseline afterwards,
+// unless they regressed, for example to record a known-good build from the main branch:
+//
+//	benchci -save main 127.0.0.1:52525
+//	benchci -baseline main 127.0.0.1:52525
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josharian/benchserve"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("benchci: ")
+
+	// Use a separate flag set: importing benchserve registers
+	// its -test.benchserve flags on the default one.
+	fs := flag.NewFlagSet("benchci", flag.ExitOnError)
+	bench := fs.String("bench", ".", "run benchmarks matching `regexp`")
+	cpu := fs.String("cpu", "1", "comma-separated `list` of GOMAXPROCS values")
+	suite := fs.String("suite", "", "run the benchserve.Run values in JSON `file` instead of -bench and -cpu")
+	n := fs.Int("n", 0, "iterations per run; 0 picks a count based on -benchtime")
+	benchtime := fs.Duration("benchtime", time.Second, "target `duration` of each run")
+	count := fs.Int("count", 10, "take `n` samples of each benchmark")
+	baseline := fs.String("baseline", "", "check for regressions against the baseline `name` or binary hash")
+	threshold := fs.Float64("threshold", 0.05, "largest acceptable slowdown, as a `fraction` of the baseline")
+	save := fs.String("save", "", "save the runs as the baseline `name` afterwards")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: benchci [flags] addr\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c, err := jsonrpc.Dial("tcp", fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	var runs []benchserve.Run
+	if *suite != "" {
+		buf, err := os.ReadFile(*suite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := json.Unmarshal(buf, &runs); err != nil {
+			log.Fatalf("%s: %v", *suite, err)
+		}
+	} else {
+		for _, s := range strings.Split(*cpu, ",") {
+			p, err := strconv.Atoi(s)
+			if err != nil || p < 1 {
+				log.Fatalf("bad -cpu value %q", s)
+			}
+			var names []string
+			if err := c.Call("Server.List", benchserve.List{Pattern: *bench}, &names); err != nil {
+				log.Fatal(err)
+			}
+			for _, name := range names {
+				runs = append(runs, benchserve.Run{Name: name, Procs: p})
+			}
+		}
+	}
+	if len(runs) == 0 {
+		log.Fatal("no benchmarks to run")
+	}
+	for i := range runs {
+		if runs[i].Procs == 0 {
+			runs[i].Procs = 1
+		}
+		if runs[i].N > 0 {
+			continue
+		}
+		runs[i].N = *n
+		if runs[i].N <= 0 {
+			if runs[i].N, err = iterations(c, runs[i], *benchtime); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// Leave out the estimation runs from any saved baseline.
+	start := time.Now()
+	var table bytes.Buffer
+	regressed := false
+	if *baseline != "" {
+		fmt.Fprintf(&table, "### Benchmarks vs. %s\n\n", *baseline)
+		fmt.Fprintf(&table, "| Benchmark | Baseline | New | Delta | p | Verdict |\n|---|--:|--:|--:|--:|---|\n")
+		for _, run := range runs {
+			args := benchserve.CheckRegression{Run: run, Baseline: *baseline, Threshold: *threshold, Count: *count}
+			var v benchserve.RegressionVerdict
+			if err := c.Call("Server.CheckRegression", args, &v); err != nil {
+				log.Fatalf("%s: %v", run.Name, err)
+			}
+			verdict := "✅ pass"
+			switch {
+			case v.Regressed:
+				verdict = "❌ regressed"
+				regressed = true
+			case v.Improved:
+				verdict = "🚀 improved"
+			}
+			delta := "~"
+			if v.Significant {
+				delta = fmt.Sprintf("%+.1f%%", 100*v.Delta)
+			}
+			fmt.Fprintf(&table, "| %s | %s | %s | %s | %.3f | %s |\n",
+				name(run), ns(v.OldMedian), ns(v.NewMedian), delta, v.UTest, verdict)
+		}
+	} else {
+		fmt.Fprintf(&table, "### Benchmarks\n\n| Benchmark | Median | Samples |\n|---|--:|--:|\n")
+		for _, run := range runs {
+			var samples []float64
+			for i := 0; i < *count; i++ {
+				var r benchserve.Result
+				if err := c.Call("Server.Run", run, &r); err != nil {
+					log.Fatalf("%s: %v", run.Name, err)
+				}
+				samples = append(samples, r.NsPerOp)
+			}
+			fmt.Fprintf(&table, "| %s | %s | %d |\n", name(run), ns(median(samples)), len(samples))
+		}
+	}
+
+	if *save != "" && !regressed {
+		var names []string
+		for _, run := range runs {
+			names = append(names, "^"+run.Name+"$")
+		}
+		var bl benchserve.Baseline
+		args := benchserve.SaveBaseline{Name: *save, Pattern: strings.Join(names, "|"), Since: start}
+		if err := c.Call("Server.SaveBaseline", args, &bl); err != nil {
+			log.Fatalf("save baseline: %v", err)
+		}
+		fmt.Fprintf(&table, "\nSaved %d runs as baseline %s.\n", bl.Runs, *save)
+	}
+
+	os.Stdout.Write(table.Bytes())
+	if file := os.Getenv("GITHUB_STEP_SUMMARY"); file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err == nil {
+			_, err = f.Write(table.Bytes())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			log.Fatalf("write job summary: %v", err)
+		}
+	}
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+// iterations returns the iteration count for run aiming for benchtime.
+func iterations(c *rpc.Client, run benchserve.Run, benchtime time.Duration) (int, error) {
+	var costs []benchserve.Cost
+	args := benchserve.Estimate{Pattern: "^" + run.Name + "$", Procs: run.Procs}
+	if err := c.Call("Server.Estimate", args, &costs); err != nil {
+		return 0, err
+	}
+	if len(costs) != 1 {
+		return 0, fmt.Errorf("%s not found", run.Name)
+	}
+	if costs[0].Err != "" {
+		return 0, fmt.Errorf("%s: %s", run.Name, costs[0].Err)
+	}
+	return int(math.Max(1, math.Min(1e9, float64(benchtime.Nanoseconds())/math.Max(costs[0].NsPerOp, 1)))), nil
+}
+
+// name returns run's benchmark name as go test -bench prints it.
+func name(run benchserve.Run) string {
+	if run.Procs != 1 {
+		return run.Name + "-" + strconv.Itoa(run.Procs)
+	}
+	return run.Name
+}
+
+// ns formats a duration in nanoseconds per op,
+// with decimals only for short durations, as go test -bench does.
+func ns(v float64) string {
+	prec := 0
+	switch {
+	case v < 10:
+		prec = 2
+	case v < 100:
+		prec = 1
+	}
+	return fmt.Sprintf("%.*f ns/op", prec, v)
+}
+
+// median returns the median of x, which it sorts.
+func median(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sort.Float64s(x)
+	if len(x)%2 == 1 {
+		return x[len(x)/2]
+	}
+	return (x[len(x)/2-1] + x[len(x)/2]) / 2
+}
@@ -0,0 +1,181 @@
+// Command benchfan runs the same benchmarks on several benchmark servers
+// in parallel and prints the results as a single benchfmt stream.
+//
+// Usage:
+//
+//	benchfan [flags] addr...
+//
+// Each result is preceded, when the server changes, by a "host: addr"
+// configuration line, so tools such as benchstat can compare
+// the servers, for example with 'benchstat -col host'.
+//
+// Unless -n is set, benchfan picks each benchmark's iteration count
+// on each server separately, aiming for -benchtime per run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josharian/benchserve"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("benchfan: ")
+
+	// Use a separate flag set: importing benchserve registers
+	// its -test.benchserve flags on the default one.
+	fs := flag.NewFlagSet("benchfan", flag.ExitOnError)
+	bench := fs.String("bench", ".", "run benchmarks matching `regexp`")
+	cpu := fs.String("cpu", "1", "comma-separated `list` of GOMAXPROCS values")
+	n := fs.Int("n", 0, "iterations per run; 0 picks a count for each server based on -benchtime")
+	benchtime := fs.Duration("benchtime", time.Second, "target `duration` of each run")
+	count := fs.Int("count", 1, "run each benchmark `n` times")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: benchfan [flags] addr...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var procs []int
+	for _, s := range strings.Split(*cpu, ",") {
+		p, err := strconv.Atoi(s)
+		if err != nil || p < 1 {
+			log.Fatalf("bad -cpu value %q", s)
+		}
+		procs = append(procs, p)
+	}
+
+	out := &output{}
+	var wg sync.WaitGroup
+	failed := false
+	for _, addr := range fs.Args() {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			h := &host{addr: addr, out: out}
+			if err := h.runAll(*bench, procs, *n, *benchtime, *count); err != nil {
+				log.Printf("%s: %v", addr, err)
+				out.mu.Lock()
+				failed = true
+				out.mu.Unlock()
+			}
+		}(addr)
+	}
+	wg.Wait()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// output serializes results from all hosts onto stdout.
+type output struct {
+	mu   sync.Mutex
+	host string // host of the last printed result
+}
+
+// print prints a benchfmt result line for a run on host.
+func (o *output) print(host string, run benchserve.Run, r benchserve.Result) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if host != o.host {
+		fmt.Printf("host: %s\n", host)
+		o.host = host
+	}
+	name := run.Name
+	if run.Procs != 1 {
+		name += "-" + strconv.Itoa(run.Procs)
+	}
+	line := name + "\t" + r.BenchmarkResult.String()
+	if r.ReportAllocs {
+		line += "\t" + r.MemString()
+	}
+	fmt.Println(line)
+}
+
+// A host is a benchmark server being driven.
+type host struct {
+	addr string
+	out  *output
+	c    *rpc.Client
+}
+
+// runAll runs the benchmarks matching pattern on h.
+func (h *host) runAll(pattern string, procs []int, n int, benchtime time.Duration, count int) error {
+	c, err := jsonrpc.Dial("tcp", h.addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	h.c = c
+
+	for _, p := range procs {
+		ns, err := h.iterations(pattern, p, n, benchtime)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedNames(ns) {
+			for i := 0; i < count; i++ {
+				run := benchserve.Run{Name: name, Procs: p, N: ns[name]}
+				var r benchserve.Result
+				if err := c.Call("Server.Run", run, &r); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+				h.out.print(h.addr, run, r)
+			}
+		}
+	}
+	return nil
+}
+
+// iterations returns the iteration count to use for
+// each benchmark matching pattern at procs.
+func (h *host) iterations(pattern string, procs, n int, benchtime time.Duration) (map[string]int, error) {
+	ns := make(map[string]int)
+	if n > 0 {
+		var names []string
+		if err := h.c.Call("Server.List", benchserve.List{Pattern: pattern}, &names); err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			ns[name] = n
+		}
+		return ns, nil
+	}
+
+	var costs []benchserve.Cost
+	if err := h.c.Call("Server.Estimate", benchserve.Estimate{Pattern: pattern, Procs: procs}, &costs); err != nil {
+		return nil, err
+	}
+	for _, c := range costs {
+		if c.Err != "" {
+			return nil, fmt.Errorf("%s: %s", c.Name, c.Err)
+		}
+		ns[c.Name] = int(math.Max(1, math.Min(1e9, float64(benchtime.Nanoseconds())/math.Max(c.NsPerOp, 1))))
+	}
+	return ns, nil
+}
+
+// sortedNames returns the keys of ns in sorted order.
+func sortedNames(ns map[string]int) []string {
+	names := make([]string, 0, len(ns))
+	for name := range ns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,85 @@
+// Command benchls lists running benchmark servers.
+//
+// Usage:
+//
+//	benchls [-dir dir] [-net duration] [-json]
+//
+// By default, benchls lists the servers registered on this host
+// by the current user. The -net flag additionally listens for
+// servers on the local network that were started with
+// -test.benchserve.announce.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/josharian/benchserve"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("benchls: ")
+
+	// Use a separate flag set: importing benchserve registers
+	// its -test.benchserve flags on the default one.
+	fs := flag.NewFlagSet("benchls", flag.ExitOnError)
+	dir := fs.String("dir", benchserve.DefaultRegistry, "registry `directory`")
+	network := fs.Duration("net", 0, "also listen for announcements on the local network for `duration`")
+	asJSON := fs.Bool("json", false, "print one JSON Announcement per line")
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	list, err := benchserve.Registered(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *network > 0 {
+		remote, err := benchserve.Discover(*network)
+		if err != nil {
+			log.Fatal(err)
+		}
+		list = merge(list, remote)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, a := range list {
+			enc.Encode(a)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDR\tPID\tNAME\tPACKAGE\tBINARY")
+	for _, a := range list {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%.12s\n", a.Addr, a.PID, a.Name, a.Package, a.Binary)
+	}
+	w.Flush()
+}
+
+// merge appends the announcements in remote that are not in local.
+// A local server that announces itself appears in both,
+// with the same PID and binary.
+func merge(local, remote []benchserve.Announcement) []benchserve.Announcement {
+	type key struct {
+		pid    int
+		binary string
+	}
+	seen := make(map[key]bool)
+	for _, a := range local {
+		seen[key{a.PID, a.Binary}] = true
+	}
+	for _, a := range remote {
+		if !seen[key{a.PID, a.Binary}] {
+			local = append(local, a)
+		}
+	}
+	return local
+}
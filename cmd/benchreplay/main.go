@@ -0,0 +1,261 @@
+// Command benchreplay serves the responses recorded by a benchmark server
+// started with -test.benchserve.record, for deterministic tests of drivers
+// and reproducible reports of protocol bugs.
+//
+// Usage:
+//
+//	benchreplay [-addr host:port] [-loose] recording
+//
+// benchreplay answers each request with the response to the same request,
+// with the same method and equal params, in the recording. Repeated
+// requests get the recorded responses in order, and then the last of them
+// again, so that a driver that polls Server.Job sees the job progress
+// as it did. With -loose, a request that was not recorded gets the next
+// response to any request for the same method instead. Other requests fail.
+//
+// benchreplay speaks JSON-RPC, as implemented by net/rpc/jsonrpc,
+// and the JSON-lines protocol, but not MessagePack-RPC.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/josharian/benchserve"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("benchreplay: ")
+
+	// Use a separate flag set: importing benchserve registers
+	// its -test.benchserve flags on the default one.
+	fs := flag.NewFlagSet("benchreplay", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:52525", "listen on `host:port`")
+	loose := fs.Bool("loose", false, "answer requests that were not recorded with responses to the same method")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: benchreplay [flags] recording\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	r, err := load(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	r.loose = *loose
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("replaying %d responses on %s", r.n, l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go r.serve(conn)
+	}
+}
+
+// A replayer serves the responses in a recording.
+type replayer struct {
+	n     int  // number of exchanges
+	loose bool // answer unrecorded requests by method
+
+	mu       sync.Mutex
+	byParams map[string]*queue // by method and canonical params
+	byMethod map[string]*queue
+}
+
+// A queue holds the recorded exchanges for some requests, in order.
+type queue struct {
+	x    []benchserve.Exchange
+	next int
+}
+
+// pop returns the next exchange in q, or the last once all have been returned.
+func (q *queue) pop() benchserve.Exchange {
+	x := q.x[q.next]
+	if q.next < len(q.x)-1 {
+		q.next++
+	}
+	return x
+}
+
+// load reads the recording in file.
+func load(file string) (*replayer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := &replayer{byParams: make(map[string]*queue), byMethod: make(map[string]*queue)}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var x benchserve.Exchange
+		if err := dec.Decode(&x); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		r.add(r.byParams, key(x.Method, x.Params), x)
+		r.add(r.byMethod, x.Method, x)
+		r.n++
+	}
+	return r, nil
+}
+
+func (r *replayer) add(m map[string]*queue, k string, x benchserve.Exchange) {
+	q := m[k]
+	if q == nil {
+		q = new(queue)
+		m[k] = q
+	}
+	q.x = append(q.x, x)
+}
+
+// key returns the key of a request for method with params,
+// which are equal if their JSON values are, regardless of formatting,
+// the order of object keys, and fields with zero values,
+// which clients of the JSON-lines protocol may omit
+// but the server records.
+func key(method string, params json.RawMessage) string {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.UseNumber()
+	if dec.Decode(&v) == nil {
+		params, _ = json.Marshal(prune(v))
+	}
+	if string(params) == "null" {
+		params = nil
+	}
+	return method + " " + string(params)
+}
+
+// prune returns v without the object fields whose values are zero:
+// false, 0, "", null, or empty arrays or objects. It returns nil if v
+// itself is zero.
+func prune(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if x = prune(x); x == nil {
+				delete(v, k)
+			} else {
+				v[k] = x
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		for i, x := range v {
+			v[i] = prune(x)
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+// lookup returns the recorded exchange with which to answer
+// a request for method with params.
+func (r *replayer) lookup(method string, params json.RawMessage) (benchserve.Exchange, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if q := r.byParams[key(method, params)]; q != nil {
+		return q.pop(), true
+	}
+	if q := r.byMethod[method]; q != nil && r.loose {
+		return q.pop(), true
+	}
+	return benchserve.Exchange{}, false
+}
+
+// request is a request in either JSON-RPC or the JSON-lines protocol.
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// serve answers the requests on conn until the client disconnects.
+func (r *replayer) serve(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		// JSON-RPC wraps the argument in an array.
+		params := req.Params
+		rpc := bytes.HasPrefix(bytes.TrimSpace(params), []byte("["))
+		if rpc {
+			var args []json.RawMessage
+			if json.Unmarshal(params, &args) == nil && len(args) == 1 {
+				params = args[0]
+			}
+		}
+		method := req.Method
+		if !strings.HasPrefix(method, "Server.") {
+			method = "Server." + method
+		}
+
+		x, ok := r.lookup(method, params)
+		if !ok {
+			x.Error = &benchserve.Error{Code: benchserve.ErrFailed, Message: fmt.Sprintf("benchreplay: no recorded response to %s with params %s", method, params)}
+		}
+		var err error
+		if rpc {
+			resp := struct {
+				ID     json.RawMessage `json:"id"`
+				Result interface{}     `json:"result"`
+				Error  interface{}     `json:"error"`
+			}{ID: req.ID}
+			if x.Error != nil {
+				resp.Error = x.Error.Message
+			} else {
+				resp.Result = x.Result
+			}
+			err = enc.Encode(resp)
+		} else {
+			resp := benchserve.LineResponse{ID: req.ID, Error: x.Error}
+			if x.Error == nil {
+				resp.Result = x.Result
+			}
+			err = enc.Encode(resp)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package demo
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/josharian/benchserve"
+)
+
+func TestMain(m *testing.M) {
+	benchserve.Tag("BenchmarkFast", "quick")
+	benchserve.Tag("BenchmarkSlow", "slow")
+	benchserve.RegisterUnit("items/op", benchserve.HigherIsBetter)
+	benchserve.RegisterFixture("corpus", setupCorpus, func() { corpus = nil })
+	benchserve.Main(m)
+}
+
+var (
+	sink   []byte
+	total  uint64
+	corpus [][]byte
+)
+
+func setupCorpus() error {
+	for i := 0; i < 1000; i++ {
+		corpus = append(corpus, []byte(strconv.Itoa(i)))
+	}
+	return nil
+}
+
+func BenchmarkFast(b *testing.B) {
+	var x uint64
+	for i := 0; i < b.N; i++ {
+		x += uint64(i)
+	}
+	atomic.AddUint64(&total, x)
+}
+
+func BenchmarkSlow(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func BenchmarkAlloc(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(256)
+	for i := 0; i < b.N; i++ {
+		sink = make([]byte, 256)
+	}
+	b.ReportMetric(4, "items/op")
+}
+
+func BenchmarkParallel(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		var sum [sha256.Size]byte
+		for pb.Next() {
+			sum = sha256.Sum256(sum[:])
+		}
+	})
+}
+
+func BenchmarkParam(b *testing.B) {
+	size, err := strconv.Atoi(benchserve.Param(b, "size"))
+	if err != nil {
+		size = 1024
+	}
+	buf := make([]byte, size)
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sha256.Sum256(buf)
+	}
+}
+
+func BenchmarkFixture(b *testing.B) {
+	if corpus == nil {
+		b.Skip("requires the corpus fixture")
+	}
+	for i := 0; i < b.N; i++ {
+		sha256.Sum256(corpus[i%len(corpus)])
+	}
+}
+
+func BenchmarkFails(b *testing.B) {
+	b.Fatal("demo failure")
+}
+
+func BenchmarkSkips(b *testing.B) {
+	b.Skip("demo skip")
+}
+
+func BenchmarkSub(b *testing.B) {
+	for _, size := range []int{16, 4096} {
+		b.Run("size="+strconv.Itoa(size), func(b *testing.B) {
+			buf := make([]byte, size)
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				sha256.Sum256(buf)
+			}
+		})
+	}
+	b.Run("nested", func(b *testing.B) {
+		b.Run("leaf", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sink = sink[:0]
+			}
+		})
+	})
+}
+
+func TestPasses(t *testing.T) {}
+
+func TestSkips(t *testing.T) {
+	t.Skip("demo skip")
+}
@@ -0,0 +1,25 @@
+// Package demo is a test binary of example benchmarks, compiled with
+// benchserve enabled, for exercising benchmark drivers and clients
+// of the protocol without building a package of their own.
+//
+// To build and start it:
+//
+//	go test -c -o benchserve-demo.test ./cmd/benchserve-demo
+//	./benchserve-demo.test -test.benchserve
+//
+// Its benchmarks cover the cases a driver must handle:
+//
+//	BenchmarkFast      a few nanoseconds per iteration
+//	BenchmarkSlow      a millisecond per iteration
+//	BenchmarkAlloc     allocating, with a custom metric and SetBytes
+//	BenchmarkParallel  using b.RunParallel
+//	BenchmarkParam     reading the "size" parameter, from Run.Params
+//	BenchmarkFixture   requiring the "corpus" fixture, from Run.Fixtures
+//	BenchmarkFails     failing, with b.Fatal
+//	BenchmarkSkips     skipping itself, with b.Skip
+//	BenchmarkSub       with sub-benchmarks, which the server declines to run
+//
+// BenchmarkFast is tagged "quick" and BenchmarkSlow "slow".
+// For RunTest, the binary also has a passing and a skipped test,
+// so that its tests pass under go test.
+package demo
@@ -0,0 +1,137 @@
+package benchserve
+
+import (
+	"fmt"
+	"math"
+)
+
+// Compare requests a statistical comparison of two benchmark configurations,
+// such as two benchmarks, or one benchmark in two test binaries.
+type Compare struct {
+	Old, New Run // the runs to compare; each sample runs N iterations
+	Count    int // number of samples of each, default 10
+
+	// OldBinary, if set, takes the Old samples from the history store:
+	// the most recent Count successful runs of Old's benchmark and procs
+	// by the test binary with this hash, as reported by History.
+	// Otherwise, samples of Old and New are taken alternately,
+	// so that drift in the machine's speed affects both alike.
+	OldBinary string
+
+	Alpha float64 // significance level, default 0.05
+}
+
+// Comparison is the result of a Compare request.
+// Its semantics mirror those of benchstat.
+type Comparison struct {
+	Old, New []float64 // ns/op of each sample
+
+	OldMedian, NewMedian float64 // median ns/op
+
+	// The Outliers, All, and Inliers of Old and New are as in SampleResult,
+	// with OldOutliers indexing Old and NewOutliers indexing New.
+	// UTest, TTest, and EffectSize use all the samples.
+	OldOutliers, NewOutliers []int `json:",omitempty"`
+	OldAll, NewAll           SampleStats
+	OldInliers, NewInliers   SampleStats
+
+	// Delta is the relative change of the median, (NewMedian-OldMedian)/OldMedian.
+	// A negative Delta means New is faster.
+	Delta float64
+
+	UTest float64 // two-sided p-value of the Mann-Whitney U test
+	TTest float64 // two-sided p-value of Welch's t-test
+
+	// EffectSize is Cohen's d: the difference of the means
+	// in units of the pooled standard deviation.
+	EffectSize float64
+
+	// Significant reports whether UTest is below Alpha.
+	// As in benchstat, differences that are not significant
+	// should be reported as no change ("~").
+	Significant bool
+}
+
+// Compare samples two benchmark configurations
+// and tests whether their ns/op differ.
+func (s *Server) Compare(args Compare, reply *Comparison) error {
+	count := args.Count
+	if count <= 0 {
+		count = 10
+	}
+	alpha := args.Alpha
+	if alpha <= 0 {
+		alpha = 0.05
+	}
+
+	if args.OldBinary != "" {
+		if s.history == nil {
+			return fmt.Errorf("OldBinary requires the history store; set -test.benchserve.history")
+		}
+		var old []float64
+		err := s.history.scan(func(rec Record) {
+			if rec.Binary == args.OldBinary && rec.Error == "" &&
+				rec.Run.Name == args.Old.Name && rec.Run.Procs == args.Old.Procs {
+				old = append(old, nsPerOp(rec.Result))
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if len(old) < 2 {
+			return fmt.Errorf("history has %d runs of %s by binary %s; need at least 2", len(old), args.Old.Name, args.OldBinary)
+		}
+		if len(old) > count {
+			old = old[len(old)-count:]
+		}
+		reply.Old = old
+	}
+
+	for i := 0; i < count; i++ {
+		if args.OldBinary == "" {
+			r, err := s.run(args.Old)
+			if err != nil {
+				return err
+			}
+			reply.Old = append(reply.Old, nsPerOp(r))
+		}
+		r, err := s.run(args.New)
+		if err != nil {
+			return err
+		}
+		reply.New = append(reply.New, nsPerOp(r))
+	}
+
+	reply.analyze(alpha)
+	return nil
+}
+
+// analyze fills in c's statistics from its Old and New samples.
+func (c *Comparison) analyze(alpha float64) {
+	c.OldOutliers, c.OldAll, c.OldInliers = tukey(c.Old)
+	c.NewOutliers, c.NewAll, c.NewInliers = tukey(c.New)
+	c.OldMedian, c.NewMedian = c.OldAll.Median, c.NewAll.Median
+	if c.OldMedian > 0 {
+		c.Delta = (c.NewMedian - c.OldMedian) / c.OldMedian
+	}
+	c.UTest = mannWhitneyU(c.Old, c.New)
+	c.TTest = welchTTest(c.Old, c.New)
+	c.EffectSize = cohensD(c.Old, c.New)
+	c.Significant = c.UTest < alpha
+}
+
+// cohensD returns the difference of the means of y and x
+// in units of their pooled standard deviation.
+func cohensD(x, y []float64) float64 {
+	nx, ny := float64(len(x)), float64(len(y))
+	if nx < 2 || ny < 2 {
+		return 0
+	}
+	mx, sx := meanStddev(x)
+	my, sy := meanStddev(y)
+	pooled := math.Sqrt(((nx-1)*sx*sx + (ny-1)*sy*sy) / (nx + ny - 2))
+	if pooled == 0 {
+		return 0
+	}
+	return (my - mx) / pooled
+}
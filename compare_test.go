@@ -0,0 +1,58 @@
+package benchserve
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCohensD(t *testing.T) {
+	for _, tt := range []struct {
+		x, y []float64
+		want float64
+	}{
+		{[]float64{1, 2, 3}, []float64{3, 4, 5}, 2},
+		{[]float64{3, 4, 5}, []float64{1, 2, 3}, -2},
+		// Pooled variance (2 + 8) / 4, from sums of squares 2 and 8.
+		{[]float64{1, 2, 3, 2}, []float64{2, 6}, 2 / math.Sqrt(2.5)},
+		{[]float64{2, 2}, []float64{3, 3}, 0},
+		{[]float64{1}, []float64{3, 4}, 0},
+	} {
+		if d := cohensD(tt.x, tt.y); !near(d, tt.want, 1e-12) {
+			t.Errorf("cohensD(%v, %v) = %v, want %v", tt.x, tt.y, d, tt.want)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	c := Comparison{Old: []float64{10, 11, 12}, New: []float64{20, 21, 22}}
+	c.analyze(0.05)
+	if c.OldMedian != 11 || c.NewMedian != 21 || !near(c.Delta, 10.0/11, 1e-12) {
+		t.Errorf("medians %v, %v, delta %v; want 11, 21, %v", c.OldMedian, c.NewMedian, c.Delta, 10.0/11)
+	}
+	// The smallest p-value of the exact test with 3 samples each is 0.1.
+	if c.UTest != 0.1 || c.Significant {
+		t.Errorf("UTest = %v, Significant = %v; want 0.1, false", c.UTest, c.Significant)
+	}
+	if c.Old[0] != 10 || c.Old[2] != 12 {
+		t.Errorf("analyze reordered Old: %v", c.Old)
+	}
+	c.analyze(0.2)
+	if !c.Significant {
+		t.Errorf("UTest %v at alpha 0.2: not Significant", c.UTest)
+	}
+}
+
+func TestAnalyzeOutliers(t *testing.T) {
+	c := Comparison{Old: []float64{10, 11, 50, 12}, New: []float64{20, 21, 22}}
+	c.analyze(0.05)
+	if !reflect.DeepEqual(c.OldOutliers, []int{2}) || c.NewOutliers != nil {
+		t.Errorf("OldOutliers %v, NewOutliers %v; want [2], []", c.OldOutliers, c.NewOutliers)
+	}
+	if c.OldAll.N != 4 || c.OldInliers.N != 3 || c.OldInliers.Max != 12 || c.NewAll != c.NewInliers {
+		t.Errorf("OldAll %+v, OldInliers %+v, NewAll %+v, NewInliers %+v", c.OldAll, c.OldInliers, c.NewAll, c.NewInliers)
+	}
+	if c.OldMedian != 11.5 {
+		t.Errorf("OldMedian = %v, want 11.5, of all samples", c.OldMedian)
+	}
+}
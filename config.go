@@ -0,0 +1,72 @@
+package benchserve
+
+import (
+	"context"
+	"runtime/metrics"
+	"time"
+)
+
+// Config is the configuration with which a run was performed,
+// with every default resolved, so that results can be interpreted
+// without knowing the defaults of the server that produced them.
+type Config struct {
+	// N, Procs, MinTime, Batches, and Isolate are as in the Run.
+	// Procs is the GOMAXPROCS value in effect during the run.
+	N       int
+	Procs   int
+	MinTime time.Duration `json:",omitempty"`
+	Batches int           `json:",omitempty"`
+	Isolate bool          `json:",omitempty"`
+
+	// Parallelism is the b.SetParallelism multiplier in effect
+	// when the benchmark returned: b.RunParallel starts
+	// Parallelism*Procs goroutines. It is Run.Parallelism, or 1 by default,
+	// unless the benchmark changed it.
+	Parallelism int
+
+	// Warmup is the number of unmeasured iterations run before N.
+	// The server performs none: it collects garbage before each run instead.
+	Warmup int
+
+	// GOGC is the garbage collector's target percentage as the run began,
+	// or -1 if collection was off, and MemoryLimit the soft memory limit
+	// in bytes, math.MaxInt64 if there was none.
+	// GODEBUG is the value of the GODEBUG environment variable.
+	GOGC        int
+	MemoryLimit int64
+	GODEBUG     string `json:",omitempty"`
+
+	// Options, Env, and Dir are the Options, environment changes,
+	// and working directory of the session that requested the run.
+	// Env's null values unset the variable.
+	Options Options
+	Env     map[string]*string `json:",omitempty"`
+	Dir     string             `json:",omitempty"`
+}
+
+// gcSettings returns the garbage collector's current GOGC percentage
+// and memory limit, without changing them.
+func gcSettings() (gogc int, limit int64) {
+	samples := []metrics.Sample{{Name: "/gc/gogc:percent"}, {Name: "/gc/gomemlimit:bytes"}}
+	metrics.Read(samples)
+	// The runtime reports -1, for off, as a uint64.
+	gogc = int(int64(samples[0].Value.Uint64()))
+	limit = int64(samples[1].Value.Uint64())
+	return gogc, limit
+}
+
+// sessionKey is the context key under which acquire stores
+// the session settings applied for a run.
+type sessionKey struct{}
+
+// appliedSession returns the session settings that acquire applied
+// for the run using ctx.
+func appliedSession(ctx context.Context) session {
+	sess, _ := ctx.Value(sessionKey{}).(session)
+	return sess
+}
+
+// setSession sets c's Options, Env, and Dir from sess.
+func (c *Config) setSession(sess session) {
+	c.Options, c.Env, c.Dir = sess.opt, sess.env, sess.dir
+}
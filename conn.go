@@ -0,0 +1,76 @@
+package benchserve
+
+import (
+	"bufio"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+)
+
+// newServerCodec returns the codec with which to serve conn, read through r,
+// in proto, which is JSON-RPC or MessagePack-RPC,
+// recording requests in audit and limiting their rate with limiter, if any.
+func newServerCodec(conn net.Conn, r *bufio.Reader, proto protocol, audit *auditLog, limiter *rateLimiter) rpc.ServerCodec {
+	addr := conn.RemoteAddr().String()
+	var c rpc.ServerCodec
+	if proto == protoMsgpack {
+		c = newMsgpackCodec(r, conn)
+	} else {
+		c = jsonrpc.NewServerCodec(bufferedConn{r, conn})
+	}
+	c = newRequestCodec(limit(c, addr, limiter), addr, audit)
+	if *benchServeIdleTimeout <= 0 {
+		return c
+	}
+	return &idleCodec{ServerCodec: c, conn: conn, timeout: *benchServeIdleTimeout}
+}
+
+// A bufferedConn is a net.Conn read through a bufio.Reader.
+type bufferedConn struct {
+	r *bufio.Reader
+	net.Conn
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// An idleCodec drops connections that are idle for longer than timeout.
+// A connection is idle when it has no calls in progress,
+// so that clients may wait silently for long benchmark runs.
+// Writes also time out, to shed clients that stop reading.
+type idleCodec struct {
+	rpc.ServerCodec
+	conn    net.Conn
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending int // calls read but not yet responded to
+}
+
+func (c *idleCodec) ReadRequestHeader(r *rpc.Request) error {
+	err := c.ServerCodec.ReadRequestHeader(r)
+	if err == nil {
+		c.mu.Lock()
+		c.pending++
+		c.conn.SetReadDeadline(time.Time{})
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *idleCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	err := c.ServerCodec.WriteResponse(r, body)
+	c.mu.Lock()
+	if c.pending > 0 {
+		c.pending--
+	}
+	if c.pending == 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	c.mu.Unlock()
+	return err
+}
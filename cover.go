@@ -0,0 +1,59 @@
+package benchserve
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// RunCover requests a test run that collects a coverage profile.
+type RunCover struct {
+	// Pattern selects the tests to run, with the same semantics as -test.run.
+	// The empty pattern runs all tests.
+	Pattern string
+
+	Timeout time.Duration // equivalent to -test.timeout; zero means no timeout
+}
+
+// CoverResult is the result of a RunCover request.
+type CoverResult struct {
+	TestResult
+
+	// Profile is the coverage profile written by the tests,
+	// in the format written by -test.coverprofile and read by 'go tool cover'.
+	// It is empty if the test process exited without writing a profile.
+	Profile []byte
+}
+
+// RunCover runs tests in a new copy of the test binary
+// and returns the resulting coverage profile.
+// The binary must have been built with coverage instrumentation,
+// as by 'go test -c -cover'.
+// Test failures are reported in the CoverResult, not as errors.
+func (s *Server) RunCover(args RunCover, reply *CoverResult) error {
+	if testing.CoverMode() == "" {
+		return errors.New("test binary was not built with coverage instrumentation; use go test -c -cover")
+	}
+	pattern := args.Pattern
+	if pattern == "" {
+		pattern = "."
+	}
+
+	dir, err := os.MkdirTemp("", "benchserve-cover")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	profile := filepath.Join(dir, "cover.out")
+
+	reply.TestResult, err = s.runTest("coverage", pattern, args.Timeout, "-test.coverprofile="+profile)
+	if err != nil {
+		return err
+	}
+	// The profile is missing if the tests crashed before writing it.
+	// The Output should explain why.
+	reply.Profile, _ = os.ReadFile(profile)
+	return nil
+}
@@ -0,0 +1,91 @@
+package benchserve
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// daemonEnv is the environment variable through which a server
+// started by -test.benchserve.daemon learns the file descriptor
+// on which to report its Announcement to the process that started it.
+const daemonEnv = "BENCHSERVE_DAEMON_FD"
+
+// daemonize starts a copy of the server in the background,
+// detached from the terminal, and exits once the copy is listening,
+// after printing its Announcement. In the copy, it does nothing.
+func daemonize() {
+	if os.Getenv(daemonEnv) != "" {
+		return
+	}
+	if !canDaemonize {
+		fatal("-test.benchserve.daemon is not supported on this system")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		fatal("daemonize", "err", err)
+	}
+	cmd, err := selfCommand(context.Background(), os.Args[1:]...)
+	if err != nil {
+		fatal("daemonize", "err", err)
+	}
+	cmd.Env = append(os.Environ(), daemonEnv+"=3")
+	cmd.ExtraFiles = []*os.File{w} // fd 3
+	cmd.SysProcAttr = detached()
+	// Standard input and output are /dev/null; standard error, which
+	// gets panics and the like, goes to the log file if there is one.
+	if *benchServeLogfile != "" {
+		f, err := os.OpenFile(*benchServeLogfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			fatal("bad -test.benchserve.logfile", "err", err)
+		}
+		defer f.Close()
+		cmd.Stderr = f
+	}
+	if err := cmd.Start(); err != nil {
+		fatal("daemonize", "err", err)
+	}
+	w.Close()
+	buf, _ := io.ReadAll(r)
+	if len(buf) == 0 {
+		fatal("server failed to start in the background; see -test.benchserve.logfile", "pid", cmd.Process.Pid)
+	}
+	os.Stdout.Write(buf)
+	os.Exit(0)
+}
+
+// reportDaemon sends the Announcement buf to the process
+// that started this one with -test.benchserve.daemon, if any.
+func reportDaemon(buf []byte) {
+	v := os.Getenv(daemonEnv)
+	if v == "" {
+		return
+	}
+	// Keep the variable from leaking into test processes.
+	os.Unsetenv(daemonEnv)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("bad %s=%q", daemonEnv, v))
+		return
+	}
+	f := os.NewFile(uintptr(fd), "daemon")
+	f.Write(buf)
+	f.Close()
+}
+
+// writePIDFile writes the process ID to -test.benchserve.pidfile, if set.
+func writePIDFile() error {
+	if *benchServePIDFile == "" {
+		return nil
+	}
+	return os.WriteFile(*benchServePIDFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+}
+
+// removePIDFile removes the file written by writePIDFile, if any.
+func removePIDFile() {
+	if *benchServePIDFile != "" {
+		os.Remove(*benchServePIDFile)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package benchserve
+
+import "syscall"
+
+const canDaemonize = false
+
+func detached() *syscall.SysProcAttr { return nil }
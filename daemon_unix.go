@@ -0,0 +1,13 @@
+//go:build unix
+
+package benchserve
+
+import "syscall"
+
+const canDaemonize = true
+
+// detached returns the attributes of a process
+// detached from the controlling terminal.
+func detached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,89 @@
+package benchserve
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// dashboardAPI returns the handlers backing the dashboard, by method name.
+// Each accepts a POST of the method's JSON-encoded arguments
+// and responds with its JSON-encoded reply.
+// Only methods the dashboard needs are exposed.
+func (s *server) dashboardAPI() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"List":    apiHandler(s, "List", (*Server).List),
+		"Ping":    apiHandler(s, "Ping", (*Server).Ping),
+		"Submit":  apiHandler(s, "Submit", (*Server).Submit),
+		"Job":     apiHandler(s, "Job", (*Server).Job),
+		"History": apiHandler(s, "History", (*Server).History),
+	}
+}
+
+// apiHandler returns a handler calling method, named name, on behalf
+// of the HTTP client. As with requests over the protocol, the request is
+// recorded in the audit log and subject to -test.benchserve.ratelimit.
+func apiHandler[A, R any](s *server, name string, method func(*Server, A, *R) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Requiring a JSON POST keeps other web pages from
+		// using a visitor's browser to start runs.
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "want POST of application/json", http.StatusMethodNotAllowed)
+			return
+		}
+		e := AuditEntry{Time: time.Now(), Client: r.RemoteAddr, Method: "Server." + name}
+		defer func() {
+			e.Duration = time.Since(e.Time)
+			s.audit.served(e)
+		}()
+		fail := func(err error, code int) {
+			e.Error = err.Error()
+			if b, ok := IsBusy(err); ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(b.RetryAfter.Round(time.Second)/time.Second)))
+				code = http.StatusTooManyRequests
+			}
+			http.Error(w, err.Error(), code)
+		}
+		if s.limiter != nil {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			if err := s.limiter.allow(host, e.Time); err != nil {
+				fail(err, http.StatusTooManyRequests)
+				return
+			}
+		}
+		var args A
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			fail(err, http.StatusBadRequest)
+			return
+		}
+		params, _ := json.Marshal(args)
+		e.Params = auditParams(e.Method, params)
+		var reply R
+		srv := &Server{server: s, client: &client{addr: r.RemoteAddr}}
+		if err := method(srv, args, &reply); err != nil {
+			fail(err, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+// serveDashboard serves the dashboard page.
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
@@ -0,0 +1,121 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The debug endpoints are implemented here rather than by importing
+// net/http/pprof and expvar, which would register handlers on
+// http.DefaultServeMux in every test binary, where they could
+// collide with, or be used unexpectedly by, the package under test.
+
+// handleDebug adds the endpoints enabled by -test.benchserve.debug to mux.
+func (s *server) handleDebug(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/vars", s.serveVars)
+	mux.HandleFunc("/debug/pprof/", servePprof)
+	mux.HandleFunc("/debug/pprof/profile", serveCPUProfile)
+	mux.HandleFunc("/debug/pprof/trace", serveTrace)
+}
+
+// serveVars serves variables describing the server process,
+// in the format of expvar's /debug/vars.
+func (s *server) serveVars(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var stats Stats
+	(&Server{server: s}).Stats(struct{}{}, &stats)
+	vars := map[string]interface{}{
+		"cmdline":    os.Args,
+		"memstats":   mem,
+		"goroutines": runtime.NumGoroutine(),
+		"benchserve": stats,
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(vars)
+}
+
+// servePprof serves the runtime profile named by the last element
+// of the URL path, such as /debug/pprof/goroutine?debug=2,
+// or an index of profiles.
+func servePprof(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	if name == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body><p>Profiles of the benchserve process:</p><ul>\n")
+		for _, p := range pprof.Profiles() {
+			n := html.EscapeString(p.Name())
+			fmt.Fprintf(w, "<li><a href=\"%s?debug=1\">%s</a> (%d)</li>\n", n, n, p.Count())
+		}
+		fmt.Fprint(w, "<li><a href=\"profile?seconds=30\">profile</a> (CPU)</li>\n<li><a href=\"trace?seconds=1\">trace</a></li>\n</ul></body></html>\n")
+		return
+	}
+	p := pprof.Lookup(name)
+	if p == nil {
+		http.Error(w, "unknown profile "+name, http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if name == "heap" && r.FormValue("gc") != "" {
+		runtime.GC()
+	}
+	p.WriteTo(w, debug)
+}
+
+// seconds returns the duration requested by r's seconds parameter,
+// or def if there is none.
+func seconds(r *http.Request, def time.Duration) time.Duration {
+	if sec, err := strconv.ParseFloat(r.FormValue("seconds"), 64); err == nil && sec > 0 {
+		return time.Duration(sec * float64(time.Second))
+	}
+	return def
+}
+
+// serveCPUProfile serves a CPU profile of the server process,
+// taken over the requested number of seconds.
+// It fails while a run is capturing a CPU profile, and vice versa.
+func serveCPUProfile(w http.ResponseWriter, r *http.Request) {
+	d := seconds(r, 30*time.Second)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := pprof.StartCPUProfile(w); err != nil {
+		http.Error(w, "start CPU profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sleep(r, d)
+	pprof.StopCPUProfile()
+}
+
+// serveTrace serves an execution trace of the server process,
+// taken over the requested number of seconds.
+func serveTrace(w http.ResponseWriter, r *http.Request) {
+	d := seconds(r, time.Second)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := trace.Start(w); err != nil {
+		http.Error(w, "start trace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sleep(r, d)
+	trace.Stop()
+}
+
+// sleep waits for d or until the client making request r goes away.
+func sleep(r *http.Request, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,53 @@
+package benchserve
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Benchmark describes an available benchmark.
+type Benchmark struct {
+	Name    string // name of the benchmark
+	Package string // import path of the package defining the benchmark; external test packages end in _test
+	File    string // source file defining the benchmark function
+	Line    int    // line of the benchmark function in File
+
+	Tags []string `json:",omitempty"` // tags attached by Tag
+}
+
+// Describe returns descriptions of the available benchmarks
+// selected by args, sorted by name.
+func (s *Server) Describe(args List, reply *[]Benchmark) error {
+	names, err := s.selected(args)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		*reply = append(*reply, describe(s.m[name]))
+	}
+	return nil
+}
+
+// describe looks up the source location of b's function.
+func describe(b testing.InternalBenchmark) Benchmark {
+	d := Benchmark{Name: b.Name, Tags: benchmarkTags(b.Name)}
+	f := runtime.FuncForPC(reflect.ValueOf(b.F).Pointer())
+	if f == nil {
+		return d
+	}
+	d.File, d.Line = f.FileLine(f.Entry())
+	d.Package = funcPackage(f.Name())
+	return d
+}
+
+// funcPackage returns the import path portion of a qualified function name,
+// such as "github.com/x/y" for "github.com/x/y.BenchmarkZ".
+func funcPackage(name string) string {
+	slash := strings.LastIndex(name, "/") + 1
+	if dot := strings.Index(name[slash:], "."); dot >= 0 {
+		return name[:slash+dot]
+	}
+	return name
+}
@@ -0,0 +1,93 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"time"
+)
+
+// announceGroup is the UDP multicast group on which servers announce
+// themselves. It is in the organization-local scope, which routers
+// do not forward beyond the local site.
+var announceGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 52, 52), Port: 52525}
+
+// announceInterval is how often servers repeat their announcements.
+const announceInterval = 5 * time.Second
+
+// multicast announces a on the local network every announceInterval, forever.
+func multicast(a Announcement) {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		logger.Warn("announce", "err", err)
+		return
+	}
+	conn, err := net.DialUDP("udp4", nil, announceGroup)
+	if err != nil {
+		logger.Warn("announce", "err", err)
+		return
+	}
+	defer conn.Close()
+	for {
+		// Failures here are usually transient, such as the network being down.
+		// Keep trying rather than flooding the log.
+		conn.Write(buf)
+		time.Sleep(announceInterval)
+	}
+}
+
+// Discover listens for servers announcing themselves
+// on the local network with -test.benchserve.announce,
+// and returns those heard from within timeout, sorted by name and address.
+// To hear from every server, timeout should be at least 5s,
+// the interval at which servers repeat their announcements.
+//
+// A server listening on all interfaces announces an unspecified address,
+// such as [::]:52525. Discover replaces the host with the address
+// the announcement came from.
+func Discover(timeout time.Duration) ([]Announcement, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, announceGroup)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	type key struct {
+		addr string
+		pid  int
+	}
+	seen := make(map[key]Announcement)
+	buf := make([]byte, 64<<10)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		var a Announcement
+		if json.Unmarshal(buf[:n], &a) != nil {
+			continue
+		}
+		if host, port, err := net.SplitHostPort(a.Addr); err == nil {
+			if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+				a.Addr = net.JoinHostPort(from.IP.String(), port)
+			}
+		}
+		seen[key{a.Addr, a.PID}] = a
+	}
+
+	list := make([]Announcement, 0, len(seen))
+	for _, a := range seen {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Addr < list[j].Addr
+	})
+	return list, nil
+}
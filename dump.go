@@ -0,0 +1,167 @@
+package benchserve
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// maxCompleted is the number of completed runs the server keeps for Export.
+// Older runs are dropped; use -test.benchserve.history to keep them all.
+const maxCompleted = 100000
+
+// Export requests the server's results in a file format,
+// such as CSV for a spreadsheet.
+type Export struct {
+	// Format is "csv" (the default), "json" (one Record per line,
+	// as in -test.benchserve.log), or "benchfmt".
+	// Failed runs are omitted from benchfmt, which cannot represent them.
+	Format string
+
+	// History exports runs from the history store, selected by Filter,
+	// rather than the runs completed since the server started.
+	History bool
+
+	// Filter selects the runs to export, as for Server.History.
+	Filter History
+}
+
+// ExportResult is an exported file.
+type ExportResult struct {
+	ContentType string // MIME type of Data
+	Data        string
+	Records     int // number of runs exported
+}
+
+// Export dumps results in the requested format: those of the runs
+// completed since the server started, up to maxCompleted of them,
+// or those in the history store.
+//
+// In CSV, each row is a run. Labels, parameters, and custom metrics
+// have a column each, named label.KEY, param.KEY, and the metric's unit.
+// -test.benchserve.http serves the same files at /export.
+func (s *Server) Export(args Export, reply *ExportResult) error {
+	var recs []Record
+	if args.History {
+		var h HistoryResult
+		if err := s.History(args.Filter, &h); err != nil {
+			return err
+		}
+		recs = h.Records
+	} else {
+		m, err := newMatcher(args.Filter.Pattern)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		for _, rec := range s.completed {
+			if args.Filter.matches(m, rec) {
+				recs = append(recs, rec)
+			}
+		}
+		s.mu.Unlock()
+		if n := args.Filter.Limit; n > 0 && len(recs) > n {
+			recs = recs[len(recs)-n:]
+		}
+	}
+
+	var buf bytes.Buffer
+	switch args.Format {
+	case "", "csv":
+		reply.ContentType = "text/csv"
+		if err := writeCSV(&buf, recs); err != nil {
+			return err
+		}
+	case "json":
+		reply.ContentType = "application/x-ndjson"
+		enc := json.NewEncoder(&buf)
+		for _, rec := range recs {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+	case "benchfmt":
+		reply.ContentType = "text/plain"
+		writeBenchfmt(&buf, recs)
+	default:
+		return fmt.Errorf("unknown export format %q, want csv, json, or benchfmt", args.Format)
+	}
+	reply.Data = buf.String()
+	reply.Records = len(recs)
+	return nil
+}
+
+// writeCSV writes recs to buf as CSV, with a header row.
+func writeCSV(buf *bytes.Buffer, recs []Record) error {
+	labels := make(map[string]bool)
+	params := make(map[string]bool)
+	units := make(map[string]bool)
+	for _, rec := range recs {
+		for k := range rec.Run.Labels {
+			labels[k] = true
+		}
+		for k := range rec.Run.Params {
+			params[k] = true
+		}
+		for u := range rec.Result.Extra {
+			units[u] = true
+		}
+	}
+	header := []string{"time", "binary", "benchmark", "procs", "n", "ns/op", "B/op", "allocs/op", "MB/s", "error"}
+	for _, k := range sortedKeys(labels) {
+		header = append(header, "label."+k)
+	}
+	for _, k := range sortedKeys(params) {
+		header = append(header, "param."+k)
+	}
+	header = append(header, sortedKeys(units)...)
+
+	w := csv.NewWriter(buf)
+	w.Write(header)
+	float := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	for _, rec := range recs {
+		r := rec.Result
+		r.perOp()
+		row := []string{
+			rec.Time.Format(time.RFC3339Nano), rec.Binary, rec.Run.Name,
+			strconv.Itoa(rec.Run.Procs), strconv.Itoa(r.N),
+			float(r.NsPerOp), float(r.AllocedBytesPerOp), float(r.AllocsPerOp), float(r.MBPerSec),
+			rec.Error,
+		}
+		for _, k := range sortedKeys(labels) {
+			row = append(row, rec.Run.Labels[k])
+		}
+		for _, k := range sortedKeys(params) {
+			row = append(row, rec.Run.Params[k])
+		}
+		for _, u := range sortedKeys(units) {
+			v, ok := r.Extra[u]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, float(v))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeBenchfmt writes the successful runs in recs to buf in
+// the Go benchmark format, with configuration lines for their labels.
+func writeBenchfmt(buf *bytes.Buffer, recs []Record) {
+	benchfmtHeader(buf)
+	var labels map[string]string
+	for _, rec := range recs {
+		if rec.Error != "" {
+			continue
+		}
+		benchfmtLabels(buf, labels, rec.Run.Labels)
+		labels = rec.Run.Labels
+		buf.Write(benchfmtLine(rec.Run, rec.Result))
+	}
+}
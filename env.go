@@ -0,0 +1,114 @@
+package benchserve
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Setenv requests setting an environment variable.
+type Setenv struct {
+	Key, Value string
+}
+
+// Unsetenv requests unsetting an environment variable.
+type Unsetenv struct {
+	Key string
+}
+
+// startDir is the server's working directory when it started,
+// to which sessions' relative directories are relative.
+// Runs that Chdir change the process's working directory
+// while they last, so it is never consulted afterwards.
+var startDir string
+
+func init() {
+	startDir, _ = os.Getwd()
+}
+
+// Chdir requests changing the working directory.
+type Chdir struct {
+	Dir string
+}
+
+// Setenv sets an environment variable for the session's subsequent runs,
+// including tests run in new processes. Other sessions do not see it.
+// Use Restore to undo changes.
+func (s *Server) Setenv(args Setenv, reply *struct{}) error {
+	if err := checkReadOnly("Setenv"); err != nil {
+		return err
+	}
+	if args.Key == "" {
+		return errors.New("empty environment variable name")
+	}
+	s.setEnv(args.Key, &args.Value)
+	return nil
+}
+
+// Unsetenv unsets an environment variable for the session's subsequent runs.
+// Use Restore to undo changes.
+func (s *Server) Unsetenv(args Unsetenv, reply *struct{}) error {
+	if err := checkReadOnly("Unsetenv"); err != nil {
+		return err
+	}
+	s.setEnv(args.Key, nil)
+	return nil
+}
+
+// setEnv records a change to the environment variable key in the session:
+// setting it to *v, or unsetting it if v is nil.
+func (s *Server) setEnv(key string, v *string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sess()
+	if sess.env == nil {
+		sess.env = make(map[string]*string)
+	}
+	sess.env[key] = v
+}
+
+// Chdir changes the working directory for the session's subsequent runs,
+// for example so that benchmarks can find their testdata.
+// Relative directories are relative to the session's working directory,
+// or, if it has none, to the directory in which the server started.
+// Use Restore to undo changes.
+func (s *Server) Chdir(args Chdir, reply *struct{}) error {
+	if err := checkReadOnly("Chdir"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sess()
+	dir := args.Dir
+	if !filepath.IsAbs(dir) {
+		base := sess.dir
+		if base == "" {
+			base = startDir
+		}
+		if base == "" {
+			return errors.New("server's working directory is unknown; use an absolute directory")
+		}
+		dir = filepath.Join(base, dir)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	sess.dir = dir
+	return nil
+}
+
+// Restore undoes the session's changes to environment variables
+// made by Setenv and Unsetenv and to the working directory made by Chdir.
+func (s *Server) Restore(args struct{}, reply *struct{}) error {
+	if err := checkReadOnly("Restore"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sess()
+	sess.env, sess.dir = nil, ""
+	return nil
+}
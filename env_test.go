@@ -0,0 +1,52 @@
+package benchserve
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Relative directories do not depend on the process's working directory,
+// which another session's run may have changed.
+func TestChdirRelative(t *testing.T) {
+	defer func(dir string) { startDir = dir }(startDir)
+	root := t.TempDir()
+	startDir = root
+	for _, d := range []string{"a", "b", "a/c"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	srv := &server{}
+	a := &Server{server: srv}
+	if err := a.Chdir(Chdir{Dir: "a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, undo, err := a.applySession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Server{server: srv}
+	if err := b.Chdir(Chdir{Dir: "b"}, nil); err != nil {
+		t.Errorf("Chdir(b) during another session's run: %v", err)
+	} else if got, want := b.sess().dir, filepath.Join(root, "b"); got != want {
+		t.Errorf("Chdir(b) during another session's run: dir %s, want %s", got, want)
+	}
+	if err := a.Chdir(Chdir{Dir: "c"}, nil); err != nil {
+		t.Fatal(err)
+	} else if got, want := a.sess().dir, filepath.Join(root, "a/c"); got != want {
+		t.Errorf("Chdir(c) after Chdir(a): dir %s, want %s", got, want)
+	}
+
+	undo()
+	if now, _ := os.Getwd(); now != root {
+		t.Errorf("after undo, working directory is %s, want %s", now, root)
+	}
+}
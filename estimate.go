@@ -0,0 +1,68 @@
+package benchserve
+
+import "time"
+
+// Estimate requests a quick estimate of the cost of some benchmarks.
+type Estimate struct {
+	Pattern string // benchmarks to estimate, with the same semantics as -test.bench
+	Procs   int    // GOMAXPROCS value, equivalent to -test.cpu
+
+	// Time is how long to spend on each benchmark, default 5ms.
+	// A benchmark's single iteration may take longer.
+	Time time.Duration
+}
+
+// Cost is the estimated cost of a benchmark.
+type Cost struct {
+	Name    string
+	N       int     // number of iterations of the final estimation run
+	NsPerOp float64 // rough ns/op
+	Err     string  // non-empty if the benchmark could not be run
+}
+
+// Estimate runs each requested benchmark briefly, starting with
+// a single iteration, and returns its rough ns/op, sorted by name.
+// It is intended for planning time budgets, not for measurement.
+func (s *Server) Estimate(args Estimate, reply *[]Cost) error {
+	d := args.Time
+	if d <= 0 {
+		d = 5 * time.Millisecond
+	}
+	names, err := s.names(args.Pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		c := s.estimate(name, args.Procs, d)
+		*reply = append(*reply, c)
+		if c.Err == errCanceled.Error() {
+			return errCanceled
+		}
+	}
+	return nil
+}
+
+// estimate grows N until a run of the named benchmark takes at least d.
+func (s *Server) estimate(name string, procs int, d time.Duration) Cost {
+	c := Cost{Name: name}
+	for n := 1; ; {
+		r, err := s.run(Run{Name: name, Procs: procs, N: n})
+		if err != nil {
+			c.Err = err.Error()
+			return c
+		}
+		c.N, c.NsPerOp = n, nsPerOp(r)
+		if r.T >= d || n >= 1e9 {
+			return c
+		}
+		// Aim 20% past d, growing by at least 2x and at most 100x.
+		next := int(1.2 * float64(d) / (c.NsPerOp + 1))
+		if next < 2*n {
+			next = 2 * n
+		}
+		if next > 100*n {
+			next = 100 * n
+		}
+		n = next
+	}
+}
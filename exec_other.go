@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package benchserve
+
+import (
+	"errors"
+	"net"
+)
+
+const canExec = false
+
+func execServer(path string, l *net.TCPListener, env []string) error {
+	return errors.New("not supported")
+}
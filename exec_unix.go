@@ -0,0 +1,32 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package benchserve
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+const canExec = true
+
+// execServer replaces the process with the binary at path,
+// passing it l and the process's arguments.
+// It only returns on failure.
+func execServer(path string, l *net.TCPListener, env []string) error {
+	f, err := l.File()
+	if err != nil {
+		return err
+	}
+	// The descriptor returned by File is closed on exec; keep it open.
+	fd := f.Fd()
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); errno != 0 {
+		f.Close()
+		return errno
+	}
+	env = append(env, fmt.Sprintf("%s=%d", listenerEnv, fd))
+	err = syscall.Exec(path, os.Args, env)
+	f.Close()
+	return err
+}
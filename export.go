@@ -0,0 +1,272 @@
+package benchserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An exporter sends completed runs to an external system.
+type exporter interface {
+	export(rec Record, labels map[string]string) error
+}
+
+// exporterKinds maps -test.benchserve.export kinds to constructors.
+var exporterKinds = map[string]func(url string) exporter{
+	"influx": func(url string) exporter { return &influxExporter{url: url} },
+	"otlp":   func(url string) exporter { return &otlpExporter{url: url} },
+}
+
+// listFlag is a flag.Value accumulating repeated flags.
+type listFlag []string
+
+func (f *listFlag) String() string     { return strings.Join(*f, ",") }
+func (f *listFlag) Set(s string) error { *f = append(*f, s); return nil }
+
+func init() {
+	flag.Var(&benchServeExport, "test.benchserve.export", "push completed runs to `kind=URL`, where kind is influx or otlp; may be repeated")
+}
+
+// exportQueue is the number of records buffered per exporter.
+// Records are dropped when an exporter falls further behind.
+const exportQueue = 1000
+
+// startExporters starts the exporters configured by -test.benchserve.export.
+// It returns a function that queues a record for all of them.
+func startExporters() (func(Record), error) {
+	if len(benchServeExport) == 0 {
+		return nil, nil
+	}
+	labels, err := exportLabels()
+	if err != nil {
+		return nil, err
+	}
+	var queues []chan Record
+	for _, spec := range benchServeExport {
+		kind, url, ok := strings.Cut(spec, "=")
+		newExporter := exporterKinds[kind]
+		if !ok || newExporter == nil {
+			return nil, fmt.Errorf("bad -test.benchserve.export %q, want influx=URL or otlp=URL", spec)
+		}
+		e := newExporter(url)
+		q := make(chan Record, exportQueue)
+		queues = append(queues, q)
+		go func(spec string) {
+			for rec := range q {
+				if err := e.export(rec, labels); err != nil {
+					logger.Warn("export", "to", spec, "err", err)
+				}
+			}
+		}(spec)
+	}
+	return func(rec Record) {
+		for i, q := range queues {
+			select {
+			case q <- rec:
+			default:
+				logger.Warn("export queue full, dropping run", "to", benchServeExport[i], "benchmark", rec.Run.Name)
+			}
+		}
+	}, nil
+}
+
+// exportLabels returns the labels attached to all exported results:
+// the host name, the virtualization, if any,
+// and those set by -test.benchserve.labels.
+func exportLabels() (map[string]string, error) {
+	labels := make(map[string]string)
+	if host, err := os.Hostname(); err == nil {
+		labels["host"] = host
+	}
+	if v := virtualization(); v != "" {
+		labels["virtualization"] = v
+	}
+	if *benchServeLabels == "" {
+		return labels, nil
+	}
+	for _, kv := range strings.Split(*benchServeLabels, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("bad -test.benchserve.labels entry %q, want key=value", kv)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// post sends body to url using c, returning an error for non-2xx responses.
+func post(c *http.Client, url, contentType string, body []byte) error {
+	resp, err := c.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// recordMetrics returns the numeric values exported for rec, by name.
+func recordMetrics(rec Record) map[string]float64 {
+	r := rec.Result
+	m := map[string]float64{
+		"n":         float64(r.N),
+		"ns_per_op": nsPerOp(r),
+	}
+	if r.N > 0 {
+		m["bytes_per_op"] = float64(r.MemBytes) / float64(r.N)
+		m["allocs_per_op"] = float64(r.MemAllocs) / float64(r.N)
+	}
+	return m
+}
+
+// runTags returns the identifying tags exported for run.
+func runTags(run Run) map[string]string {
+	tags := make(map[string]string)
+	for k, v := range run.Labels {
+		tags[k] = v
+	}
+	tags["benchmark"], tags["procs"] = run.Name, strconv.Itoa(run.Procs)
+	for k, v := range run.Params {
+		tags["param."+k] = v
+	}
+	return tags
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// An influxExporter writes InfluxDB line protocol to a write endpoint,
+// such as http://localhost:8086/api/v2/write?org=o&bucket=b.
+type influxExporter struct {
+	url string
+}
+
+// influxEscaper escapes tag keys and values in line protocol.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func (e *influxExporter) export(rec Record, labels map[string]string) error {
+	tags := runTags(rec.Run)
+	for k, v := range labels {
+		// The run's own labels take precedence.
+		if _, ok := rec.Run.Labels[k]; !ok {
+			tags[k] = v
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("benchserve")
+	for _, k := range sortedKeys(tags) {
+		if tags[k] != "" {
+			fmt.Fprintf(&buf, ",%s=%s", influxEscaper.Replace(k), influxEscaper.Replace(tags[k]))
+		}
+	}
+	metrics := recordMetrics(rec)
+	for i, k := range sortedKeys(metrics) {
+		sep := ","
+		if i == 0 {
+			sep = " "
+		}
+		fmt.Fprintf(&buf, "%s%s=%g", sep, k, metrics[k])
+	}
+	fmt.Fprintf(&buf, " %d\n", rec.Time.UnixNano())
+	return post(http.DefaultClient, e.url, "text/plain; charset=utf-8", buf.Bytes())
+}
+
+// An otlpExporter sends OpenTelemetry gauges, using OTLP/HTTP with JSON
+// encoding, to a metrics endpoint such as http://localhost:4318/v1/metrics.
+type otlpExporter struct {
+	url string
+}
+
+// Minimal OTLP/HTTP JSON message types. See
+// https://github.com/open-telemetry/opentelemetry-proto.
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Gauge struct {
+		DataPoints []otlpPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+type otlpPoint struct {
+	Attributes   []otlpAttr `json:"attributes"`
+	TimeUnixNano string     `json:"timeUnixNano"`
+	AsDouble     float64    `json:"asDouble"`
+}
+
+type otlpAttr struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+// otlpAttrs converts m to OTLP attributes, sorted by key.
+func otlpAttrs(m map[string]string) []otlpAttr {
+	var a []otlpAttr
+	for _, k := range sortedKeys(m) {
+		attr := otlpAttr{Key: k}
+		attr.Value.StringValue = m[k]
+		a = append(a, attr)
+	}
+	return a
+}
+
+func (e *otlpExporter) export(rec Record, labels map[string]string) error {
+	var sm otlpScopeMetrics
+	sm.Scope.Name = "github.com/josharian/benchserve"
+	attrs := otlpAttrs(runTags(rec.Run))
+	values := recordMetrics(rec)
+	for _, k := range sortedKeys(values) {
+		m := otlpMetric{Name: "benchserve." + k}
+		m.Gauge.DataPoints = []otlpPoint{{
+			Attributes:   attrs,
+			TimeUnixNano: strconv.FormatInt(rec.Time.UnixNano(), 10),
+			AsDouble:     values[k],
+		}}
+		sm.Metrics = append(sm.Metrics, m)
+	}
+	var rm otlpResourceMetrics
+	rm.Resource.Attributes = otlpAttrs(labels)
+	rm.ScopeMetrics = []otlpScopeMetrics{sm}
+
+	buf, err := json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{rm}})
+	if err != nil {
+		return err
+	}
+	return post(http.DefaultClient, e.url, "application/json", buf)
+}
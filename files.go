@@ -0,0 +1,108 @@
+package benchserve
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PutFile requests writing a file in the server's file sandbox.
+type PutFile struct {
+	Path string // slash-separated path relative to the sandbox root
+	Data []byte // file contents
+}
+
+// GetFile requests reading a file from the server's file sandbox.
+type GetFile struct {
+	Path string // slash-separated path relative to the sandbox root
+}
+
+// File is the contents of a file.
+type File struct {
+	Data []byte
+}
+
+// PutFile writes a file in the server's file sandbox,
+// creating parent directories as needed.
+// File transfer is only available when the -test.benchserve.files flag
+// names a sandbox directory, and files are limited in size
+// by -test.benchserve.maxfile.
+func (s *Server) PutFile(args PutFile, reply *struct{}) error {
+	if err := checkReadOnly("PutFile"); err != nil {
+		return err
+	}
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	path, err := sandboxPath(args.Path)
+	if err != nil {
+		return err
+	}
+	if int64(len(args.Data)) > *benchServeMaxFile {
+		return fmt.Errorf("%s: %d bytes exceeds limit of %d", args.Path, len(args.Data), *benchServeMaxFile)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, args.Data, 0o644)
+}
+
+// GetFile reads a file from the server's file sandbox.
+// The same restrictions apply as for PutFile.
+func (s *Server) GetFile(args GetFile, reply *File) error {
+	if err := checkReadOnly("GetFile"); err != nil {
+		return err
+	}
+	path, err := sandboxPath(args.Path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() > *benchServeMaxFile {
+		return fmt.Errorf("%s: %d bytes exceeds limit of %d", args.Path, fi.Size(), *benchServeMaxFile)
+	}
+	reply.Data, err = os.ReadFile(path)
+	return err
+}
+
+// sandboxPath returns the location of the slash-separated relative path
+// within the file sandbox, rejecting paths that escape it.
+func sandboxPath(path string) (string, error) {
+	if *benchServeFiles == "" {
+		return "", errors.New("file transfer disabled; set -test.benchserve.files")
+	}
+	root, err := filepath.Abs(*benchServeFiles)
+	if err != nil {
+		return "", err
+	}
+	rel := filepath.FromSlash(path)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s: path is not local to the sandbox", path)
+	}
+	full := filepath.Join(root, rel)
+
+	// Refuse to follow symlinks out of the sandbox.
+	// Check the deepest existing ancestor of full.
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	for dir := full; ; dir = filepath.Dir(dir) {
+		r, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			if dir == root {
+				return "", err
+			}
+			continue
+		}
+		if r != real && !strings.HasPrefix(r, real+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s: path escapes the sandbox", path)
+		}
+		return full, nil
+	}
+}
@@ -0,0 +1,119 @@
+package benchserve
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A fixture is expensive shared state registered with RegisterFixture.
+type fixture struct {
+	setup    func() error
+	teardown func()
+}
+
+var fixtures struct {
+	sync.Mutex
+	m      map[string]fixture
+	active []string // set up, in setup order
+}
+
+// RegisterFixture registers a named fixture, such as a large corpus on disk
+// or a populated database, that drivers can request with Run.Fixtures.
+// The server calls setup before the first run that requests the fixture
+// and leaves it in place for later runs that request it too.
+// It calls teardown, if non-nil, before the first run that does not,
+// and when the server exits or restarts.
+// Isolated runs set up and tear down their fixtures in the child process.
+//
+// RegisterFixture should be called in TestMain, before Main or Serve.
+// It panics if name is already registered.
+func RegisterFixture(name string, setup func() error, teardown func()) {
+	fixtures.Lock()
+	defer fixtures.Unlock()
+	if _, dup := fixtures.m[name]; dup {
+		panic("benchserve: fixture " + name + " registered twice")
+	}
+	if fixtures.m == nil {
+		fixtures.m = make(map[string]fixture)
+	}
+	fixtures.m[name] = fixture{setup, teardown}
+}
+
+// ListFixtures returns the sorted names of the registered fixtures.
+func (s *Server) ListFixtures(args struct{}, names *[]string) error {
+	fixtures.Lock()
+	defer fixtures.Unlock()
+	*names = sortedKeys(fixtures.m)
+	return nil
+}
+
+// hasFixture reports whether a fixture named name is registered.
+func hasFixture(name string) bool {
+	fixtures.Lock()
+	defer fixtures.Unlock()
+	_, ok := fixtures.m[name]
+	return ok
+}
+
+// useFixtures makes exactly the named fixtures active,
+// tearing down active fixtures that are not named,
+// in the reverse of the order they were set up,
+// and then setting up named fixtures that are not active.
+// The caller must have acquired the server.
+func useFixtures(names []string) error {
+	fixtures.Lock()
+	defer fixtures.Unlock()
+	want := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := fixtures.m[name]; !ok {
+			return fmt.Errorf("fixture %s not found", name)
+		}
+		want[name] = true
+	}
+
+	for i := len(fixtures.active) - 1; i >= 0; i-- {
+		name := fixtures.active[i]
+		if want[name] {
+			continue
+		}
+		if f := fixtures.m[name]; f.teardown != nil {
+			f.teardown()
+		}
+	}
+	var keep []string
+	for _, name := range fixtures.active {
+		if want[name] {
+			keep = append(keep, name)
+		}
+	}
+	fixtures.active = keep
+
+	for _, name := range names {
+		if contains(fixtures.active, name) {
+			continue
+		}
+		if err := fixtures.m[name].setup(); err != nil {
+			return fmt.Errorf("fixture %s: %v", name, err)
+		}
+		fixtures.active = append(fixtures.active, name)
+	}
+	return nil
+}
+
+// teardownFixtures tears down all active fixtures,
+// as the server exits or restarts.
+func teardownFixtures() {
+	if err := useFixtures(nil); err != nil {
+		logger.Warn("tear down fixtures", "err", err)
+	}
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package benchserve
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ListFuzz returns the sorted names of the fuzz targets in the binary.
+func (s *Server) ListFuzz(args struct{}, names *[]string) error {
+	for _, f := range s.fuzz {
+		*names = append(*names, f.Name)
+	}
+	sort.Strings(*names)
+	return nil
+}
+
+// RunFuzz requests a run of a single fuzz target.
+type RunFuzz struct {
+	Name string // name of the fuzz target
+
+	// Time is how long to fuzz, equivalent to -test.fuzztime.
+	// Zero means run only the seed corpus, as 'go test' does by default.
+	Time time.Duration
+
+	Timeout time.Duration // equivalent to -test.timeout; zero means no timeout
+}
+
+// FuzzResult is the result of running a fuzz target.
+type FuzzResult struct {
+	TestResult
+
+	// Input is the path of the failing input file written by the fuzzer,
+	// relative to the server's working directory, if any.
+	Input string
+
+	// InputData is the contents of Input.
+	InputData []byte
+}
+
+// failingInput matches the fuzzer's report of a new failing input.
+var failingInput = regexp.MustCompile(`(?m)^\s*Failing input written to (\S+)$`)
+
+// RunFuzz runs a fuzz target in a new copy of the test binary,
+// either on its seed corpus or fuzzing for a limited time.
+// A failure is reported in the FuzzResult, not as an error.
+func (s *Server) RunFuzz(args RunFuzz, reply *FuzzResult) error {
+	if !s.hasFuzz(args.Name) {
+		return fmt.Errorf("%s not found", args.Name)
+	}
+	if args.Time <= 0 {
+		var err error
+		reply.TestResult, err = s.runTest(args.Name, exactPattern(args.Name), args.Timeout)
+		return err
+	}
+
+	cache, err := os.MkdirTemp("", "benchserve-fuzzcache")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cache)
+	reply.TestResult, err = s.runTest(args.Name, exactPattern(args.Name), args.Timeout,
+		"-test.fuzz="+exactPattern(args.Name),
+		"-test.fuzztime="+args.Time.String(),
+		"-test.fuzzcachedir="+cache,
+	)
+	if m := failingInput.FindStringSubmatch(reply.Output); m != nil {
+		reply.Input = m[1]
+		reply.InputData, _ = os.ReadFile(m[1])
+	}
+	return err
+}
+
+// hasFuzz reports whether name is a fuzz target in the binary.
+func (s *Server) hasFuzz(name string) bool {
+	for _, f := range s.fuzz {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
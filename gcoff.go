@@ -0,0 +1,34 @@
+package benchserve
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+// maxGCOffBytes is the most that a run may allocate for Run.CompareGC
+// to repeat it with the garbage collector off, since none of it is freed
+// until the run ends.
+const maxGCOffBytes = 1 << 30
+
+// measureGCOff repeats the run of b requested by args, whose result was r,
+// with the garbage collector off, for Run.CompareGC. If the run
+// allocates too much to do so, it returns the reason instead.
+func measureGCOff(ctx context.Context, b testing.InternalBenchmark, args Run, r Result) (*Result, string) {
+	allocated := uint64(float64(r.MemBytes) / float64(r.N) * float64(args.N))
+	if allocated > maxGCOffBytes {
+		return nil, fmt.Sprintf("the run allocated %d bytes, more than the %d allowed with GC off", allocated, maxGCOffBytes)
+	}
+	gogc := debug.SetGCPercent(-1)
+	limit := debug.SetMemoryLimit(math.MaxInt64)
+	// runBenchmark collects garbage before the run, as GC off permits.
+	off := runBenchmark(ctx, b, args.N, args.Parallelism, true)
+	debug.SetMemoryLimit(limit)
+	debug.SetGCPercent(gogc)
+	runtime.GC()
+	off.perOp()
+	return &off, ""
+}
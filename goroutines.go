@@ -0,0 +1,60 @@
+package benchserve
+
+import (
+	"bytes"
+	"runtime"
+	"time"
+)
+
+// goroutineSettle is how long to wait for goroutines started by a run to exit
+// before counting them as leaked.
+const goroutineSettle = 100 * time.Millisecond
+
+// allStacks returns the stacks of all goroutines, as printed by runtime.Stack.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineDelta returns how many more goroutines exist now than before,
+// allowing briefly for exiting goroutines to finish.
+func goroutineDelta(before int) int {
+	deadline := time.Now().Add(goroutineSettle)
+	for {
+		d := runtime.NumGoroutine() - before
+		if d <= 0 || time.Now().After(deadline) {
+			return d
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newStacks returns the stacks in after of goroutines absent from before,
+// both as returned by allStacks.
+func newStacks(before, after []byte) string {
+	old := make(map[string]bool)
+	for _, g := range bytes.Split(before, []byte("\n\n")) {
+		old[string(goroutineHeader(g))] = true
+	}
+	var leaked [][]byte
+	for _, g := range bytes.Split(after, []byte("\n\n")) {
+		if !old[string(goroutineHeader(g))] {
+			leaked = append(leaked, g)
+		}
+	}
+	return string(bytes.Join(leaked, []byte("\n\n")))
+}
+
+// goroutineHeader returns the identifying prefix "goroutine N" of stack g.
+func goroutineHeader(g []byte) []byte {
+	if i := bytes.Index(g, []byte(" [")); i >= 0 {
+		return g[:i]
+	}
+	return g
+}
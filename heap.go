@@ -0,0 +1,42 @@
+package benchserve
+
+import "runtime"
+
+// heapTrendRuns is the number of consecutive runs of a benchmark
+// over which growth of the live heap is flagged as a probable leak.
+const heapTrendRuns = 4
+
+// heapTrendMin is the minimum growth over heapTrendRuns runs
+// flagged as a probable leak, to ignore incidental allocations
+// elsewhere in the server.
+const heapTrendMin = 64 << 10
+
+// heapTrend collects garbage and records the size of the live heap
+// after a run of the named benchmark. It reports the size, and whether
+// the live heap has grown after each of the last heapTrendRuns runs.
+func (s *server) heapTrend(name string) (live uint64, growing bool) {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	live = ms.HeapAlloc
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.heapLive == nil {
+		s.heapLive = make(map[string][]uint64)
+	}
+	h := append(s.heapLive[name], live)
+	if len(h) > heapTrendRuns+1 {
+		h = h[len(h)-heapTrendRuns-1:]
+	}
+	s.heapLive[name] = h
+	if len(h) <= heapTrendRuns {
+		return live, false
+	}
+	for i := 1; i < len(h); i++ {
+		if h[i] <= h[i-1] {
+			return live, false
+		}
+	}
+	return live, h[len(h)-1]-h[0] >= heapTrendMin
+}
@@ -0,0 +1,82 @@
+package benchserve
+
+import (
+	"context"
+	"math"
+	"sort"
+	"testing"
+)
+
+// Latency summarizes the distribution of ns/op across the batches of a run.
+type Latency struct {
+	BatchSize int // iterations per batch, rounded down
+
+	Min, P50, P90, P99, Max float64 // ns/op percentiles across batches
+
+	// Buckets is a histogram of the batches' ns/op, in increasing order.
+	// Bucket bounds grow geometrically, by a factor of 2^(1/4);
+	// empty buckets are omitted.
+	Buckets []Bucket
+}
+
+// A Bucket is a range of a histogram.
+type Bucket struct {
+	Lo, Hi float64 // bounds of the bucket, Lo <= ns/op < Hi
+	Count  int     // number of batches in the bucket
+}
+
+// bucketsPerDoubling sets the resolution of Latency.Buckets.
+const bucketsPerDoubling = 4
+
+// runBatches runs b for n iterations split as evenly as possible
+// into the given number of batches, timing each batch separately,
+// and returns the combined result. par is as for runBenchmark.
+// Unlike separate runs, the batches are not separated by garbage
+// collections, so that their distribution reflects the cost of GC.
+func runBatches(ctx context.Context, b testing.InternalBenchmark, n, par, batches int) Result {
+	if batches > n {
+		batches = n
+	}
+	var total Result
+	var ns []float64
+	for i := 0; i < batches && ctx.Err() == nil; i++ {
+		size := (i+1)*n/batches - i*n/batches
+		r := runBenchmark(ctx, b, size, par, i == 0)
+		total.add(r)
+		if r.failed || r.hasSub {
+			break
+		}
+		ns = append(ns, nsPerOp(r))
+	}
+	total.Latency = latency(ns, n/batches)
+	return total
+}
+
+// latency summarizes the per-batch ns/op values x.
+func latency(x []float64, batchSize int) *Latency {
+	if len(x) == 0 {
+		return nil
+	}
+	sort.Float64s(x)
+	pct := func(p float64) float64 {
+		return x[int(math.Ceil(p*float64(len(x))))-1]
+	}
+	l := &Latency{
+		BatchSize: batchSize,
+		Min:       x[0],
+		P50:       pct(0.50),
+		P90:       pct(0.90),
+		P99:       pct(0.99),
+		Max:       x[len(x)-1],
+	}
+	for _, v := range x {
+		k := math.Floor(bucketsPerDoubling * math.Log2(math.Max(v, 1)))
+		lo := math.Exp2(k / bucketsPerDoubling)
+		if n := len(l.Buckets); n > 0 && l.Buckets[n-1].Lo == lo {
+			l.Buckets[n-1].Count++
+			continue
+		}
+		l.Buckets = append(l.Buckets, Bucket{Lo: lo, Hi: math.Exp2((k + 1) / bucketsPerDoubling), Count: 1})
+	}
+	return l
+}
@@ -0,0 +1,120 @@
+package benchserve
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// history is a persistent store of Records,
+// kept as a file of JSON lines named by -test.benchserve.history.
+type history struct {
+	mu   sync.Mutex
+	path string
+}
+
+// add appends rec to the history.
+func (h *history) add(rec Record) error {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// scan calls fn for each record in the history, oldest first.
+// Malformed lines, such as one truncated by a crash, are skipped.
+func (h *history) scan(fn func(Record)) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var rec Record
+		if json.Unmarshal(sc.Bytes(), &rec) == nil {
+			fn(rec)
+		}
+	}
+	return sc.Err()
+}
+
+// History requests past runs from the server's history store.
+type History struct {
+	Pattern string // benchmarks to include, with the same semantics as -test.bench
+
+	// Binary restricts the results to runs of the test binary with this hash.
+	// The empty string includes runs of all binaries.
+	Binary string
+
+	// Options, if non-nil, restricts the results to runs with these Options.
+	Options *Options
+
+	Since time.Time // if non-zero, only include runs completed at or after Since
+	Until time.Time // if non-zero, only include runs completed before Until
+	Limit int       // if positive, only include the most recent Limit matches
+}
+
+// HistoryResult is the result of a History query.
+type HistoryResult struct {
+	Binary  string   // hash of the running test binary, for use in later queries
+	Records []Record // matching runs, oldest first
+}
+
+// History returns past runs recorded in the history store.
+// The history store is enabled by the -test.benchserve.history flag.
+// It persists across server restarts and across test binaries,
+// so it can be used to compare against earlier builds on the same machine.
+func (s *Server) History(args History, reply *HistoryResult) error {
+	reply.Binary = binaryHash()
+	if s.history == nil {
+		return nil
+	}
+	m, err := newMatcher(args.Pattern)
+	if err != nil {
+		return err
+	}
+	err = s.history.scan(func(rec Record) {
+		if !args.matches(m, rec) {
+			return
+		}
+		reply.Records = append(reply.Records, rec)
+		if args.Limit > 0 && len(reply.Records) > args.Limit {
+			reply.Records = reply.Records[1:]
+		}
+	})
+	return err
+}
+
+// matches reports whether rec satisfies the query, other than its Limit.
+// m is the matcher for the query's Pattern.
+func (args History) matches(m matcher, rec Record) bool {
+	switch {
+	case !m.matches(rec.Run.Name),
+		args.Binary != "" && rec.Binary != args.Binary,
+		args.Options != nil && rec.Options != *args.Options,
+		!args.Since.IsZero() && rec.Time.Before(args.Since),
+		!args.Until.IsZero() && !rec.Time.Before(args.Until):
+		return false
+	}
+	return true
+}
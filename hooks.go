@@ -0,0 +1,56 @@
+package benchserve
+
+import "sync"
+
+var hooks struct {
+	sync.Mutex
+	before, after []func(name string)
+}
+
+// OnBeforeRun registers f to be called before each benchmark run
+// requested of the server, with the name of the benchmark.
+// Use it to set up fixtures, such as opening databases or clearing caches,
+// that the benchmark needs fresh for every run.
+// f runs before measurement begins, so it is not included in the results.
+// For isolated runs, f runs in the child process.
+//
+// OnBeforeRun should be called in TestMain, before Main or Serve.
+// Functions run in the order they were registered.
+func OnBeforeRun(f func(name string)) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.before = append(hooks.before, f)
+}
+
+// OnAfterRun registers f to be called after each benchmark run
+// requested of the server, with the name of the benchmark,
+// to tear down what functions registered with OnBeforeRun set up.
+// It is called even if the run fails.
+//
+// OnAfterRun should be called in TestMain, before Main or Serve.
+// Functions run in the reverse of the order they were registered.
+func OnAfterRun(f func(name string)) {
+	hooks.Lock()
+	defer hooks.Unlock()
+	hooks.after = append(hooks.after, f)
+}
+
+// beforeRun calls the functions registered with OnBeforeRun.
+func beforeRun(name string) {
+	hooks.Lock()
+	fs := hooks.before
+	hooks.Unlock()
+	for _, f := range fs {
+		f(name)
+	}
+}
+
+// afterRun calls the functions registered with OnAfterRun.
+func afterRun(name string) {
+	hooks.Lock()
+	fs := hooks.after
+	hooks.Unlock()
+	for i := len(fs) - 1; i >= 0; i-- {
+		fs[i](name)
+	}
+}
@@ -0,0 +1,125 @@
+package benchserve
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// httpAddr returns the address for the HTTP endpoints.
+// Like listenAddr, it listens on all interfaces only if asked to,
+// since the endpoints have no authentication.
+func httpAddr() string {
+	host, port, err := net.SplitHostPort(*benchServeHTTP)
+	if err != nil || host != "" || *benchServeExpose {
+		return *benchServeHTTP
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// serveHTTP serves the HTTP endpoints on -test.benchserve.http.
+// It uses the same TLS configuration as the JSON-RPC listener.
+func (s *server) serveHTTP() {
+	addr := httpAddr()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal("listen", "addr", addr, "err", err)
+	}
+	if tcp := l.Addr().(*net.TCPAddr); !tcp.IP.IsLoopback() && *benchServeTLSClientCA == "" {
+		logger.Warn("HTTP endpoints are unauthenticated and reachable from other hosts; use a loopback address or -test.benchserve.tlsclientca to restrict them", "addr", l.Addr())
+	}
+	if *benchServeTLSCert != "" || *benchServeTLSKey != "" {
+		config, err := tlsConfig()
+		if err != nil {
+			fatal("configure TLS", "err", err)
+		}
+		l = tls.NewListener(l, config)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artifacts/", serveArtifact)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	mux.HandleFunc("/openapi.json", serveSchema)
+	mux.HandleFunc("/export", s.serveExport)
+	if *benchServeDebug {
+		s.handleDebug(mux)
+	}
+	if *benchServeDashboard {
+		mux.HandleFunc("/", serveDashboard)
+		for method, h := range s.dashboardAPI() {
+			mux.HandleFunc("/api/"+method, h)
+		}
+	}
+	fatal("serve HTTP", "err", http.Serve(l, mux))
+}
+
+// serveArtifact serves the artifact named by the last element of the URL path.
+func serveArtifact(w http.ResponseWriter, r *http.Request) {
+	path, err := artifactPath(strings.TrimPrefix(r.URL.Path, "/artifacts/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if r.Header.Get("Range") != "" || !acceptsGzip(r) {
+		http.ServeFile(w, r, path)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "artifact not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	// Profiles are already compressed; send them as is.
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		io.Copy(w, br)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	io.Copy(zw, br)
+	zw.Close()
+}
+
+// serveExport serves the file produced by Server.Export, for downloading
+// into a spreadsheet. The query parameters format, history (a boolean),
+// pattern, binary, and limit correspond to the fields of Export.
+func (s *server) serveExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	args := Export{Format: q.Get("format"), Filter: History{Pattern: q.Get("pattern"), Binary: q.Get("binary")}}
+	args.History, _ = strconv.ParseBool(q.Get("history"))
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if args.Filter.Limit, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "bad limit", http.StatusBadRequest)
+			return
+		}
+	}
+	var reply ExportResult
+	srv := &Server{server: s, client: &client{addr: r.RemoteAddr}}
+	if err := srv.Export(args, &reply); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", reply.ContentType)
+	io.WriteString(w, reply.Data)
+}
+
+// acceptsGzip reports whether r's client accepts gzip content encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(enc, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package benchserve
+
+import "testing"
+
+func TestHTTPAddr(t *testing.T) {
+	defer func(addr string, expose bool) {
+		*benchServeHTTP, *benchServeExpose = addr, expose
+	}(*benchServeHTTP, *benchServeExpose)
+
+	for _, tt := range []struct {
+		addr   string
+		expose bool
+		want   string
+	}{
+		{":8080", false, "127.0.0.1:8080"},
+		{":8080", true, ":8080"},
+		{":0", false, "127.0.0.1:0"},
+		{"0.0.0.0:8080", false, "0.0.0.0:8080"},
+		{"localhost:8080", false, "localhost:8080"},
+		{"[::1]:8080", false, "[::1]:8080"},
+	} {
+		*benchServeHTTP, *benchServeExpose = tt.addr, tt.expose
+		if got := httpAddr(); got != tt.want {
+			t.Errorf("httpAddr() with -test.benchserve.http=%s, expose %v = %s, want %s", tt.addr, tt.expose, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package benchserve
+
+import (
+	"os"
+	"runtime"
+)
+
+// Info describes the server's build and platform.
+type Info struct {
+	GoVersion string // Go release the test binary was built with
+	GOOS      string
+	GOARCH    string
+	NumCPU    int
+	Package   string // import path of the package under test
+	Binary    string // hash of the test binary, as in HistoryResult
+	PID       int
+
+	// Virtualization is the emulator or hypervisor under which
+	// the server runs, such as "rosetta", "qemu", or "kvm",
+	// or empty if it runs natively or detection is unsupported.
+	// Detection is supported on Linux and macOS.
+	Virtualization string
+
+	Compatible string // error returned by Compatible, or empty if none
+}
+
+// Info reports the server's Info.
+func (s *Server) Info(args struct{}, reply *Info) error {
+	*reply = Info{
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Package:   s.pkgPath(),
+		Binary:    binaryHash(),
+		PID:       os.Getpid(),
+
+		Virtualization: virtualization(),
+	}
+	if err := Compatible(); err != nil {
+		reply.Compatible = err.Error()
+	}
+	return nil
+}
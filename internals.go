@@ -0,0 +1,227 @@
+package benchserve
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// Benchserve reads and writes unexported fields of the testing package's
+// types, which change from one Go release to the next.
+// The fields used in all supported releases are listed here;
+// those that vary are listed in per-release files
+// selected by build tags, named internals_go1XX.go.
+// Compatible checks all of them before any are touched.
+
+// A field is an unexported field of a testing type used by benchserve.
+// The name of a field of a nested struct is a dotted path, such as "loop.n".
+type field struct {
+	name string
+	typ  reflect.Type
+}
+
+var (
+	mType = reflect.TypeOf((*testing.M)(nil)).Elem()
+	bType = reflect.TypeOf((*testing.B)(nil)).Elem()
+)
+
+// mFields are the fields of testing.M used by benchserve.
+var mFields = []field{
+	{"tests", reflect.TypeOf([]testing.InternalTest(nil))},
+	{"benchmarks", reflect.TypeOf([]testing.InternalBenchmark(nil))},
+	{"fuzzTargets", reflect.TypeOf([]testing.InternalFuzzTarget(nil))},
+}
+
+// bFields are the fields of testing.B used by benchserve in all supported releases.
+var bFields = []field{
+	{"duration", reflect.TypeOf(time.Duration(0))},
+	{"bytes", reflect.TypeOf(int64(0))},
+	{"netAllocs", reflect.TypeOf(uint64(0))},
+	{"netBytes", reflect.TypeOf(uint64(0))},
+	{"showAllocResult", reflect.TypeOf(false)},
+	{"failed", reflect.TypeOf(false)},
+	{"cleanups", reflect.TypeOf([]func(){})},
+	{"extra", reflect.TypeOf(map[string]float64(nil))},
+	{"parallelism", reflect.TypeOf(0)},
+	{"hasSub", reflect.TypeOf((*atomic.Bool)(nil)).Elem()},
+	{"w", reflect.TypeOf((*io.Writer)(nil)).Elem()},
+}
+
+var (
+	compatibleOnce sync.Once
+	compatibleErr  error
+)
+
+// Compatible reports whether benchserve supports the internals
+// of the testing package it was built with.
+// If not, the server refuses to start, with this error.
+func Compatible() error {
+	compatibleOnce.Do(func() {
+		compatibleErr = checkFields(mType, mFields)
+		if compatibleErr == nil {
+			compatibleErr = checkFields(bType, append(bFields, releaseBFields...))
+		}
+	})
+	return compatibleErr
+}
+
+// checkFields checks that struct type t has the given fields.
+func checkFields(t reflect.Type, fields []field) error {
+	for _, f := range fields {
+		ft := t
+		for _, name := range strings.Split(f.name, ".") {
+			var sf reflect.StructField
+			ok := ft.Kind() == reflect.Struct
+			if ok {
+				sf, ok = ft.FieldByName(name)
+			}
+			if !ok {
+				return fmt.Errorf("benchserve does not yet support %s internals: %v has no field %s", runtime.Version(), t, f.name)
+			}
+			ft = sf.Type
+		}
+		if ft != f.typ {
+			return fmt.Errorf("benchserve does not yet support %s internals: %v.%s has type %v, want %v", runtime.Version(), t, f.name, ft, f.typ)
+		}
+	}
+	return nil
+}
+
+// testFuncs returns the tests, benchmarks, and fuzz targets in m.
+func testFuncs(m *testing.M) ([]testing.InternalTest, []testing.InternalBenchmark, []testing.InternalFuzzTarget) {
+	v := reflect.ValueOf(m).Elem()
+	tests := *(*[]testing.InternalTest)(unsafe.Pointer(v.FieldByName("tests").UnsafeAddr()))
+	benchmarks := *(*[]testing.InternalBenchmark)(unsafe.Pointer(v.FieldByName("benchmarks").UnsafeAddr())) // :(((
+	fuzz := *(*[]testing.InternalFuzzTarget)(unsafe.Pointer(v.FieldByName("fuzzTargets").UnsafeAddr()))
+	return tests, benchmarks, fuzz
+}
+
+// benchResult returns the result of a completed run of the testing.B v.
+func benchResult(v reflect.Value) Result {
+	var r Result
+	r.T = time.Duration(v.FieldByName("duration").Int())
+	r.Bytes = v.FieldByName("bytes").Int()
+	r.MemAllocs = v.FieldByName("netAllocs").Uint()
+	r.MemBytes = v.FieldByName("netBytes").Uint()
+	r.ReportAllocs = v.FieldByName("showAllocResult").Bool()
+	r.failed = v.FieldByName("failed").Bool()
+	r.Config.Parallelism = int(v.FieldByName("parallelism").Int())
+	// Metrics reported with b.ReportMetric.
+	for k, x := range extraMetrics(v) {
+		if k == resetMark {
+			continue
+		}
+		if r.Extra == nil {
+			r.Extra = make(map[string]float64)
+		}
+		r.Extra[k] = x
+	}
+	return r
+}
+
+// resetMark is a key in a testing.B's extra metrics, which b.ResetTimer clears.
+const resetMark = "benchserve reset mark"
+
+// extraMetrics returns the extra metrics map of the testing.B v.
+func extraMetrics(v reflect.Value) map[string]float64 {
+	return *(*map[string]float64)(unsafe.Pointer(v.FieldByName("extra").UnsafeAddr()))
+}
+
+// markReset marks the testing.B v, so that wasReset can tell
+// whether the benchmark later calls b.ResetTimer.
+// v must already have called ResetTimer, which allocates the map.
+func markReset(v reflect.Value) {
+	extraMetrics(v)[resetMark] = 0
+}
+
+// wasReset reports whether b.ResetTimer was called on the testing.B v
+// since markReset, and removes the mark.
+// It allocates, so it must not be called while the timer runs.
+func wasReset(v reflect.Value) bool {
+	m := extraMetrics(v)
+	_, marked := m[resetMark]
+	delete(m, resetMark)
+	return !marked
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// timerStart returns a pointer to the time at which the timer
+// of the testing.B v was last started or reset, or nil if it cannot tell.
+// The time is a time.Time or, in newer releases, a struct wrapping one,
+// except on Windows, where it is a raw performance counter.
+// Reading through the pointer is cheap enough to do while the timer runs.
+func timerStart(v reflect.Value) *time.Time {
+	f := v.FieldByName("start")
+	switch {
+	case !f.IsValid():
+		return nil
+	case f.Type() == timeType:
+	case f.Kind() == reflect.Struct && f.NumField() == 1 && f.Type().Field(0).Type == timeType:
+		f = f.Field(0)
+	default:
+		return nil
+	}
+	return (*time.Time)(unsafe.Pointer(f.UnsafeAddr()))
+}
+
+var benchmarkLockOnce sync.Once
+
+// holdBenchmarkLock leaves the testing package's benchmarkLock held,
+// as testing holds it while it runs a benchmark function.
+// b.Run releases the lock around each sub-benchmark, and crashes
+// the process if it is not held. testing.Benchmark takes the lock
+// to run a function that never returns, so the lock stays held,
+// and the garbage collection testing.Benchmark starts with happens
+// only the first time. Runs are serialized by the server's runMu,
+// so no two release it at once. A server never returns to running
+// benchmarks through testing, which would wait for the lock forever.
+func holdBenchmarkLock() {
+	benchmarkLockOnce.Do(func() {
+		held := make(chan struct{})
+		go testing.Benchmark(func(b *testing.B) {
+			close(held)
+			select {}
+		})
+		<-held
+	})
+}
+
+// hasSubBenchmarks reports whether the testing.B v called b.Run.
+func hasSubBenchmarks(v reflect.Value) bool {
+	return (*atomic.Bool)(unsafe.Pointer(v.FieldByName("hasSub").UnsafeAddr())).Load()
+}
+
+// discardOutput discards the output of the testing.B v,
+// which sub-benchmarks write to when they fail.
+func discardOutput(v reflect.Value) {
+	setUnexported(v.FieldByName("w"), io.Discard)
+}
+
+// runCleanups calls the functions registered with Cleanup on the testing.B v,
+// including those that remove directories created by TempDir,
+// in last added, first called order.
+func runCleanups(v reflect.Value) {
+	cleanups := (*[]func())(unsafe.Pointer(v.FieldByName("cleanups").UnsafeAddr()))
+	// A cleanup function may register more.
+	for len(*cleanups) > 0 {
+		last := len(*cleanups) - 1
+		f := (*cleanups)[last]
+		*cleanups = (*cleanups)[:last]
+		f()
+	}
+}
+
+// setUnexported sets the unexported struct field f to x.
+// f must be addressable.
+func setUnexported(f reflect.Value, x interface{}) {
+	f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+	f.Set(reflect.ValueOf(x))
+}
@@ -0,0 +1,24 @@
+//go:build !go1.24
+
+package benchserve
+
+import (
+	"context"
+	"reflect"
+)
+
+// releaseBFields are the release-specific fields of testing.B used by benchserve.
+var releaseBFields []field
+
+// setContext sets the testing.B v's context.
+// Before Go 1.24, benchmarks have no context, so it does nothing.
+func setContext(v reflect.Value, ctx context.Context, cancel context.CancelFunc) {}
+
+// setFixedN tells b.Loop to run exactly n iterations.
+// Before Go 1.24, there is no b.Loop, so it does nothing.
+func setFixedN(v reflect.Value, n int) {}
+
+// loopState reports whether the completed benchmark v used b.Loop,
+// and if so, whether it ran until b.Loop returned false.
+// Before Go 1.24, there is no b.Loop.
+func loopState(v reflect.Value) (used, done bool) { return false, false }
@@ -0,0 +1,36 @@
+//go:build go1.24
+
+package benchserve
+
+import (
+	"context"
+	"reflect"
+)
+
+// releaseBFields are the release-specific fields of testing.B used by benchserve.
+var releaseBFields = []field{
+	{"ctx", reflect.TypeOf((*context.Context)(nil)).Elem()},
+	{"cancelCtx", reflect.TypeOf(context.CancelFunc(nil))},
+	{"benchTime.n", reflect.TypeOf(0)},
+	{"loop.n", reflect.TypeOf(uint64(0))},
+	{"loop.done", reflect.TypeOf(false)},
+}
+
+// setContext sets the testing.B v's context, returned by b.Context.
+func setContext(v reflect.Value, ctx context.Context, cancel context.CancelFunc) {
+	setUnexported(v.FieldByName("ctx"), ctx)
+	setUnexported(v.FieldByName("cancelCtx"), cancel)
+}
+
+// setFixedN tells b.Loop to run exactly n iterations, as with -test.benchtime=Nx.
+// Otherwise b.Loop chooses its own count, ignoring b.N.
+func setFixedN(v reflect.Value, n int) {
+	setUnexported(v.FieldByName("benchTime").FieldByName("n"), n)
+}
+
+// loopState reports whether the completed benchmark v used b.Loop,
+// and if so, whether it ran until b.Loop returned false.
+func loopState(v reflect.Value) (used, done bool) {
+	loop := v.FieldByName("loop")
+	return loop.FieldByName("n").Uint() > 0, loop.FieldByName("done").Bool()
+}
@@ -0,0 +1,69 @@
+package benchserve
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// IOCounters counts the I/O performed by the server process.
+// Fields are zero where the information is unavailable.
+// The counts cover the whole process, so clients
+// served during a run add their network traffic.
+type IOCounters struct {
+	// ReadBytes and WriteBytes count bytes passed to read and write
+	// system calls, including those on sockets and pipes, and ReadCalls
+	// and WriteCalls the calls. They are only gathered on Linux.
+	ReadBytes, WriteBytes int64
+	ReadCalls, WriteCalls int64
+
+	// DiskReadBytes and DiskWriteBytes count bytes fetched from
+	// and sent to storage, excluding reads served by the page cache.
+	// They are only gathered on Linux.
+	DiskReadBytes, DiskWriteBytes int64
+
+	// BlockReads and BlockWrites count block I/O operations,
+	// as reported by getrusage on Unix systems.
+	BlockReads, BlockWrites int64
+}
+
+// readIOCounters returns the process's I/O counters so far.
+func readIOCounters() IOCounters {
+	var c IOCounters
+	c.BlockReads, c.BlockWrites = processBlockIO()
+	buf, err := os.ReadFile("/proc/self/io")
+	if err != nil {
+		return c
+	}
+	fields := map[string]*int64{
+		"rchar":       &c.ReadBytes,
+		"wchar":       &c.WriteBytes,
+		"syscr":       &c.ReadCalls,
+		"syscw":       &c.WriteCalls,
+		"read_bytes":  &c.DiskReadBytes,
+		"write_bytes": &c.DiskWriteBytes,
+	}
+	sc := bufio.NewScanner(bytes.NewReader(buf))
+	for sc.Scan() {
+		k, v, ok := bytes.Cut(sc.Bytes(), []byte(": "))
+		if p := fields[string(k)]; ok && p != nil {
+			*p, _ = strconv.ParseInt(string(v), 10, 64)
+		}
+	}
+	return c
+}
+
+// sub returns the I/O counted by c since before.
+func (c IOCounters) sub(before IOCounters) IOCounters {
+	return IOCounters{
+		ReadBytes:      c.ReadBytes - before.ReadBytes,
+		WriteBytes:     c.WriteBytes - before.WriteBytes,
+		ReadCalls:      c.ReadCalls - before.ReadCalls,
+		WriteCalls:     c.WriteCalls - before.WriteCalls,
+		DiskReadBytes:  c.DiskReadBytes - before.DiskReadBytes,
+		DiskWriteBytes: c.DiskWriteBytes - before.DiskWriteBytes,
+		BlockReads:     c.BlockReads - before.BlockReads,
+		BlockWrites:    c.BlockWrites - before.BlockWrites,
+	}
+}
@@ -0,0 +1,128 @@
+package benchserve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxLayoutPad bounds the environment padding chosen by RandomizeLayout.
+// Padding shifts the initial stack, so a page's worth covers
+// all its alignments.
+const maxLayoutPad = 4096
+
+// childRequest is the request passed to a child process in isolation mode.
+type childRequest struct {
+	Run     Run
+	Options Options
+}
+
+// childReply is a child process's report of its run.
+type childReply struct {
+	Result Result
+	Failed bool   // whether the benchmark failed
+	Err    string // any other error
+}
+
+// measureIsolated runs the benchmark requested by args
+// in a child copy of the test binary.
+// The caller must have acquired the server.
+func (s *Server) measureIsolated(ctx context.Context, args Run, opt Options) (Result, error) {
+	if args.RandomizeLayout {
+		args.Layout = rand.Intn(maxLayoutPad)
+	}
+	dir, err := os.MkdirTemp("", "benchserve-child")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.RemoveAll(dir)
+	// The child does not see the server's flags.
+	args.Strict = args.Strict || *benchServeStrict
+	req, err := json.Marshal(childRequest{Run: args, Options: opt})
+	if err != nil {
+		return Result{}, err
+	}
+	reqFile := filepath.Join(dir, "request.json")
+	if err := os.WriteFile(reqFile, req, 0o644); err != nil {
+		return Result{}, err
+	}
+	artifacts, err := artifactDir()
+	if err != nil {
+		return Result{}, err
+	}
+
+	cmd, err := selfCommand(ctx, "-test.benchserve", "-test.benchserve.child="+reqFile,
+		"-test.benchserve.artifacts="+artifacts, "-test.benchserve.maxartifacts="+strconv.Itoa(*benchServeMaxArtifacts))
+	if err != nil {
+		return Result{}, err
+	}
+	cmd.Env = os.Environ()
+	if args.Layout > 0 {
+		cmd.Env = append(cmd.Env, "BENCHSERVE_LAYOUT="+strings.Repeat("x", args.Layout))
+	}
+	var out []byte
+	if args.NUMANode != nil {
+		out, err = combinedOutputOnNode(cmd, *args.NUMANode)
+	} else {
+		out, err = cmd.CombinedOutput()
+	}
+	if ctx.Err() != nil {
+		return Result{Canceled: true, Layout: args.Layout}, errCanceled
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: child process: %v\n%s", args.Name, err, out)
+	}
+
+	var reply childReply
+	buf, err := os.ReadFile(reqFile + ".reply")
+	if err == nil {
+		err = json.Unmarshal(buf, &reply)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: reading child result: %v", args.Name, err)
+	}
+	r := reply.Result
+	r.failed = reply.Failed
+	r.Layout = args.Layout
+	r.NUMANode = args.NUMANode
+	if reply.Err != "" {
+		return r, fmt.Errorf("%s", reply.Err)
+	}
+	if r.failed {
+		return r, fmt.Errorf("%s failed", args.Name)
+	}
+	return r, nil
+}
+
+// runChild performs the single run requested in file, as a child process
+// in isolation mode, and writes the resulting childReply to file.reply.
+func (s *Server) runChild(file string) error {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var req childRequest
+	if err := json.Unmarshal(buf, &req); err != nil {
+		return err
+	}
+	b, ok := s.m[req.Run.Name]
+	if !ok {
+		return fmt.Errorf("%s not found", req.Run.Name)
+	}
+	s.client = &client{sess: &session{opt: req.Options}}
+	r, err := s.measure(context.Background(), b, req.Run)
+	teardownFixtures()
+	reply := childReply{Result: r, Failed: r.failed}
+	if err != nil && (!r.failed || r.hasSub) {
+		reply.Err = err.Error()
+	}
+	if buf, err = json.Marshal(reply); err != nil {
+		return err
+	}
+	return os.WriteFile(file+".reply", buf, 0o644)
+}
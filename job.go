@@ -0,0 +1,520 @@
+package benchserve
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Batch requests running a series of benchmarks as a background job.
+type Batch struct {
+	Runs []Run // runs to perform, in order
+
+	// Order constrains the order in which Runs are performed,
+	// for measurements with phases, such as warming a cache
+	// before the measured run. Otherwise Runs are performed in order.
+	// A run is skipped, and fails, if a run that must precede it fails.
+	// In campaigns, a run is first sampled once those that must precede it
+	// have been sampled at least once.
+	Order []Order
+
+	// Select adds runs of groups of benchmarks, such as all those
+	// with some tag, after those in Runs. Indices in Order
+	// count the selected runs as if they were listed in Runs.
+	Select []Select
+
+	// Budget, if positive, makes the job a campaign: rather than
+	// performing each run once, the server repeats the Runs, spending
+	// up to Budget of wall-clock time in total. After a first round,
+	// it gives each additional sample to the run whose confidence
+	// interval, relative to its mean ns/op, the sample is expected
+	// to narrow the most for its cost, so that the budget goes where
+	// it most improves the results.
+	Budget time.Duration
+
+	// Labels are added to the Labels of each run, including selected ones,
+	// that does not set them itself.
+	Labels map[string]string `json:",omitempty"`
+
+	// Webhook is a URL to which the server POSTs the job's JobStatus,
+	// encoded as JSON, when the job finishes.
+	// It defaults to the -test.benchserve.webhook flag.
+	// Any other URL must be on a host listed in -test.benchserve.webhookhosts,
+	// and is rejected by a server with -test.benchserve.readonly.
+	Webhook string
+
+	// Priority orders the job among the queued jobs: jobs with
+	// higher priority run before those with lower priority,
+	// and jobs of equal priority in the order submitted.
+	// A running job with lower priority gives way between runs,
+	// continuing once the higher-priority jobs have finished;
+	// a benchmark run is never interrupted. For campaigns,
+	// the time spent giving way counts against the Budget.
+	Priority int `json:",omitempty"`
+
+	// ID, if set, is the ID of the job, chosen by the client, so that
+	// a client that loses its connection before Submit replies can still
+	// find the job. Submitting a batch with the ID of an existing job
+	// returns that ID without submitting the batch again.
+	ID string `json:",omitempty"`
+}
+
+// JobID identifies a job.
+type JobID struct {
+	ID string
+}
+
+// Job states.
+const (
+	JobQueued   = "queued"   // waiting for earlier jobs
+	JobRunning  = "running"  // running its benchmarks
+	JobHeld     = "held"     // started, but waiting for Resume, -test.benchserve.window, or a job of higher priority
+	JobDone     = "done"     // finished; all runs succeeded
+	JobFailed   = "failed"   // finished; at least one run failed
+	JobCanceled = "canceled" // stopped by CancelJob or CancelAll
+)
+
+// JobStatus describes a job.
+type JobStatus struct {
+	ID        string
+	State     string
+	Submitter string // remote address of the client that submitted the job
+	Submitted time.Time
+	Finished  time.Time // zero until the job finishes
+	Runs      []Run     // runs completed so far, in order
+	Results   []Result  // results of the runs completed so far
+	Errors    []string  // errors of the runs completed so far, "" for success
+	Reasons   []string  // why each run was performed
+	Summary   []Summary // for campaigns, the statistics of each Batch run
+}
+
+// Summary summarizes the samples of a run in a campaign.
+type Summary struct {
+	Run       Run
+	Samples   int     // number of successful samples
+	Mean      float64 // mean ns/op
+	HalfWidth float64 // half-width of the 95% confidence interval for Mean, or zero if unknown
+
+	// Outliers, All, and Inliers are as in SampleResult,
+	// with Outliers indexing the successful samples in the order taken.
+	Outliers []int `json:",omitempty"`
+	All      SampleStats
+	Inliers  SampleStats
+}
+
+// A job is a Batch submitted to the server.
+type job struct {
+	srv    *Server // connection that submitted the job
+	batch  Batch
+	status JobStatus // guarded by server.mu
+
+	started  time.Time // when the job started running; guarded by server.mu
+	canceled bool      // CancelJob or CancelAll was called; guarded by server.mu
+
+	saves  int        // number of snapshots taken by save; guarded by server.mu
+	saveMu sync.Mutex // guards saved, and orders writes to the job store
+	saved  int        // number of the latest snapshot written
+}
+
+// Submit queues a batch of runs to be performed in the background,
+// so that the client need not stay connected while they run.
+// Jobs run one at a time, by Priority and then in the order submitted.
+// Submit rejects batches that fail Validate, and returns a Busy error
+// if -test.benchserve.maxqueue jobs are already waiting.
+// Use Job to check on a job's progress, or set a Webhook
+// to be notified when it finishes, and CancelJob to cancel it.
+//
+// Jobs do not depend on the connection that submitted them:
+// a client that disconnects can reconnect and fetch the results
+// with Job. With -test.benchserve.jobs, jobs also survive restarts
+// of the server, and unfinished jobs resume when it starts again.
+func (s *Server) Submit(args Batch, reply *JobID) error {
+	if args.ID != "" {
+		if err := checkJobID(args.ID); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		_, ok := s.jobs[args.ID]
+		s.mu.Unlock()
+		if ok {
+			reply.ID = args.ID
+			return nil
+		}
+	}
+	args, err := s.expand(args)
+	if err != nil {
+		return err
+	}
+	if err := s.validate(args).err(); err != nil {
+		return err
+	}
+	if args.Webhook == "" {
+		args.Webhook = *benchServeWebhook
+	}
+	id := args.ID
+	if id == "" {
+		if id, err = newJobID(); err != nil {
+			return err
+		}
+	}
+
+	j := &job{batch: args, status: JobStatus{ID: id, State: JobQueued, Submitted: time.Now()}}
+	j.srv = &Server{server: s.server, client: s.jobClient(), job: j}
+	j.status.Submitter = j.srv.client.addr
+	s.mu.Lock()
+	if _, ok := s.jobs[id]; ok {
+		// Submitted by another connection since the check above.
+		s.mu.Unlock()
+		reply.ID = id
+		return nil
+	}
+	if err := s.checkQueue(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if s.jobs == nil {
+		s.jobs = make(map[string]*job)
+		go s.runJobs()
+	}
+	s.jobs[id] = j
+	s.enqueue(j)
+	write := j.save()
+	s.jobCond.Signal()
+	s.mu.Unlock()
+	write()
+	reply.ID = id
+	return nil
+}
+
+// enqueue adds j to the job queue, after the jobs of the same
+// or higher priority. s.mu must be held.
+func (s *server) enqueue(j *job) {
+	i := len(s.jobQueue)
+	for i > 0 && s.jobQueue[i-1].batch.Priority < j.batch.Priority {
+		i--
+	}
+	s.jobQueue = append(s.jobQueue, nil)
+	copy(s.jobQueue[i+1:], s.jobQueue[i:])
+	s.jobQueue[i] = j
+}
+
+// Job reports the status of a job.
+func (s *Server) Job(args JobID, reply *JobStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[args.ID]
+	if !ok {
+		return fmt.Errorf("job %s not found", args.ID)
+	}
+	*reply = j.status.clone()
+	return nil
+}
+
+// CancelJob cancels a job. A queued job is removed from the queue.
+// A running job stops, and the run in progress, if any, is canceled
+// as by Cancel. The runs performed so far remain in the job's status,
+// whose State becomes JobCanceled once the job has stopped.
+func (s *Server) CancelJob(args JobID, reply *struct{}) error {
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[args.ID]
+	if !ok {
+		return fmt.Errorf("job %s not found", args.ID)
+	}
+	if !s.cancelJob(j) {
+		return fmt.Errorf("job %s has already finished", args.ID)
+	}
+	return nil
+}
+
+// JobFilter selects unfinished jobs. Empty fields select all jobs.
+type JobFilter struct {
+	State     string // JobQueued, JobRunning, or JobHeld
+	Submitter string // remote address or host of the client that submitted the job
+	Pattern   string // selects jobs with a run of a benchmark matching the pattern, as for -test.bench
+}
+
+// CanceledJobs lists the jobs canceled by CancelAll.
+type CanceledJobs struct {
+	IDs []string // sorted
+}
+
+// CancelAll cancels the unfinished jobs selected by args, as CancelJob does.
+func (s *Server) CancelAll(args JobFilter, reply *CanceledJobs) error {
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	m, err := newMatcher(args.Pattern)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, j := range s.jobs {
+		if args.State != "" && j.status.State != args.State {
+			continue
+		}
+		if args.Submitter != "" && j.status.Submitter != args.Submitter {
+			if host, _, err := net.SplitHostPort(j.status.Submitter); err != nil || host != args.Submitter {
+				continue
+			}
+		}
+		if args.Pattern != "" && !j.batch.hasRun(m) {
+			continue
+		}
+		if s.cancelJob(j) {
+			reply.IDs = append(reply.IDs, id)
+		}
+	}
+	sort.Strings(reply.IDs)
+	return nil
+}
+
+// hasRun reports whether b has a run of a benchmark matching m.
+func (b Batch) hasRun(m matcher) bool {
+	for _, run := range b.Runs {
+		if m.matches(run.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelJob cancels j, reporting false if it has already finished.
+// s.mu must be held.
+func (s *server) cancelJob(j *job) bool {
+	switch j.status.State {
+	case JobDone, JobFailed, JobCanceled:
+		return false
+	case JobQueued:
+		for i, k := range s.jobQueue {
+			if k == j {
+				s.jobQueue = append(s.jobQueue[:i], s.jobQueue[i+1:]...)
+				break
+			}
+		}
+		j.canceled = true
+		j.status.State = JobCanceled
+		j.status.Finished = time.Now()
+		write, status := j.save(), j.status.clone()
+		go func() {
+			write()
+			j.notify(status)
+		}()
+		return true
+	}
+	// The job stops at its next run, once held runs are woken.
+	j.canceled = true
+	if s.runningJob == j && s.cancel != nil {
+		s.cancel()
+	}
+	s.jobCond.Broadcast()
+	return true
+}
+
+// errJobCanceled is returned by perform for jobs that have been canceled.
+var errJobCanceled = errors.New("job canceled")
+
+// clone returns a copy of st that does not share its slices.
+func (st JobStatus) clone() JobStatus {
+	st.Runs = append([]Run(nil), st.Runs...)
+	st.Results = append([]Result(nil), st.Results...)
+	st.Errors = append([]string(nil), st.Errors...)
+	st.Reasons = append([]string(nil), st.Reasons...)
+	st.Summary = append([]Summary(nil), st.Summary...)
+	return st
+}
+
+// newJobID returns a new random job ID.
+func newJobID() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "job-" + hex.EncodeToString(b[:]), nil
+}
+
+// perform performs a single run for j and records it in j's status.
+func (j *job) perform(run Run, reason string) (Result, error) {
+	s := j.srv
+	j.giveWay()
+	var r Result
+	var err error
+	for {
+		s.mu.Lock()
+		s.hold(j)
+		canceled := j.canceled
+		s.mu.Unlock()
+		if canceled {
+			return Result{}, errJobCanceled
+		}
+		// Unlike Server.Run, skip the result cache:
+		// repeated runs of a job are meant as new samples.
+		r, err = s.run(run)
+		if err == errCanceled {
+			// As with Server.Run, r reports the cancellation.
+			err = nil
+		}
+		// Runs may have been held again since hold returned.
+		if _, held := err.(*Busy); !held {
+			break
+		}
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	s.mu.Lock()
+	j.status.Runs = append(j.status.Runs, run)
+	j.status.Results = append(j.status.Results, r)
+	j.status.Errors = append(j.status.Errors, msg)
+	j.status.Reasons = append(j.status.Reasons, reason)
+	write := j.save()
+	s.mu.Unlock()
+	write()
+	return r, err
+}
+
+// skip records in j's status that run i was not performed
+// because run k, which must precede it, failed.
+func (j *job) skip(i, k int) {
+	s := j.srv
+	s.mu.Lock()
+	j.status.Runs = append(j.status.Runs, j.batch.Runs[i])
+	j.status.Results = append(j.status.Results, Result{})
+	j.status.Errors = append(j.status.Errors, fmt.Sprintf("skipped: run %d failed", k))
+	j.status.Reasons = append(j.status.Reasons, fmt.Sprintf("ordered after run %d", k))
+	write := j.save()
+	s.mu.Unlock()
+	write()
+}
+
+// runJobs runs queued jobs, one at a time, forever.
+func (s *server) runJobs() {
+	for {
+		s.mu.Lock()
+		for len(s.jobQueue) == 0 {
+			s.jobCond.Wait()
+		}
+		j := s.jobQueue[0]
+		s.jobQueue = s.jobQueue[1:]
+		write := j.start()
+		s.mu.Unlock()
+		write()
+
+		j.run()
+	}
+}
+
+// start marks j, just taken from the queue, as running.
+// The caller must hold server.mu, and call write, as for save, once it is released.
+func (j *job) start() (write func()) {
+	j.status.State = JobRunning
+	j.started = time.Now()
+	return j.save()
+}
+
+// giveWay runs any queued jobs with higher priority than j,
+// which is running, before j continues.
+func (j *job) giveWay() {
+	s := j.srv
+	for {
+		s.mu.Lock()
+		if j.canceled || len(s.jobQueue) == 0 || s.jobQueue[0].batch.Priority <= j.batch.Priority {
+			s.mu.Unlock()
+			return
+		}
+		k := s.jobQueue[0]
+		s.jobQueue = s.jobQueue[1:]
+		j.status.State = JobHeld
+		write := j.save()
+		writeK := k.start()
+		s.mu.Unlock()
+		write()
+		writeK()
+
+		k.run()
+	}
+}
+
+// run performs j's runs and then notifies its webhook, if any.
+func (j *job) run() {
+	s := j.srv
+	var failed bool
+	if j.batch.Budget > 0 {
+		failed = j.campaign()
+	} else {
+		plan, _ := j.batch.plan() // checked by Submit
+		// done records which runs completed successfully.
+		done := make([]bool, len(j.batch.Runs))
+		s.mu.Lock()
+		errs := append([]string(nil), j.status.Errors...) // of runs performed before a restart, in plan order
+		s.mu.Unlock()
+		for n, i := range plan {
+			if n < len(errs) {
+				done[i] = errs[n] == ""
+				failed = failed || !done[i]
+				continue
+			}
+			// In plan order, runs that must precede i have been
+			// performed or skipped, so a blocker failed.
+			if k := j.batch.blocker(i, done); k >= 0 {
+				j.skip(i, k)
+				failed = true
+				continue
+			}
+			_, err := j.perform(j.batch.Runs[i], "requested")
+			if err == errJobCanceled {
+				break
+			}
+			done[i] = err == nil
+			failed = failed || err != nil
+		}
+	}
+
+	s.mu.Lock()
+	switch {
+	case j.canceled:
+		j.status.State = JobCanceled
+	case failed:
+		j.status.State = JobFailed
+	default:
+		j.status.State = JobDone
+	}
+	j.status.Finished = time.Now()
+	write := j.save()
+	status := j.status.clone()
+	s.mu.Unlock()
+	write()
+	j.notify(status)
+}
+
+// webhookClient posts to webhooks. It does not follow redirects,
+// which could lead a POST away from the allowed hosts.
+var webhookClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// notify posts status, j's final status, to j's webhook, if any.
+func (j *job) notify(status JobStatus) {
+	if j.batch.Webhook == "" {
+		return
+	}
+	buf, err := json.Marshal(status)
+	if err == nil {
+		err = post(webhookClient, j.batch.Webhook, "application/json", buf)
+	}
+	if err != nil {
+		logger.Warn("notify webhook", "job", status.ID, "err", err)
+	}
+}
@@ -0,0 +1,144 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A jobStore persists jobs as JSON files in the directory named by
+// -test.benchserve.jobs, so that they survive restarts of the server.
+type jobStore struct {
+	dir string
+}
+
+// storedJob is the form of a job in a jobStore.
+type storedJob struct {
+	Batch  Batch
+	Status JobStatus
+}
+
+// write writes buf, the stored form of the job with the given ID, to the store.
+func (st *jobStore) write(id string, buf []byte) {
+	// Write and rename, so that a crash leaves the previous state.
+	file := filepath.Join(st.dir, id+".json")
+	tmp := file + ".tmp"
+	err := os.WriteFile(tmp, buf, 0o644)
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		logger.Warn("save job", "job", id, "err", err)
+	}
+}
+
+// save takes a snapshot of j's state, if jobs are persisted,
+// and returns a function that writes it to the store.
+// The caller must hold server.mu, and must call write once it has
+// released it, so that disk I/O does not hold up other requests.
+// A snapshot written after a later one is discarded.
+func (j *job) save() (write func()) {
+	st := j.srv.jobStore
+	if st == nil {
+		return func() {}
+	}
+	j.saves++
+	seq, id := j.saves, j.status.ID
+	buf, err := json.Marshal(storedJob{Batch: j.batch, Status: j.status})
+	if err != nil {
+		logger.Warn("save job", "job", id, "err", err)
+		return func() {}
+	}
+	return func() {
+		j.saveMu.Lock()
+		defer j.saveMu.Unlock()
+		if seq > j.saved {
+			j.saved = seq
+			st.write(id, buf)
+		}
+	}
+}
+
+// openJobStore opens the job store requested by flags, if any,
+// and restores its jobs. Jobs that had not finished are queued again,
+// by priority and then in the order submitted. A job's runs that completed are kept,
+// and the job continues after them, except that campaigns start over.
+func (s *server) openJobStore() error {
+	if *benchServeJobs == "" {
+		return nil
+	}
+	st := &jobStore{dir: *benchServeJobs}
+	if err := os.MkdirAll(st.dir, 0o755); err != nil {
+		return err
+	}
+	s.jobStore = st
+	files, err := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	c := &client{addr: "restored"}
+	s.jobs = make(map[string]*job)
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var sj storedJob
+		if err := json.Unmarshal(buf, &sj); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		j := &job{batch: sj.Batch, status: sj.Status}
+		j.srv = &Server{server: s, client: c, job: j}
+		s.jobs[j.status.ID] = j
+		if j.status.State == JobDone || j.status.State == JobFailed || j.status.State == JobCanceled {
+			continue
+		}
+		if j.batch.Budget > 0 {
+			j.status = JobStatus{ID: j.status.ID, Submitter: j.status.Submitter, Submitted: j.status.Submitted}
+		}
+		// The file may be corrupt, or the benchmarks may have changed.
+		err = j.srv.validate(j.batch).err()
+		if err == nil && len(j.status.Runs) > len(j.batch.Runs) {
+			err = fmt.Errorf("%d runs done of %d", len(j.status.Runs), len(j.batch.Runs))
+		}
+		if err != nil {
+			logger.Warn("not resuming job", "job", j.status.ID, "err", err)
+			j.status.State, j.status.Finished = JobFailed, time.Now()
+			s.mu.Lock()
+			write := j.save()
+			s.mu.Unlock()
+			write()
+			continue
+		}
+		j.status.State = JobQueued
+		s.jobQueue = append(s.jobQueue, j)
+	}
+	sort.Slice(s.jobQueue, func(i, k int) bool {
+		a, b := s.jobQueue[i], s.jobQueue[k]
+		if a.batch.Priority != b.batch.Priority {
+			return a.batch.Priority > b.batch.Priority
+		}
+		return a.status.Submitted.Before(b.status.Submitted)
+	})
+	if len(s.jobQueue) > 0 {
+		logger.Info("resuming jobs", "count", len(s.jobQueue))
+	}
+	go s.runJobs()
+	return nil
+}
+
+// checkJobID checks that a client-chosen job ID is usable as a file name.
+func checkJobID(id string) error {
+	bad := len(id) > 64 || strings.HasPrefix(id, ".") || strings.ContainsFunc(id, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || strings.ContainsRune("._-", r))
+	})
+	if bad {
+		return fmt.Errorf("bad job ID %q: want up to 64 letters, digits, dots, dashes, and underscores", id)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package benchserve
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// checkLabels checks that labels can be written as benchfmt configuration
+// lines: keys must start with a lower-case letter and contain no spaces,
+// upper-case letters, or colons, and values must not contain newlines.
+func checkLabels(labels map[string]string) error {
+	for _, k := range sortedKeys(labels) {
+		bad := k == "" || !unicode.IsLower([]rune(k)[0]) || strings.ContainsFunc(k, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsUpper(r) || r == ':'
+		})
+		if bad {
+			return fmt.Errorf("bad label key %q: want a lower-case word", k)
+		}
+		if strings.ContainsAny(labels[k], "\r\n") {
+			return fmt.Errorf("label %s: value contains a newline", k)
+		}
+	}
+	return nil
+}
+
+// withLabels returns run with the labels added,
+// except those that run already sets.
+func withLabels(run Run, labels map[string]string) Run {
+	if len(labels) == 0 {
+		return run
+	}
+	m := make(map[string]string, len(labels)+len(run.Labels))
+	for k, v := range labels {
+		m[k] = v
+	}
+	for k, v := range run.Labels {
+		m[k] = v
+	}
+	run.Labels = m
+	return run
+}
+
+// profileLabels returns the pprof labels applied to the goroutines
+// running run, so that CPU profiles of the whole process, such as
+// those collected by a continuous profiler, can be sliced by run:
+// the run's Labels, such as experiment=X, and its benchmark, N, and procs.
+func profileLabels(run Run) pprof.LabelSet {
+	kv := make([]string, 0, 2*len(run.Labels)+6)
+	for _, k := range sortedKeys(run.Labels) {
+		kv = append(kv, k, run.Labels[k])
+	}
+	kv = append(kv, "benchmark", run.Name, "n", strconv.Itoa(run.N), "procs", strconv.Itoa(run.Procs))
+	return pprof.Labels(kv...)
+}
+
+// benchfmtLabels appends to buf the benchfmt configuration lines
+// that change the labels in effect from old to new.
+// In benchfmt, a configuration line with an empty value removes the key.
+func benchfmtLabels(buf *bytes.Buffer, old, new map[string]string) {
+	for _, k := range sortedKeys(old) {
+		if _, ok := new[k]; !ok {
+			fmt.Fprintf(buf, "%s:\n", k)
+		}
+	}
+	for _, k := range sortedKeys(new) {
+		if v, ok := old[k]; !ok || v != new[k] {
+			fmt.Fprintf(buf, "%s: %s\n", k, new[k])
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package benchserve
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// lease tracks exclusive use of the server by a single client.
+// Its fields are guarded by server.mu.
+type lease struct {
+	holder  *client     // client holding the lease, or nil
+	expires time.Time   // when holder's lease expires
+	timer   *time.Timer // fires at expires
+	queue   []*client   // clients waiting for the lease, in order
+	cond    *sync.Cond  // broadcast when holder or queue changes
+}
+
+// Lock requests exclusive use of the server.
+type Lock struct {
+	// TTL is how long the lease lasts unless renewed, default 1m.
+	// A lease also ends when its holder releases it or disconnects.
+	TTL time.Duration
+}
+
+// Lease describes a held lease.
+type Lease struct {
+	Expires time.Time // when the lease expires unless renewed
+}
+
+// Lock acquires a lease granting this connection exclusive use of the server.
+// While another client holds a lease, Lock waits in line behind any
+// other waiting clients. Calling Lock while holding the lease renews it.
+//
+// While a lease is held, attempts by other clients to run benchmarks fail
+// with an error identifying the holder. Clients that never call Lock
+// can run benchmarks whenever the server is not leased.
+func (s *Server) Lock(args Lock, reply *Lease) error {
+	ttl := args.TTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := &s.lease
+	if l.holder != s.client {
+		l.queue = append(l.queue, s.client)
+		for l.holder != nil || l.queue[0] != s.client {
+			l.cond.Wait()
+		}
+		l.queue = l.queue[1:]
+		l.holder = s.client
+		l.cond.Broadcast()
+	}
+
+	l.expires = time.Now().Add(ttl)
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(ttl, s.expireLease)
+	reply.Expires = l.expires
+	return nil
+}
+
+// Release gives up this connection's lease, if it holds one.
+func (s *Server) Release(args struct{}, reply *struct{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lease.holder == s.client {
+		s.releaseLease()
+	}
+	return nil
+}
+
+// checkLease returns an error if another client holds a lease.
+func (s *Server) checkLease() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := &s.lease
+	if l.holder == nil || l.holder == s.client {
+		return nil
+	}
+	return fmt.Errorf("server is leased by %s until %v", l.holder.addr, l.expires.Format(time.RFC3339))
+}
+
+// expireLease ends the current lease if it has expired.
+func (s *server) expireLease() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lease.holder != nil && !time.Now().Before(s.lease.expires) {
+		s.releaseLease()
+	}
+}
+
+// releaseLease ends the current lease. s.mu must be held.
+func (s *server) releaseLease() {
+	l := &s.lease
+	l.holder = nil
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.cond.Broadcast()
+}
+
+// disconnect releases any lease held by c once it has disconnected.
+func (s *server) disconnect(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lease.holder == c {
+		s.releaseLease()
+	}
+	if c.sess != nil {
+		s.leave(c.sess)
+	}
+}
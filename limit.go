@@ -0,0 +1,158 @@
+package benchserve
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Busy is the error with which the server declines a request
+// because a limit set by -test.benchserve.maxqueue or
+// -test.benchserve.ratelimit has been reached.
+// Clients receive it as an rpc.ServerError; use IsBusy to recover it.
+type Busy struct {
+	Reason     string        // the limit reached, such as "4 jobs queued"
+	RetryAfter time.Duration // how long to wait before trying again
+}
+
+const (
+	busyPrefix     = "server busy: "
+	busyRetryAfter = "; retry after "
+)
+
+func (e *Busy) Error() string {
+	return busyPrefix + e.Reason + busyRetryAfter + e.RetryAfter.String()
+}
+
+// IsBusy reports whether err is a Busy error returned by the server
+// and, if so, returns it.
+func IsBusy(err error) (*Busy, bool) {
+	if err == nil {
+		return nil, false
+	}
+	if b, ok := err.(*Busy); ok {
+		return b, true
+	}
+	msg, ok := strings.CutPrefix(err.Error(), busyPrefix)
+	if !ok {
+		return nil, false
+	}
+	i := strings.LastIndex(msg, busyRetryAfter)
+	if i < 0 {
+		return nil, false
+	}
+	d, err := time.ParseDuration(msg[i+len(busyRetryAfter):])
+	if err != nil {
+		return nil, false
+	}
+	return &Busy{Reason: msg[:i], RetryAfter: d}, true
+}
+
+// defaultRetryAfter is the RetryAfter of a full job queue
+// before any job has finished.
+const defaultRetryAfter = 10 * time.Second
+
+// checkQueue returns a Busy error if the job queue is full.
+// s.mu must be held.
+func (s *server) checkQueue() error {
+	if *benchServeMaxQueue <= 0 || len(s.jobQueue) < *benchServeMaxQueue {
+		return nil
+	}
+	// A slot opens when a job finishes; guess that it takes
+	// as long as those that have finished so far.
+	var total time.Duration
+	var n int
+	for _, j := range s.jobs {
+		if !j.started.IsZero() && !j.status.Finished.IsZero() {
+			total += j.status.Finished.Sub(j.started)
+			n++
+		}
+	}
+	retry := defaultRetryAfter
+	if n > 0 {
+		retry = (total / time.Duration(n)).Round(time.Second)
+		if retry < time.Second {
+			retry = time.Second
+		}
+	}
+	return &Busy{Reason: fmt.Sprintf("%d jobs queued", len(s.jobQueue)), RetryAfter: retry}
+}
+
+// A rateLimiter limits the number of requests each client host
+// may make per minute. Hosts rather than addresses are limited,
+// so that reconnecting does not evade the limit.
+type rateLimiter struct {
+	limit int
+
+	mu   sync.Mutex
+	seen map[string][]time.Time // times of each host's requests in the last minute, oldest first
+}
+
+// newRateLimiter returns a limiter for the -test.benchserve.ratelimit flag,
+// or nil if it is not set.
+func newRateLimiter() *rateLimiter {
+	if *benchServeRateLimit <= 0 {
+		return nil
+	}
+	return &rateLimiter{limit: *benchServeRateLimit, seen: make(map[string][]time.Time)}
+}
+
+// allow records a request from host at time now,
+// or returns a Busy error if host has reached its limit.
+func (l *rateLimiter) allow(host string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Forget requests more than a minute old, and hosts with none left.
+	for h, times := range l.seen {
+		i := 0
+		for i < len(times) && now.Sub(times[i]) >= time.Minute {
+			i++
+		}
+		if i == len(times) {
+			delete(l.seen, h)
+		} else {
+			l.seen[h] = times[i:]
+		}
+	}
+	times := l.seen[host]
+	if len(times) >= l.limit {
+		retry := times[0].Add(time.Minute).Sub(now).Round(time.Second)
+		if retry < time.Second {
+			retry = time.Second
+		}
+		return &Busy{Reason: fmt.Sprintf("more than %d requests per minute", l.limit), RetryAfter: retry}
+	}
+	l.seen[host] = append(times, now)
+	return nil
+}
+
+// A limitCodec declines requests beyond a client's rate limit.
+type limitCodec struct {
+	rpc.ServerCodec
+	host    string
+	limiter *rateLimiter
+}
+
+// ReadRequestBody reads the body and then applies the limit;
+// the rpc package responds to the request with the error.
+func (c *limitCodec) ReadRequestBody(body interface{}) error {
+	if err := c.ServerCodec.ReadRequestBody(body); err != nil || body == nil {
+		return err
+	}
+	return c.limiter.allow(c.host, time.Now())
+}
+
+// limit returns c limited by limiter, if any, for the client at addr.
+func limit(c rpc.ServerCodec, addr string, limiter *rateLimiter) rpc.ServerCodec {
+	if limiter == nil {
+		return c
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return &limitCodec{ServerCodec: c, host: host, limiter: limiter}
+}
@@ -0,0 +1,55 @@
+package benchserve
+
+import (
+	"errors"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := &rateLimiter{limit: 2, seen: make(map[string][]time.Time)}
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		host  string
+		after time.Duration
+		retry time.Duration // zero if allowed
+	}{
+		{"a", 0, 0},
+		{"a", 10 * time.Second, 0},
+		{"a", 20 * time.Second, 40 * time.Second},
+		{"b", 20 * time.Second, 0}, // hosts are limited separately
+		{"a", 59 * time.Second, time.Second},
+		{"a", 60 * time.Second, 0}, // the first request has expired
+		{"a", 61 * time.Second, 9 * time.Second},
+		{"a", 130 * time.Second, 0}, // all have expired
+	} {
+		err := l.allow(tt.host, t0.Add(tt.after))
+		b, busy := IsBusy(err)
+		switch {
+		case tt.retry == 0 && err != nil:
+			t.Errorf("%s at +%v: %v, want allowed", tt.host, tt.after, err)
+		case tt.retry != 0 && (!busy || b.RetryAfter != tt.retry):
+			t.Errorf("%s at +%v: %v, want Busy retrying after %v", tt.host, tt.after, err, tt.retry)
+		}
+	}
+	if _, ok := l.seen["b"]; ok {
+		t.Errorf("host b still tracked after its requests expired")
+	}
+}
+
+func TestIsBusy(t *testing.T) {
+	want := &Busy{Reason: "4 jobs queued", RetryAfter: 90 * time.Second}
+	// As received by a client.
+	for _, err := range []error{want, rpc.ServerError(want.Error())} {
+		b, ok := IsBusy(err)
+		if !ok || *b != *want {
+			t.Errorf("IsBusy(%v) = %+v, %v; want %+v", err, b, ok, want)
+		}
+	}
+	for _, err := range []error{nil, errors.New("server busy: no retry"), errors.New("boom")} {
+		if b, ok := IsBusy(err); ok {
+			t.Errorf("IsBusy(%v) = %+v, want not busy", err, b)
+		}
+	}
+}
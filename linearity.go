@@ -0,0 +1,69 @@
+package benchserve
+
+import "fmt"
+
+// Linearity requests a check that a benchmark's ns/op does not depend on b.N.
+type Linearity struct {
+	Name  string // name of the benchmark to check
+	Procs int    // GOMAXPROCS value, equivalent to -test.cpu
+
+	// Ns lists the iteration counts to run, default 100, 1000, 10000.
+	Ns []int
+
+	// Tolerance is the largest acceptable relative difference
+	// between the fastest and slowest ns/op, default 0.1 (10%).
+	Tolerance float64
+}
+
+// LinearityResult is the result of a Linearity check.
+type LinearityResult struct {
+	Runs   []Result // one run for each requested N, in order
+	Spread float64  // (max ns/op - min ns/op) / min ns/op across Runs
+
+	// Linear reports whether Spread is within the requested Tolerance.
+	// A benchmark that is not linear usually has setup that is not
+	// excluded from timing by b.ResetTimer, or its per-iteration
+	// cost grows with b.N.
+	Linear bool
+}
+
+// Linearity runs a benchmark at several iteration counts
+// and reports whether its ns/op changes materially with N.
+func (s *Server) Linearity(args Linearity, reply *LinearityResult) error {
+	ns := args.Ns
+	if len(ns) == 0 {
+		ns = []int{100, 1000, 10000}
+	}
+	tol := args.Tolerance
+	if tol <= 0 {
+		tol = 0.1
+	}
+
+	for _, n := range ns {
+		if n <= 0 {
+			return fmt.Errorf("invalid N %d", n)
+		}
+	}
+
+	var lo, hi float64
+	for i, n := range ns {
+		r, err := s.run(Run{Name: args.Name, Procs: args.Procs, N: n})
+		if err != nil {
+			return err
+		}
+		reply.Runs = append(reply.Runs, r)
+		v := nsPerOp(r)
+		if i == 0 || v < lo {
+			lo = v
+		}
+		if i == 0 || v > hi {
+			hi = v
+		}
+	}
+
+	if lo > 0 {
+		reply.Spread = (hi - lo) / lo
+	}
+	reply.Linear = reply.Spread <= tol
+	return nil
+}
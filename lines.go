@@ -0,0 +1,255 @@
+package benchserve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The server's native protocol is newline-delimited JSON.
+// Each request is a LineRequest and each response a LineResponse,
+// one JSON value per line, in either direction. Requests on a connection
+// are served concurrently, as in JSON-RPC, and responses may arrive
+// in any order; match them to requests by ID.
+//
+// For existing drivers, the server also speaks JSON-RPC, as implemented
+// by net/rpc/jsonrpc, and MessagePack-RPC on the same port.
+// It tells the protocols apart by a connection's first request:
+// MessagePack-RPC requests begin with byte 0x94, and JSON-RPC requests
+// have an array of params, while LineRequest params are an object.
+
+// A LineRequest is a request in the JSON-lines protocol.
+type LineRequest struct {
+	ID     json.RawMessage `json:"id"`     // any JSON value, echoed in the response
+	Method string          `json:"method"` // such as "Run" or "Server.Run"
+	Params json.RawMessage `json:"params"` // the method's argument; omitted means its zero value
+}
+
+// A LineResponse is a response in the JSON-lines protocol.
+type LineResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result interface{}     `json:"result,omitempty"` // absent if Error is set
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// An Error is a failed request's error in the JSON-lines protocol.
+type Error struct {
+	Code       string        `json:"code"` // one of the Err constants
+	Message    string        `json:"message"`
+	RetryAfter time.Duration `json:"retryAfter,omitempty"` // for ErrBusy, how long to wait before trying again
+}
+
+// Error codes.
+const (
+	ErrBadRequest    = "bad_request"    // the request could not be decoded
+	ErrUnknownMethod = "unknown_method" // there is no such method
+	ErrBusy          = "busy"           // a limit was reached, as described at Busy
+	ErrFailed        = "failed"         // the method returned an error
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// newError returns the Error for err, returned by a method.
+func newError(err error) *Error {
+	if b, ok := IsBusy(err); ok {
+		return &Error{Code: ErrBusy, Message: err.Error(), RetryAfter: b.RetryAfter}
+	}
+	return &Error{Code: ErrFailed, Message: err.Error()}
+}
+
+// An rpcMethod is a method of Server served to clients.
+type rpcMethod struct {
+	name        string
+	fn          reflect.Value // func(*Server, args, *reply) error
+	args, reply reflect.Type  // reply is not a pointer
+}
+
+var (
+	rpcMethodsOnce sync.Once
+	rpcMethodList  []rpcMethod
+)
+
+// rpcMethods returns the methods of Server that have the form
+// required by net/rpc, which are those served to clients.
+func rpcMethods() []rpcMethod {
+	rpcMethodsOnce.Do(func() {
+		errorType := reflect.TypeOf((*error)(nil)).Elem()
+		t := reflect.TypeOf(&Server{})
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			mt := m.Type
+			if mt.NumIn() != 3 || mt.NumOut() != 1 || mt.Out(0) != errorType || mt.In(2).Kind() != reflect.Pointer {
+				continue
+			}
+			rpcMethodList = append(rpcMethodList, rpcMethod{name: m.Name, fn: m.Func, args: mt.In(1), reply: mt.In(2).Elem()})
+		}
+	})
+	return rpcMethodList
+}
+
+// findMethod returns the method named name, with or without a "Server." prefix.
+func findMethod(name string) (rpcMethod, bool) {
+	name = strings.TrimPrefix(name, "Server.")
+	for _, m := range rpcMethods() {
+		if m.name == name {
+			return m, true
+		}
+	}
+	return rpcMethod{}, false
+}
+
+// A protocol is the protocol spoken on a connection.
+type protocol int
+
+const (
+	protoLines protocol = iota
+	protoJSONRPC
+	protoMsgpack
+)
+
+// sniff determines the protocol of conn from its first request.
+// It returns a reader from which to read conn, starting at that request.
+func sniff(conn net.Conn) (*bufio.Reader, protocol) {
+	br := bufio.NewReader(conn)
+	b, err := br.Peek(1)
+	if err != nil {
+		return br, protoLines
+	}
+	if b[0] == msgpackRequest {
+		return br, protoMsgpack
+	}
+	dec := json.NewDecoder(br)
+	var first struct {
+		Params json.RawMessage `json:"params"`
+	}
+	var raw json.RawMessage
+	err = dec.Decode(&raw)
+	r := bufio.NewReader(io.MultiReader(bytes.NewReader(raw), dec.Buffered(), br))
+	if err == nil && json.Unmarshal(raw, &first) == nil && bytes.HasPrefix(first.Params, []byte("[")) {
+		return r, protoJSONRPC
+	}
+	return r, protoLines
+}
+
+// A lineConn serves the JSON-lines protocol on a connection.
+type lineConn struct {
+	srv     *Server
+	conn    net.Conn
+	addr    string
+	host    string // for rate limiting
+	timeout time.Duration
+
+	mu      sync.Mutex // guards writes and pending
+	pending int        // requests read but not yet responded to
+}
+
+// serveLines serves the JSON-lines protocol to srv's client on conn,
+// reading from r, until the client disconnects.
+func (s *server) serveLines(srv *Server, conn net.Conn, r io.Reader) {
+	c := &lineConn{srv: srv, conn: conn, addr: conn.RemoteAddr().String(), timeout: *benchServeIdleTimeout}
+	c.host, _, _ = net.SplitHostPort(c.addr)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	dec := json.NewDecoder(r)
+	for {
+		var req LineRequest
+		err := dec.Decode(&req)
+		if err != nil {
+			var syntax *json.SyntaxError
+			var typ *json.UnmarshalTypeError
+			if errors.As(err, &syntax) || errors.As(err, &typ) {
+				// The stream cannot be resynchronized.
+				c.respond(LineResponse{Error: &Error{Code: ErrBadRequest, Message: err.Error()}})
+			}
+			return
+		}
+		c.mu.Lock()
+		c.pending++
+		c.conn.SetReadDeadline(time.Time{})
+		c.mu.Unlock()
+		wg.Add(1)
+		go func(req LineRequest) {
+			defer wg.Done()
+			c.serve(req)
+		}(req)
+	}
+}
+
+// serve serves req, recording it in the audit log and recording, if any.
+func (c *lineConn) serve(req LineRequest) {
+	s := c.srv
+	e := AuditEntry{Time: time.Now(), Client: c.addr, Method: req.Method}
+	resp := LineResponse{ID: req.ID}
+	m, ok := findMethod(req.Method)
+	if ok {
+		e.Method = "Server." + m.name
+	}
+	e.Params = auditParams(e.Method, req.Params)
+	if s.limiter != nil {
+		if err := s.limiter.allow(c.host, e.Time); err != nil {
+			resp.Error = newError(err)
+		}
+	}
+	switch {
+	case resp.Error != nil:
+	case !ok:
+		resp.Error = &Error{Code: ErrUnknownMethod, Message: "unknown method " + req.Method}
+	default:
+		args := reflect.New(m.args)
+		if len(req.Params) > 0 && !bytes.Equal(req.Params, []byte("null")) {
+			if err := json.Unmarshal(req.Params, args.Interface()); err != nil {
+				resp.Error = &Error{Code: ErrBadRequest, Message: err.Error()}
+				break
+			}
+		}
+		reply := reflect.New(m.reply)
+		out := m.fn.Call([]reflect.Value{reflect.ValueOf(s), args.Elem(), reply})
+		if err, _ := out[0].Interface().(error); err != nil {
+			resp.Error = newError(err)
+		} else {
+			resp.Result = reply.Interface()
+		}
+	}
+	c.respond(resp)
+
+	e.Duration = time.Since(e.Time)
+	if resp.Error != nil {
+		e.Error = resp.Error.Message
+	}
+	s.audit.served(e)
+	s.audit.traffic.add(Exchange{Time: e.Time, Client: e.Client, Method: e.Method, Duration: e.Duration, Params: req.Params, Error: resp.Error}, resp.Result)
+}
+
+// respond writes resp to the client.
+func (c *lineConn) respond(resp LineResponse) {
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		buf, _ = json.Marshal(LineResponse{ID: resp.ID, Error: &Error{Code: ErrFailed, Message: err.Error()}})
+	}
+	buf = append(buf, '\n')
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	if _, err := c.conn.Write(buf); err != nil && logger.Enabled(context.Background(), slog.LevelDebug) {
+		logger.Debug("write response", "client", c.addr, "err", err)
+	}
+	if c.pending > 0 {
+		c.pending--
+	}
+	if c.pending == 0 && c.timeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+}
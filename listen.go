@@ -0,0 +1,158 @@
+package benchserve
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// listenAddr returns the address to listen on.
+// Listening on all interfaces requires opting in,
+// either with -test.benchserve.expose or an explicit address.
+func listenAddr() string {
+	switch {
+	case *benchServeAddr != "":
+		return *benchServeAddr
+	case *benchServeExpose:
+		return ":52525"
+	}
+	return "127.0.0.1:52525"
+}
+
+// listen creates the server's listener, as configured by flags.
+// It also returns the underlying TCP listener, which differs if TLS is enabled.
+// A server started by Reload or Restart reuses its predecessor's TCP listener,
+// and one started by systemd socket activation uses the socket it is passed.
+func listen() (l net.Listener, tcp *net.TCPListener, err error) {
+	if tcp, err = inheritedListener(); err != nil {
+		return nil, nil, err
+	}
+	if tcp == nil {
+		if tcp, err = activatedListener(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if tcp == nil {
+		addr := listenAddr()
+		lc := net.ListenConfig{KeepAlive: *benchServeKeepAlive}
+		l, err := lc.Listen(context.Background(), "tcp", addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("listen %v: %v", addr, err)
+		}
+		tcp = l.(*net.TCPListener)
+	}
+	if *benchServeTLSCert == "" && *benchServeTLSKey == "" {
+		if *benchServeTLSClientCA != "" {
+			tcp.Close()
+			return nil, nil, fmt.Errorf("-test.benchserve.tlsclientca requires -test.benchserve.tlscert")
+		}
+		return tcp, tcp, nil
+	}
+	config, err := tlsConfig()
+	if err != nil {
+		tcp.Close()
+		return nil, nil, err
+	}
+	return tls.NewListener(tcp, config), tcp, nil
+}
+
+// tlsConfig loads the TLS configuration specified by flags.
+func tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(*benchServeTLSCert, *benchServeTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if *benchServeTLSClientCA != "" {
+		pem, err := os.ReadFile(*benchServeTLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("load TLS client CA: no certificates found in %s", *benchServeTLSClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Announcement describes a listening benchmark server.
+type Announcement struct {
+	Name    string `json:",omitempty"` // name set by -test.benchserve.announce, if any
+	Addr    string // address the server is listening on
+	PID     int    // process ID of the server
+	Package string // import path of the package under test
+	Binary  string // hash of the test binary, as in HistoryResult
+}
+
+// announcement returns the Announcement for a server listening on l.
+func (s *server) announcement(l net.Listener) Announcement {
+	return Announcement{
+		Name:    *benchServeAnnounce,
+		Addr:    l.Addr().String(),
+		PID:     os.Getpid(),
+		Package: s.pkgPath(),
+		Binary:  binaryHash(),
+	}
+}
+
+// pkgPath returns the import path of the package under test,
+// as determined from its benchmark, test, and fuzz functions.
+func (s *server) pkgPath() string {
+	var fn interface{}
+	for _, b := range s.m {
+		fn = b.F
+		break
+	}
+	if fn == nil && len(s.tests) > 0 {
+		fn = s.tests[0].F
+	}
+	if fn == nil && len(s.fuzz) > 0 {
+		fn = s.fuzz[0].Fn
+	}
+	if fn == nil {
+		return ""
+	}
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return ""
+	}
+	return strings.TrimSuffix(funcPackage(f.Name()), "_test")
+}
+
+// announce prints a to stdout as a line of JSON,
+// and writes it to -test.benchserve.portfile if requested.
+func announce(a Announcement) error {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	os.Stdout.Write(buf)
+	reportDaemon(buf)
+
+	if *benchServePortfile == "" {
+		return nil
+	}
+	// Write and rename, so that no one sees a partial file.
+	tmp := *benchServePortfile + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return fmt.Errorf("write portfile: %v", err)
+	}
+	if err := os.Rename(tmp, *benchServePortfile); err != nil {
+		return fmt.Errorf("write portfile: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package benchserve
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger is the server's log.
+// It is configured by -test.benchserve.v and -test.benchserve.logfile.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// setupLogger configures logger as requested by flags.
+func setupLogger() error {
+	w := os.Stderr
+	if *benchServeLogfile != "" {
+		f, err := os.OpenFile(*benchServeLogfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	level := slog.LevelInfo
+	if *benchServeV {
+		level = slog.LevelDebug
+	}
+	logger = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+	return nil
+}
+
+// fatal logs msg and args at level Error, then exits.
+func fatal(msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
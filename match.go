@@ -0,0 +1,97 @@
+package benchserve
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A matcher matches benchmark names the way -test.bench does.
+// The pattern is split on slashes (outside of brackets and parentheses)
+// into one regular expression per level of sub-benchmark,
+// and top-level alternations split it into separate such lists.
+type matcher [][]*regexp.Regexp
+
+// newMatcher compiles pattern. The empty pattern matches everything.
+func newMatcher(pattern string) (matcher, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	var m matcher
+	for _, alt := range splitPattern(pattern) {
+		var levels []*regexp.Regexp
+		for _, s := range alt {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+			}
+			levels = append(levels, re)
+		}
+		m = append(m, levels)
+	}
+	return m, nil
+}
+
+// matches reports whether the benchmark with the given slash-separated name matches m.
+// As with -test.bench, a name with fewer levels than the pattern matches
+// if all of its levels do, because it might contain matching sub-benchmarks.
+func (m matcher) matches(name string) bool {
+	if m == nil {
+		return true
+	}
+	elems := strings.Split(name, "/")
+alt:
+	for _, levels := range m {
+		for i, elem := range elems {
+			if i >= len(levels) {
+				break
+			}
+			if !levels[i].MatchString(elem) {
+				continue alt
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// splitPattern splits s into alternatives, each of which is a list
+// of per-level regular expressions. It mirrors the testing package.
+func splitPattern(s string) [][]string {
+	var alts [][]string
+	var levels []string
+	brackets, parens := 0, 0
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '[':
+			brackets++
+		case ']':
+			if brackets--; brackets < 0 { // An unmatched ']' is legal.
+				brackets = 0
+			}
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case '/', '|':
+			if brackets == 0 && parens == 0 {
+				levels = append(levels, s[:i])
+				if s[i] == '|' {
+					alts = append(alts, levels)
+					levels = nil
+				}
+				s = s[i+1:]
+				i = 0
+				continue
+			}
+		}
+		i++
+	}
+	return append(alts, append(levels, s))
+}
@@ -0,0 +1,80 @@
+package benchserve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		want    [][]string
+	}{
+		{"Foo", [][]string{{"Foo"}}},
+		{"Foo/bar", [][]string{{"Foo", "bar"}}},
+		{"Foo|Bar/x", [][]string{{"Foo"}, {"Bar", "x"}}},
+		{"Foo/", [][]string{{"Foo", ""}}},
+		{"(Foo|Bar)/x", [][]string{{"(Foo|Bar)", "x"}}},
+		{"[/|]x", [][]string{{"[/|]x"}}},
+		{`a\/b`, [][]string{{`a\/b`}}},
+		{"a]/b", [][]string{{"a]", "b"}}},
+	} {
+		if got := splitPattern(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitPattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"", "BenchmarkFoo", true},
+		{"Foo", "BenchmarkFoo", true},
+		{"Foo", "BenchmarkBar", false},
+		{"^Foo", "BenchmarkFoo", false},
+		{"Foo|Bar", "BenchmarkBar", true},
+		{"Foo/small", "BenchmarkFoo/small", true},
+		{"Foo/small", "BenchmarkFoo/large", false},
+		// A benchmark may have matching sub-benchmarks.
+		{"Foo/small", "BenchmarkFoo", true},
+		{"Foo/small", "BenchmarkBar", false},
+		// Extra levels are not constrained.
+		{"Foo", "BenchmarkFoo/large", true},
+		{"Foo/small|Bar", "BenchmarkBar/large", true},
+		{"(Foo|Bar)/small", "BenchmarkBar/small", true},
+		{"(Foo|Bar)/small", "BenchmarkBar/large", false},
+	} {
+		m, err := newMatcher(tt.pattern)
+		if err != nil {
+			t.Fatalf("newMatcher(%q): %v", tt.pattern, err)
+		}
+		if got := m.matches(tt.name); got != tt.want {
+			t.Errorf("pattern %q matches %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+	if _, err := newMatcher("Foo/["); err == nil {
+		t.Errorf(`newMatcher("Foo/[") succeeded, want error`)
+	}
+}
+
+func TestListMatches(t *testing.T) {
+	for _, tt := range []struct {
+		l    List
+		tags []string
+		want bool
+	}{
+		{List{}, nil, true},
+		{List{Tags: []string{"slow"}}, nil, false},
+		{List{Tags: []string{"slow"}}, []string{"io", "slow"}, true},
+		{List{Tags: []string{"io", "slow"}}, []string{"slow"}, false},
+		{List{Pattern: "Bar", Tags: []string{"slow"}}, []string{"slow"}, false},
+	} {
+		got, err := tt.l.Matches("BenchmarkFoo", tt.tags)
+		if err != nil || got != tt.want {
+			t.Errorf("%+v.Matches(BenchmarkFoo, %q) = %v, %v; want %v", tt.l, tt.tags, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package benchserve
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// serveMetrics serves server health and results
+// in the Prometheus text exposition format.
+func (s *server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	running := 0
+	if s.running != "" {
+		running = 1
+	}
+	queue := s.waiting + len(s.lease.queue)
+	runs := s.runs
+	var keys []runKey
+	latest := make(map[runKey]float64, len(s.latest))
+	for k, v := range s.latest {
+		keys = append(keys, k)
+		latest[k] = v
+	}
+	s.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].procs < keys[j].procs
+	})
+
+	var buf bytes.Buffer
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("benchserve_uptime_seconds", "gauge", "Time since the server started.")
+	fmt.Fprintf(&buf, "benchserve_uptime_seconds %g\n", time.Since(s.startTime).Seconds())
+	metric("benchserve_runs_total", "counter", "Benchmark runs completed.")
+	fmt.Fprintf(&buf, "benchserve_runs_total %d\n", runs)
+	metric("benchserve_running", "gauge", "Whether a benchmark or test is running.")
+	fmt.Fprintf(&buf, "benchserve_running %d\n", running)
+	metric("benchserve_queue_depth", "gauge", "Runs and lease requests waiting for the server.")
+	fmt.Fprintf(&buf, "benchserve_queue_depth %d\n", queue)
+	metric("benchserve_ns_per_op", "gauge", "Nanoseconds per operation of the latest successful run of each benchmark.")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "benchserve_ns_per_op{benchmark=\"%s\",procs=\"%d\"} %g\n", escapeLabel(k.name), k.procs, latest[k])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// labelEscaper escapes Prometheus label values.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
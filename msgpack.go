@@ -0,0 +1,694 @@
+package benchserve
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clients may speak MessagePack-RPC instead of JSON-RPC, for smaller
+// messages that are cheaper to encode and decode. The server tells them
+// apart by the first byte a client sends; see newServerCodec.
+// Arguments and results are encoded as MessagePack maps with the same keys
+// as in JSON, and times as MessagePack timestamps.
+// As in JSON-RPC, a request's params are an array holding the sole argument.
+
+// msgpackRequest is the first byte of a MessagePack-RPC request,
+// a 4-element array: [0, msgid, method, params].
+const msgpackRequest = 0x94
+
+// maxMsgpackDepth limits the nesting of decoded values.
+const maxMsgpackDepth = 10000
+
+// A msgpackCodec is an rpc.ServerCodec for MessagePack-RPC.
+type msgpackCodec struct {
+	c io.Closer
+	r *bufio.Reader
+	w *bufio.Writer
+
+	params interface{} // of the request being read
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]interface{} // msgid by server sequence number
+}
+
+func newMsgpackCodec(r *bufio.Reader, rwc io.ReadWriteCloser) *msgpackCodec {
+	return &msgpackCodec{c: rwc, r: r, w: bufio.NewWriter(rwc), pending: make(map[uint64]interface{})}
+}
+
+func (c *msgpackCodec) ReadRequestHeader(r *rpc.Request) error {
+	c.params = nil
+	x, err := readMsgpack(c.r, 0)
+	if err != nil {
+		return err
+	}
+	msg, ok := x.([]interface{})
+	if !ok || len(msg) != 4 {
+		return errors.New("msgpack-rpc: request is not a 4-element array")
+	}
+	if typ, ok := msg[0].(int64); !ok || typ != 0 {
+		return fmt.Errorf("msgpack-rpc: message type %v is not a request", msg[0])
+	}
+	method, ok := msg[2].(string)
+	if !ok {
+		return errors.New("msgpack-rpc: method is not a string")
+	}
+	r.ServiceMethod = method
+	c.params = msg[3]
+	c.mu.Lock()
+	c.seq++
+	c.pending[c.seq] = msg[1]
+	r.Seq = c.seq
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *msgpackCodec) ReadRequestBody(body interface{}) error {
+	if body == nil {
+		return nil
+	}
+	params, ok := c.params.([]interface{})
+	if !ok || len(params) != 1 {
+		return errors.New("msgpack-rpc: params is not a 1-element array")
+	}
+	return decodeMsgpack(reflect.ValueOf(body), params[0])
+}
+
+func (c *msgpackCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	id := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.mu.Unlock()
+
+	buf := []byte{0x94}
+	buf = appendMsgpack(buf, reflect.ValueOf(1))
+	buf = appendMsgpack(buf, reflect.ValueOf(id))
+	if r.Error != "" {
+		buf = appendMsgpack(buf, reflect.ValueOf(r.Error))
+		buf = append(buf, 0xc0)
+	} else {
+		buf = append(buf, 0xc0)
+		buf = appendMsgpack(buf, reflect.ValueOf(body))
+	}
+	if _, err := c.w.Write(buf); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *msgpackCodec) Close() error {
+	return c.c.Close()
+}
+
+// appendMsgpack appends the MessagePack encoding of v to buf.
+func appendMsgpack(buf []byte, v reflect.Value) []byte {
+	if !v.IsValid() {
+		return append(buf, 0xc0)
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		buf = append(buf, 0xc7, 12, 0xff) // timestamp 96
+		buf = binary.BigEndian.AppendUint32(buf, uint32(t.Nanosecond()))
+		return binary.BigEndian.AppendUint64(buf, uint64(t.Unix()))
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(buf, v.Uint())
+	case reflect.Float32:
+		buf = append(buf, 0xca)
+		return binary.BigEndian.AppendUint32(buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		return appendMsgpackString(buf, v.String())
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, 0xc0)
+		}
+		return appendMsgpack(buf, v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(buf, 0xc0)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			b := v.Bytes()
+			buf = appendMsgpackLen(buf, len(b), 0, 0xc4, 0xc5, 0xc6)
+			return append(buf, b...)
+		}
+		buf = appendMsgpackLen(buf, v.Len(), 0x90, 0, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			buf = appendMsgpack(buf, v.Index(i))
+		}
+		return buf
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0xc0)
+		}
+		buf = appendMsgpackLen(buf, v.Len(), 0x80, 0, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			buf = appendMsgpackString(buf, fmt.Sprint(iter.Key().Interface()))
+			buf = appendMsgpack(buf, iter.Value())
+		}
+		return buf
+	case reflect.Struct:
+		fields := jsonFields(v.Type())
+		n := 0
+		for _, f := range fields {
+			if fv, ok := f.value(v); ok && !(f.omitEmpty && fv.IsZero()) {
+				n++
+			}
+		}
+		buf = appendMsgpackLen(buf, n, 0x80, 0, 0xde, 0xdf)
+		for _, f := range fields {
+			if fv, ok := f.value(v); ok && !(f.omitEmpty && fv.IsZero()) {
+				buf = appendMsgpackString(buf, f.name)
+				buf = appendMsgpack(buf, fv)
+			}
+		}
+		return buf
+	}
+	// Functions and channels, which JSON cannot encode either.
+	return append(buf, 0xc0)
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(buf, uint64(i))
+	case i >= -32:
+		return append(buf, byte(i)) // negative fixint
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+}
+
+func appendMsgpackUint(buf []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(buf, byte(u)) // positive fixint
+	case u <= math.MaxUint8:
+		return append(buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xcf), u)
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	if len(s) < 32 {
+		buf = append(buf, 0xa0|byte(len(s)))
+	} else {
+		buf = appendMsgpackLen(buf, len(s), 0, 0xd9, 0xda, 0xdb)
+	}
+	return append(buf, s...)
+}
+
+// appendMsgpackLen appends the header of a string, binary, array, or map
+// of length n, given the type's fix, 8-bit, 16-bit, and 32-bit markers.
+// Fixed forms are at most 15 long (fixarray, fixmap); zero markers are absent.
+func appendMsgpackLen(buf []byte, n int, fix, m8, m16, m32 byte) []byte {
+	switch {
+	case fix != 0 && n < 16:
+		return append(buf, fix|byte(n))
+	case m8 != 0 && n <= math.MaxUint8:
+		return append(buf, m8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, m16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, m32), uint32(n))
+}
+
+// readMsgpack reads a MessagePack value, returning it as nil, a bool,
+// int64, uint64 (only if too large for int64), float64, string, []byte,
+// time.Time, []interface{}, or map[string]interface{}.
+func readMsgpack(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errors.New("msgpack: value nested too deeply")
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	// n reads a big-endian unsigned integer of size bytes.
+	n := func(size int) (uint64, error) {
+		var buf [8]byte
+		if _, err := io.ReadFull(r, buf[8-size:]); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		return binary.BigEndian.Uint64(buf[:]), nil
+	}
+	var size int // of a string, binary, array, map, or extension
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	case b&0xf0 == 0x90:
+		return readMsgpackArray(r, int(b&0x0f), depth)
+	case b&0xf0 == 0x80:
+		return readMsgpackMap(r, int(b&0x0f), depth)
+	}
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := n(1 << (b - 0xcc))
+		if err != nil || u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size = 1 << (b - 0xd0)
+		u, err := n(size)
+		// Sign-extend.
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xca:
+		u, err := n(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := n(8)
+		return math.Float64frombits(u), err
+	}
+
+	var sizeBytes int
+	switch b {
+	case 0xd9, 0xc4, 0xc7:
+		sizeBytes = 1
+	case 0xda, 0xc5, 0xc8, 0xdc, 0xde:
+		sizeBytes = 2
+	case 0xdb, 0xc6, 0xc9, 0xdd, 0xdf:
+		sizeBytes = 4
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		size = 1 << (b - 0xd4) // fixext
+	default:
+		return nil, fmt.Errorf("msgpack: unknown type byte %#x", b)
+	}
+	if sizeBytes > 0 {
+		u, err := n(sizeBytes)
+		if err != nil {
+			return nil, err
+		}
+		size = int(u)
+	}
+	switch b {
+	case 0xd9, 0xda, 0xdb:
+		return readMsgpackString(r, size)
+	case 0xc4, 0xc5, 0xc6:
+		return readMsgpackBytes(r, size)
+	case 0xdc, 0xdd:
+		return readMsgpackArray(r, size, depth)
+	case 0xde, 0xdf:
+		return readMsgpackMap(r, size, depth)
+	}
+	ext, err := r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	data, err := readMsgpackBytes(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if int8(ext) != -1 {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(ext))
+	}
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), nil
+	}
+	return nil, fmt.Errorf("msgpack: bad timestamp length %d", len(data))
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readMsgpackBytes reads n bytes, allocating only as they arrive,
+// so that a bad length cannot exhaust memory.
+func readMsgpackBytes(r *bufio.Reader, n int) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err == nil && len(b) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+func readMsgpackString(r *bufio.Reader, n int) (interface{}, error) {
+	b, err := readMsgpackBytes(r, n)
+	return string(b), err
+}
+
+func readMsgpackArray(r *bufio.Reader, n, depth int) (interface{}, error) {
+	a := make([]interface{}, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		x, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		a = append(a, x)
+	}
+	return a, nil
+}
+
+func readMsgpackMap(r *bufio.Reader, n, depth int) (interface{}, error) {
+	m := make(map[string]interface{}, min(n, 1024))
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		x, err := readMsgpack(r, depth+1)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		m[fmt.Sprint(k)] = x
+	}
+	return m, nil
+}
+
+// decodeMsgpack stores x, as returned by readMsgpack, in v,
+// following the rules of encoding/json.
+func decodeMsgpack(v reflect.Value, x interface{}) error {
+	if v.Kind() == reflect.Pointer {
+		if x == nil {
+			if v.CanSet() {
+				v.Set(reflect.Zero(v.Type()))
+			}
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeMsgpack(v.Elem(), x)
+	}
+	if x == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	bad := fmt.Errorf("msgpack: cannot decode %T into %v", x, v.Type())
+	if v.Type() == timeType {
+		switch x := x.(type) {
+		case time.Time:
+			v.Set(reflect.ValueOf(x))
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, x)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+		default:
+			return bad
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return bad
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch x := x.(type) {
+		case int64:
+			i = x
+		case float64:
+			if x != math.Trunc(x) {
+				return bad
+			}
+			i = int64(x)
+		default:
+			return bad
+		}
+		if v.OverflowInt(i) {
+			return bad
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch x := x.(type) {
+		case int64:
+			if x < 0 {
+				return bad
+			}
+			u = uint64(x)
+		case uint64:
+			u = x
+		case float64:
+			if x < 0 || x != math.Trunc(x) {
+				return bad
+			}
+			u = uint64(x)
+		default:
+			return bad
+		}
+		if v.OverflowUint(u) {
+			return bad
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch x := x.(type) {
+		case float64:
+			v.SetFloat(x)
+		case int64:
+			v.SetFloat(float64(x))
+		case uint64:
+			v.SetFloat(float64(x))
+		default:
+			return bad
+		}
+	case reflect.String:
+		switch x := x.(type) {
+		case string:
+			v.SetString(x)
+		case []byte:
+			v.SetString(string(x))
+		default:
+			return bad
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch x := x.(type) {
+			case []byte:
+				v.SetBytes(x)
+				return nil
+			case string:
+				v.SetBytes([]byte(x))
+				return nil
+			}
+		}
+		a, ok := x.([]interface{})
+		if !ok {
+			return bad
+		}
+		s := reflect.MakeSlice(v.Type(), len(a), len(a))
+		for i, e := range a {
+			if err := decodeMsgpack(s.Index(i), e); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		a, ok := x.([]interface{})
+		if !ok {
+			return bad
+		}
+		for i := 0; i < v.Len(); i++ {
+			var e interface{}
+			if i < len(a) {
+				e = a[i]
+			}
+			if err := decodeMsgpack(v.Index(i), e); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := x.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return bad
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		}
+		for k, e := range m {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeMsgpack(ev, e); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), ev)
+		}
+	case reflect.Struct:
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return bad
+		}
+		fields := jsonFields(v.Type())
+		for k, e := range m {
+			f := findJSONField(fields, k)
+			if f == nil {
+				continue
+			}
+			fv, ok := f.alloc(v)
+			if !ok {
+				continue
+			}
+			if err := decodeMsgpack(fv, e); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return bad
+		}
+		v.Set(reflect.ValueOf(x))
+	default:
+		return bad
+	}
+	return nil
+}
+
+// A jsonField is a field of a struct as encoded by encoding/json.
+type jsonField struct {
+	name      string
+	index     []int // for reflect.Value.FieldByIndex
+	omitEmpty bool
+}
+
+var jsonFieldCache sync.Map // of reflect.Type to []jsonField
+
+// jsonFields returns the fields of struct type t that encoding/json encodes,
+// including those of embedded structs.
+func jsonFields(t reflect.Type) []jsonField {
+	if fields, ok := jsonFieldCache.Load(t); ok {
+		return fields.([]jsonField)
+	}
+	var fields []jsonField
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for _, ef := range jsonFields(ft) {
+				if !seen[ef.name] {
+					ef.index = append([]int{i}, ef.index...)
+					fields = append(fields, ef)
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		seen[name] = true
+		fields = append(fields, jsonField{name: name, index: []int{i}, omitEmpty: strings.Contains(opts, "omitempty")})
+	}
+	// Fields of t take precedence over those of embedded structs.
+	out := fields[:0]
+	for _, f := range fields {
+		if len(f.index) == 1 || !seen[f.name] {
+			out = append(out, f)
+		}
+	}
+	jsonFieldCache.Store(t, out)
+	return out
+}
+
+// findJSONField returns the field named name, preferring an exact match
+// to a case-insensitive one, as encoding/json does.
+func findJSONField(fields []jsonField, name string) *jsonField {
+	var fold *jsonField
+	for i := range fields {
+		f := &fields[i]
+		if f.name == name {
+			return f
+		}
+		if fold == nil && strings.EqualFold(f.name, name) {
+			fold = f
+		}
+	}
+	return fold
+}
+
+// value returns the field f of struct v, reporting false
+// if it is in an embedded struct reached through a nil pointer.
+func (f *jsonField) value(v reflect.Value) (reflect.Value, bool) {
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// alloc returns the settable field f of struct v, allocating any embedded
+// structs reached through nil pointers. It reports false if it cannot.
+func (f *jsonField) alloc(v reflect.Value) (reflect.Value, bool) {
+	for i, x := range f.index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
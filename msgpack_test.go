@@ -0,0 +1,222 @@
+package benchserve
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unhex decodes s, ignoring spaces.
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// mustReadMsgpack decodes the single value in b.
+func mustReadMsgpack(t *testing.T, b []byte) interface{} {
+	t.Helper()
+	x, err := readMsgpack(bufio.NewReader(bytes.NewReader(b)), 0)
+	if err != nil {
+		t.Fatalf("readMsgpack(% x): %v", b, err)
+	}
+	return x
+}
+
+// The expected encodings follow the type bytes of the MessagePack spec.
+func TestAppendMsgpack(t *testing.T) {
+	type omit struct {
+		A int    `json:"a"`
+		B string `json:",omitempty"`
+	}
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "c0"},
+		{false, "c2"},
+		{true, "c3"},
+		{0, "00"},
+		{127, "7f"},
+		{128, "cc 80"},
+		{256, "cd 0100"},
+		{65536, "ce 00010000"},
+		{uint64(math.MaxUint64), "cf ffffffffffffffff"},
+		{-1, "ff"},  // negative fixint
+		{-32, "e0"}, // negative fixint
+		{-33, "d0 df"},
+		{-129, "d1 ff7f"},
+		{int64(math.MinInt64), "d3 8000000000000000"},
+		{float32(1.5), "ca 3fc00000"},
+		{1.5, "cb 3ff8000000000000"},
+		{"", "a0"},
+		{"abc", "a3 616263"},
+		{strings.Repeat("x", 32), "d9 20" + strings.Repeat("78", 32)},
+		{[]byte{1, 2}, "c4 02 0102"},
+		{[]int(nil), "c0"},
+		{[]int{}, "90"},
+		{[]int{1, -1}, "92 01 ff"},
+		{map[string]int(nil), "c0"},
+		{map[string]int{}, "80"},
+		{map[string]int{"a": 1}, "81 a161 01"},
+		{omit{A: 1}, "81 a161 01"},
+		{time.Unix(1, 2), "c7 0c ff 00000002 0000000000000001"}, // timestamp 96
+	}
+	for _, tt := range tests {
+		got := appendMsgpack(nil, reflect.ValueOf(tt.v))
+		if want := unhex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("appendMsgpack(%#v) = % x, want % x", tt.v, got, want)
+		}
+	}
+}
+
+func TestReadMsgpack(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"c0", nil},
+		{"c2", false},
+		{"c3", true},
+		{"7f", int64(127)},
+		{"ff", int64(-1)},
+		{"e0", int64(-32)},
+		{"d0 80", int64(-128)},
+		{"d1 ff7f", int64(-129)},
+		{"d2 80000000", int64(math.MinInt32)},
+		{"cc ff", int64(255)},
+		{"cf ffffffffffffffff", uint64(math.MaxUint64)},
+		{"ca 3fc00000", 1.5},
+		{"a3 616263", "abc"},
+		{"c4 02 0102", []byte{1, 2}},
+		{"90", []interface{}{}},
+		{"92 01 ff", []interface{}{int64(1), int64(-1)}},
+		{"80", map[string]interface{}{}},
+		{"81 a161 c0", map[string]interface{}{"a": nil}},
+	}
+	for _, tt := range tests {
+		got := mustReadMsgpack(t, unhex(t, tt.in))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readMsgpack(%s) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadMsgpackTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"d6 ff 00000001", time.Unix(1, 0)},                                 // timestamp 32
+		{"d7 ff 00000008 00000001", time.Unix(1, 2)},                        // timestamp 64: nanoseconds<<34 | seconds
+		{"c7 0c ff 00000002 ffffffffffffffff", time.Unix(-1, 2)},            // timestamp 96
+		{"c7 0c ff 3b9ac9ff 0000000400000000", time.Unix(1<<34, 999999999)}, // beyond timestamp 64
+	}
+	for _, tt := range tests {
+		got, ok := mustReadMsgpack(t, unhex(t, tt.in)).(time.Time)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("readMsgpack(%s) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := readMsgpack(bufio.NewReader(bytes.NewReader(unhex(t, "d6 01 00000001"))), 0); err == nil {
+		t.Errorf("readMsgpack of extension type 1 succeeded, want error")
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	type inner struct {
+		N int
+	}
+	type value struct {
+		Ints    []int
+		Neg     int8
+		Big     uint64
+		F       float64
+		S       string
+		B       []byte
+		NilMap  map[string]int
+		Empty   map[string]int
+		Env     map[string]*string
+		Ptr     *inner
+		NilPtr  *inner
+		When    time.Time
+		Elapsed time.Duration
+	}
+	s := "v"
+	in := value{
+		Ints:    []int{0, -1, -32, -33, 1 << 40},
+		Neg:     -128,
+		Big:     math.MaxUint64,
+		F:       -0.25,
+		S:       "héllo",
+		B:       []byte{0, 0xff},
+		Empty:   map[string]int{},
+		Env:     map[string]*string{"SET": &s, "UNSET": nil},
+		Ptr:     &inner{N: -5},
+		When:    time.Date(2024, 2, 29, 12, 0, 0, 123456789, time.UTC),
+		Elapsed: -time.Second,
+	}
+	var out value
+	x := mustReadMsgpack(t, appendMsgpack(nil, reflect.ValueOf(in)))
+	if err := decodeMsgpack(reflect.ValueOf(&out), x); err != nil {
+		t.Fatal(err)
+	}
+	if !out.When.Equal(in.When) {
+		t.Errorf("When = %v, want %v", out.When, in.When)
+	}
+	out.When = in.When
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip:\ngot  %+v\nwant %+v", out, in)
+	}
+	if out.NilMap != nil {
+		t.Errorf("nil map decoded as %#v, want nil", out.NilMap)
+	}
+	if out.Empty == nil {
+		t.Errorf("empty map decoded as nil, want empty")
+	}
+}
+
+// rwc is an io.ReadWriteCloser reading from r and discarding writes.
+type rwc struct {
+	io.Reader
+}
+
+func (rwc) Write(b []byte) (int, error) { return len(b), nil }
+func (rwc) Close() error                { return nil }
+
+func TestMsgpackRequestType(t *testing.T) {
+	tests := []struct {
+		typ  string // encoded message type
+		isOK bool
+	}{
+		{"00", true},
+		{"01", false},                  // response
+		{"cb 0000000000000000", false}, // 0.0
+		{"a1 30", false},               // "0"
+		{"c0", false},
+	}
+	for _, tt := range tests {
+		// [type, 7, "Ping", [nil]]
+		req := unhex(t, "94"+tt.typ+"07 a450696e67 91c0")
+		r := bufio.NewReader(bytes.NewReader(req))
+		c := newMsgpackCodec(r, rwc{r})
+		var hdr rpc.Request
+		err := c.ReadRequestHeader(&hdr)
+		if ok := err == nil; ok != tt.isOK {
+			t.Errorf("message type %s: ReadRequestHeader error %v, want ok=%v", tt.typ, err, tt.isOK)
+		}
+		if err == nil && hdr.ServiceMethod != "Ping" {
+			t.Errorf("message type %s: method %q, want Ping", tt.typ, hdr.ServiceMethod)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package benchserve
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An Order requires that a batch perform Runs[Before]
+// before Runs[After]. The indices are into Batch.Runs.
+type Order struct {
+	Before, After int
+}
+
+// plan returns the order in which to perform the runs of b:
+// the order of b.Runs, changed as little as necessary to honor b.Order.
+// It returns an error if b.Order is inconsistent.
+func (b Batch) plan() ([]int, error) {
+	n := len(b.Runs)
+	indegree := make([]int, n)
+	next := make([][]int, n)
+	for _, o := range b.Order {
+		switch {
+		case o.Before < 0 || o.Before >= n || o.After < 0 || o.After >= n:
+			return nil, fmt.Errorf("order %d before %d: no such run", o.Before, o.After)
+		case o.Before == o.After:
+			return nil, fmt.Errorf("order %d before %d: run cannot precede itself", o.Before, o.After)
+		}
+		next[o.Before] = append(next[o.Before], o.After)
+		indegree[o.After]++
+	}
+
+	// Repeatedly take the earliest run whose predecessors are all planned.
+	var ready, plan []int
+	for i, d := range indegree {
+		if d == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		plan = append(plan, i)
+		for _, k := range next[i] {
+			if indegree[k]--; indegree[k] == 0 {
+				ready = append(ready, k)
+				sort.Ints(ready)
+			}
+		}
+	}
+	if len(plan) < n {
+		var cycle []int
+		for i, d := range indegree {
+			if d > 0 {
+				cycle = append(cycle, i)
+			}
+		}
+		return nil, fmt.Errorf("order has a cycle among runs %v", cycle)
+	}
+	return plan, nil
+}
+
+// blocker returns the index of a run that must precede run i
+// but has not completed successfully, according to done,
+// or -1 if there is none.
+func (b Batch) blocker(i int, done []bool) int {
+	for _, o := range b.Order {
+		if o.After == i && !done[o.Before] {
+			return o.Before
+		}
+	}
+	return -1
+}
@@ -0,0 +1,68 @@
+package benchserve
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// batchOf returns a batch of n runs with the given orders.
+func batchOf(n int, order ...Order) Batch {
+	return Batch{Runs: make([]Run, n), Order: order}
+}
+
+func TestPlan(t *testing.T) {
+	for _, tt := range []struct {
+		b    Batch
+		want []int
+	}{
+		{batchOf(3), []int{0, 1, 2}},
+		{batchOf(3, Order{0, 2}), []int{0, 1, 2}},
+		{batchOf(3, Order{2, 0}), []int{1, 2, 0}},
+		// Only what must move does.
+		{batchOf(4, Order{3, 1}), []int{0, 2, 3, 1}},
+		{batchOf(4, Order{3, 0}, Order{2, 3}), []int{1, 2, 3, 0}},
+		{batchOf(3, Order{1, 0}, Order{2, 0}), []int{1, 2, 0}},
+	} {
+		got, err := tt.b.plan()
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("plan of %d runs with %v = %v, %v; want %v", len(tt.b.Runs), tt.b.Order, got, err, tt.want)
+		}
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	for _, tt := range []struct {
+		b   Batch
+		err string
+	}{
+		{batchOf(2, Order{0, 2}), "no such run"},
+		{batchOf(2, Order{-1, 0}), "no such run"},
+		{batchOf(2, Order{1, 1}), "cannot precede itself"},
+		{batchOf(3, Order{0, 1}, Order{1, 0}), "cycle among runs [0 1]"},
+		// Runs after a cycle are reported with it.
+		{batchOf(4, Order{1, 2}, Order{2, 1}, Order{2, 3}), "cycle among runs [1 2 3]"},
+	} {
+		if _, err := tt.b.plan(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("plan with %v: error %v, want %q", tt.b.Order, err, tt.err)
+		}
+	}
+}
+
+func TestBlocker(t *testing.T) {
+	b := batchOf(3, Order{0, 2}, Order{1, 2})
+	for _, tt := range []struct {
+		done []bool
+		i    int
+		want int
+	}{
+		{[]bool{false, false, false}, 2, 0},
+		{[]bool{true, false, false}, 2, 1},
+		{[]bool{true, true, false}, 2, -1},
+		{[]bool{false, false, false}, 1, -1},
+	} {
+		if got := b.blocker(tt.i, tt.done); got != tt.want {
+			t.Errorf("blocker(%d, %v) = %d, want %d", tt.i, tt.done, got, tt.want)
+		}
+	}
+}
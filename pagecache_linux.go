@@ -0,0 +1,25 @@
+package benchserve
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// dropPageCache writes dirty pages to disk and then drops
+// the clean page cache, dentries, and inodes, so that the next run
+// reads from the disk. It requires root.
+func dropPageCache() error {
+	f, err := os.OpenFile("/proc/sys/vm/drop_caches", os.O_WRONLY, 0)
+	if errors.Is(err, fs.ErrPermission) {
+		return errors.New("dropping the page cache requires root")
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	syscall.Sync()
+	_, err = f.WriteString("3\n")
+	return err
+}
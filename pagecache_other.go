@@ -0,0 +1,9 @@
+//go:build !linux
+
+package benchserve
+
+import "errors"
+
+func dropPageCache() error {
+	return errors.New("dropping the page cache is only supported on Linux")
+}
@@ -0,0 +1,59 @@
+package benchserve
+
+import (
+	"sync"
+	"testing"
+)
+
+// params holds the Params and seed of the run in progress.
+// The server runs one benchmark at a time.
+var params struct {
+	sync.Mutex
+	m    map[string]string
+	seed int64
+}
+
+// setParams sets the Params and seed of the run in progress.
+func setParams(m map[string]string, seed int64) {
+	params.Lock()
+	defer params.Unlock()
+	params.m = m
+	params.seed = seed
+}
+
+// Param returns the value of the parameter named key
+// in the Run.Params of the run that b is part of,
+// or the empty string if there is no such parameter.
+// Benchmarks can use it to read values chosen by drivers,
+// such as payload sizes, instead of enumerating them as sub-benchmarks:
+//
+//	func BenchmarkEncode(b *testing.B) {
+//		size, err := strconv.Atoi(benchserve.Param(b, "size"))
+//		if err != nil {
+//			size = 1024
+//		}
+//		...
+//	}
+//
+// When the benchmark is run by go test rather than the server,
+// there are no parameters.
+func Param(b *testing.B, key string) string {
+	params.Lock()
+	defer params.Unlock()
+	return params.m[key]
+}
+
+// Seed returns the random seed of the run in progress, from Run.Seed,
+// for benchmarks to build reproducible inputs:
+//
+//	r := rand.New(rand.NewSource(benchserve.Seed()))
+//
+// It is the only hook for reproducible randomness: the server does not
+// seed the global sources of math/rand, whose Seed does nothing
+// as of Go 1.24, or math/rand/v2, which cannot be seeded.
+// When the benchmark is run by go test rather than the server, Seed returns 0.
+func Seed() int64 {
+	params.Lock()
+	defer params.Unlock()
+	return params.seed
+}
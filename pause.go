@@ -0,0 +1,113 @@
+package benchserve
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Pause holds the server's runs until Resume: direct requests to run
+// benchmarks or tests fail with a Busy error, and jobs wait before
+// their next run. A run already in progress finishes.
+// Time a campaign spends held counts against its Budget.
+func (s *Server) Pause(args struct{}, reply *struct{}) error {
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+	return nil
+}
+
+// Resume undoes Pause. Runs remain held outside -test.benchserve.window.
+func (s *Server) Resume(args struct{}, reply *struct{}) error {
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	s.jobCond.Broadcast()
+	return nil
+}
+
+// A window is a daily span of local time, as offsets from midnight.
+// It may wrap past midnight, as in 22:00-06:00.
+type window struct {
+	start, end time.Duration
+}
+
+// parseWindow parses a window of the form hh:mm-hh:mm.
+// The empty string means all day.
+func parseWindow(s string) (*window, error) {
+	if s == "" {
+		return nil, nil
+	}
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("window %q is not of the form hh:mm-hh:mm", s)
+	}
+	var w window
+	for _, x := range []struct {
+		s string
+		d *time.Duration
+	}{{start, &w.start}, {end, &w.end}} {
+		t, err := time.Parse("15:04", x.s)
+		if err != nil {
+			return nil, fmt.Errorf("window %q is not of the form hh:mm-hh:mm", s)
+		}
+		*x.d = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if w.start == w.end {
+		return nil, errors.New("empty window")
+	}
+	return &w, nil
+}
+
+// untilOpen returns how long after t the window next opens,
+// or zero if it is open at t.
+func (w *window) untilOpen(t time.Time) time.Duration {
+	h, m, sec := t.Clock()
+	off := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if w.start < w.end && w.start <= off && off < w.end ||
+		w.start > w.end && (off >= w.start || off < w.end) {
+		return 0
+	}
+	d := w.start - off
+	if d < 0 {
+		d += 24 * time.Hour
+	}
+	return d
+}
+
+// held returns a Busy error if runs are held by Pause
+// or by -test.benchserve.window at time t. s.mu must be held.
+func (s *server) held(t time.Time) *Busy {
+	if s.paused {
+		return &Busy{Reason: "paused", RetryAfter: defaultRetryAfter}
+	}
+	if s.window != nil {
+		if d := s.window.untilOpen(t); d > 0 {
+			return &Busy{Reason: "outside -test.benchserve.window " + *benchServeWindow, RetryAfter: d.Round(time.Second)}
+		}
+	}
+	return nil
+}
+
+// hold waits, as job j, until runs are no longer held
+// or j is canceled. s.mu must be held.
+func (s *server) hold(j *job) {
+	for {
+		b := s.held(time.Now())
+		if b == nil || j.canceled {
+			j.status.State = JobRunning
+			return
+		}
+		j.status.State = JobHeld
+		t := time.AfterFunc(b.RetryAfter, s.jobCond.Broadcast)
+		s.jobCond.Wait()
+		t.Stop()
+	}
+}
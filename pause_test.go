@@ -0,0 +1,56 @@
+package benchserve
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	for _, tt := range []struct {
+		s          string
+		start, end time.Duration
+	}{
+		{"22:00-06:00", 22 * time.Hour, 6 * time.Hour},
+		{"09:30-17:45", 9*time.Hour + 30*time.Minute, 17*time.Hour + 45*time.Minute},
+		{"00:00-23:59", 0, 23*time.Hour + 59*time.Minute},
+	} {
+		w, err := parseWindow(tt.s)
+		if err != nil || w == nil || w.start != tt.start || w.end != tt.end {
+			t.Errorf("parseWindow(%q) = %+v, %v; want {%v %v}", tt.s, w, err, tt.start, tt.end)
+		}
+	}
+	if w, err := parseWindow(""); w != nil || err != nil {
+		t.Errorf(`parseWindow("") = %+v, %v; want nil, nil`, w, err)
+	}
+	for _, s := range []string{"22:00", "22:00-", "10pm-6am", "25:00-06:00", "22:00-06:60", "08:00-08:00"} {
+		if w, err := parseWindow(s); err == nil {
+			t.Errorf("parseWindow(%q) = %+v, want error", s, w)
+		}
+	}
+}
+
+func TestUntilOpen(t *testing.T) {
+	at := func(h, m, s int) time.Time { return time.Date(2024, 3, 1, h, m, s, 0, time.Local) }
+	day := &window{9 * time.Hour, 17 * time.Hour}
+	night := &window{22 * time.Hour, 6 * time.Hour}
+	for _, tt := range []struct {
+		w    *window
+		t    time.Time
+		want time.Duration
+	}{
+		{day, at(9, 0, 0), 0},
+		{day, at(12, 0, 0), 0},
+		{day, at(16, 59, 59), 0},
+		{day, at(17, 0, 0), 16 * time.Hour},
+		{day, at(8, 59, 30), 30 * time.Second},
+		{night, at(23, 0, 0), 0},
+		{night, at(0, 0, 0), 0},
+		{night, at(5, 59, 59), 0},
+		{night, at(6, 0, 0), 16 * time.Hour},
+		{night, at(21, 0, 0), time.Hour},
+	} {
+		if got := tt.w.untilOpen(tt.t); got != tt.want {
+			t.Errorf("window %v-%v at %v: untilOpen = %v, want %v", tt.w.start, tt.w.end, tt.t.Format("15:04:05"), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package benchserve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// PGO requests a CPU profile of some benchmarks for profile-guided optimization.
+type PGO struct {
+	List // benchmarks to profile
+
+	// Procs is the GOMAXPROCS value for the runs, default runtime.NumCPU(),
+	// as in a production binary.
+	Procs int
+
+	// Time is how long to spend running the benchmarks in total,
+	// default 30s. The benchmarks take turns, in runs of about RunTime
+	// each, default 100ms, so that each contributes CPU time to the
+	// profile in proportion to its cost, as in a sampled production profile.
+	Time    time.Duration
+	RunTime time.Duration
+}
+
+// PGOResult describes a harvested PGO profile.
+type PGOResult struct {
+	// Artifact is the ID of the CPU profile, of kind "pgo".
+	// Save it as default.pgo in a main package's directory
+	// to use it with go build -pgo=auto.
+	Artifact string
+
+	Runs map[string]int // number of runs of each benchmark
+	T    time.Duration  // total time spent running benchmarks
+}
+
+// HarvestPGO runs the selected benchmarks repeatedly while recording
+// a single merged CPU profile, for use as a default.pgo file.
+// It holds the server for the whole of args.Time; use Cancel to stop it
+// early, with the profile recorded so far. The runs are not recorded.
+func (s *Server) HarvestPGO(args PGO, reply *PGOResult) error {
+	names, err := s.selected(args.List)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("pattern %q tags %q: no benchmarks", args.Pattern, args.Tags)
+	}
+	procs := args.Procs
+	if procs <= 0 {
+		procs = runtime.NumCPU()
+	}
+	total := args.Time
+	if total <= 0 {
+		total = 30 * time.Second
+	}
+	if max := *benchServeMaxRun; max > 0 && total > max {
+		return fmt.Errorf("time %v exceeds -test.benchserve.maxrun of %v", total, max)
+	}
+	runTime := args.RunTime
+	if runTime <= 0 {
+		runTime = 100 * time.Millisecond
+	}
+
+	ctx, done, err := s.acquire("HarvestPGO")
+	if err != nil {
+		return err
+	}
+	defer done()
+	var prof bytes.Buffer
+	if err := pprof.StartCPUProfile(&prof); err != nil {
+		return fmt.Errorf("start CPU profile: %v", err)
+	}
+	n := make(map[string]int)
+	reply.Runs = make(map[string]int)
+	deadline := time.Now().Add(total)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		for _, name := range names {
+			if n[name] == 0 {
+				n[name] = 1
+			}
+			r, err := s.measure(ctx, s.m[name], Run{Name: name, Procs: procs, N: n[name]})
+			if err == errCanceled {
+				break
+			}
+			if err != nil {
+				pprof.StopCPUProfile()
+				return err
+			}
+			reply.Runs[name]++
+			reply.T += r.T
+			n[name] = nextN(n[name], r.T, runTime)
+			if !time.Now().Before(deadline) {
+				break
+			}
+		}
+	}
+	pprof.StopCPUProfile()
+	if len(reply.Runs) == 0 {
+		return errors.New("canceled before any runs")
+	}
+	reply.Artifact, err = saveArtifact("pgo", prof.Bytes())
+	return err
+}
+
+// nextN returns the iteration count for a run expected to take about d,
+// after a run of n iterations took t, growing by at most 100x at a time.
+func nextN(n int, t, d time.Duration) int {
+	ns := float64(t) / float64(n)
+	next := int(float64(d) / (ns + 1))
+	if next > 100*n {
+		next = 100 * n
+	}
+	if next < 1 {
+		next = 1
+	}
+	return next
+}
@@ -0,0 +1,272 @@
+package benchserve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// maxCPUs bounds the CPU and NUMA node numbers that placement supports.
+const maxCPUs = 1024
+
+// A cpuMask is a Linux cpu_set_t or nodemask_t.
+type cpuMask [maxCPUs / 64]uint64
+
+func (m *cpuMask) set(i int) { m[i/64] |= 1 << (i % 64) }
+
+// parseCPUList parses a Linux CPU list, such as "0-3,8,10-11".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, r := range strings.Split(strings.TrimSpace(list), ",") {
+		if r == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(hi)
+		}
+		if err != nil || first < 0 || last < first || last >= maxCPUs {
+			return nil, fmt.Errorf("bad CPU list %q", list)
+		}
+		for c := first; c <= last; c++ {
+			cpus = append(cpus, c)
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("empty CPU list %q", list)
+	}
+	return cpus, nil
+}
+
+// allowedCPUs returns the CPUs on which the process may run,
+// as a CPU list, or "" if unknown.
+func allowedCPUs() string {
+	buf, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if v, ok := strings.CutPrefix(line, "Cpus_allowed_list:"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// numaNodeCPUs returns the CPUs of NUMA node n.
+func numaNodeCPUs(n int) ([]int, error) {
+	buf, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", n))
+	if err != nil {
+		return nil, fmt.Errorf("NUMA node %d not found", n)
+	}
+	return parseCPUList(string(buf))
+}
+
+// mpolBind is the MPOL_BIND memory policy, which allocates only on given nodes.
+const mpolBind = 2
+
+// bindThread binds the calling thread to the given CPUs
+// and, if node is non-negative, its memory to NUMA node node.
+func bindThread(cpus []int, node int) error {
+	var mask cpuMask
+	for _, c := range cpus {
+		mask.set(c)
+	}
+	if _, _, e := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask))); e != 0 {
+		return fmt.Errorf("sched_setaffinity: %v", e)
+	}
+	if node < 0 {
+		return nil
+	}
+	if node >= maxCPUs {
+		return fmt.Errorf("NUMA node %d out of range", node)
+	}
+	var nodes cpuMask
+	nodes.set(node)
+	// The kernel reads maxnode-1 bits.
+	if _, _, e := syscall.RawSyscall(syscall.SYS_SET_MEMPOLICY, mpolBind, uintptr(unsafe.Pointer(&nodes)), maxCPUs+1); e != 0 {
+		return fmt.Errorf("set_mempolicy: %v", e)
+	}
+	return nil
+}
+
+// combinedOutputOnNode runs cmd, as CombinedOutput does,
+// with its threads and memory bound to NUMA node node.
+// A child inherits the placement of the thread that starts it,
+// so cmd is started from a thread bound for the purpose, as numactl does.
+func combinedOutputOnNode(cmd *exec.Cmd, node int) ([]byte, error) {
+	cpus, err := numaNodeCPUs(node)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	errc := make(chan error)
+	go func() {
+		// Never unlocked, so that the thread exits with the goroutine
+		// rather than running other goroutines with the placement.
+		runtime.LockOSThread()
+		if err := bindThread(cpus, node); err != nil {
+			errc <- err
+			return
+		}
+		errc <- cmd.Start()
+	}()
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	err = cmd.Wait()
+	return out.Bytes(), err
+}
+
+// Core selections for Run.Cores.
+const (
+	PerformanceCores = "performance"
+	EfficiencyCores  = "efficiency"
+)
+
+// coreClusters returns the fastest and slowest CPUs of a system
+// with heterogeneous cores, such as ARM big.LITTLE, judged by
+// the scheduler's cpu_capacity or, failing that, maximum frequency.
+// It reports false if the cores are all alike.
+func coreClusters() (perf, eff []int, ok bool) {
+	buf, err := os.ReadFile("/sys/devices/system/cpu/online")
+	if err != nil {
+		return nil, nil, false
+	}
+	online, err := parseCPUList(string(buf))
+	if err != nil {
+		return nil, nil, false
+	}
+	speed := make(map[int]int64)
+	var lo, hi int64
+	for _, c := range online {
+		dir := fmt.Sprintf("/sys/devices/system/cpu/cpu%d", c)
+		v, ok := readInt(filepath.Join(dir, "cpu_capacity"))
+		if !ok {
+			v, ok = readInt(filepath.Join(dir, "cpufreq", "cpuinfo_max_freq"))
+		}
+		if !ok {
+			return nil, nil, false
+		}
+		speed[c] = v
+		if len(speed) == 1 || v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	if lo == hi {
+		return nil, nil, false
+	}
+	for _, c := range online {
+		switch speed[c] {
+		case hi:
+			perf = append(perf, c)
+		case lo:
+			eff = append(eff, c)
+		}
+	}
+	return perf, eff, true
+}
+
+// selectCores returns the CPUs selected by Run.Cores.
+func selectCores(cores string) ([]int, error) {
+	if cores != PerformanceCores && cores != EfficiencyCores {
+		return parseCPUList(cores)
+	}
+	perf, eff, ok := coreClusters()
+	if !ok {
+		return nil, errors.New("this machine does not have heterogeneous cores")
+	}
+	if cores == PerformanceCores {
+		return perf, nil
+	}
+	return eff, nil
+}
+
+// coreCluster returns the cluster to which all of cpus belong,
+// PerformanceCores or EfficiencyCores, "mixed" if they span clusters,
+// or "" if the machine's cores are all alike.
+func coreCluster(cpus string) string {
+	list, err := parseCPUList(cpus)
+	perf, eff, ok := coreClusters()
+	if err != nil || !ok {
+		return ""
+	}
+	in := func(set []int) bool {
+		for _, c := range list {
+			if !containsInt(set, c) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case in(perf):
+		return PerformanceCores
+	case in(eff):
+		return EfficiencyCores
+	}
+	return "mixed"
+}
+
+func containsInt(list []int, x int) bool {
+	for _, y := range list {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+// pinProcess restricts all the process's threads to cpus, and returns
+// a function that restores their previous affinity. Threads that the
+// runtime starts later inherit the affinity of the threads that start them.
+func pinProcess(cpus []int) (restore func(), err error) {
+	var orig, mask cpuMask
+	if _, _, e := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(orig), uintptr(unsafe.Pointer(&orig))); e != 0 {
+		return nil, fmt.Errorf("sched_getaffinity: %v", e)
+	}
+	for _, c := range cpus {
+		mask.set(c)
+	}
+	if err := setProcessAffinity(&mask); err != nil {
+		setProcessAffinity(&orig)
+		return nil, err
+	}
+	return func() { setProcessAffinity(&orig) }, nil
+}
+
+// setProcessAffinity sets the affinity of all the process's threads.
+// It makes two passes, to catch threads started during the first.
+func setProcessAffinity(mask *cpuMask) error {
+	for pass := 0; pass < 2; pass++ {
+		tasks, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+		for _, t := range tasks {
+			tid, err := strconv.Atoi(t.Name())
+			if err != nil {
+				continue
+			}
+			_, _, e := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, uintptr(tid), unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+			if e != 0 && e != syscall.ESRCH { // ESRCH: the thread has exited
+				return fmt.Errorf("sched_setaffinity: %v", e)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package benchserve
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Core selections for Run.Cores.
+const (
+	PerformanceCores = "performance"
+	EfficiencyCores  = "efficiency"
+)
+
+func selectCores(cores string) ([]int, error) {
+	return nil, errors.New("core selection is only supported on Linux")
+}
+
+func pinProcess(cpus []int) (restore func(), err error) {
+	return nil, errors.New("core selection is only supported on Linux")
+}
+
+// coreCluster returns the cluster of cores to which cpus belong.
+// It is not implemented on this system.
+func coreCluster(cpus string) string { return "" }
+
+// allowedCPUs returns the CPUs on which the process may run.
+// It is not implemented on this system.
+func allowedCPUs() string { return "" }
+
+func combinedOutputOnNode(cmd *exec.Cmd, node int) ([]byte, error) {
+	return nil, errors.New("NUMA placement is only supported on Linux")
+}
@@ -0,0 +1,119 @@
+package benchserve
+
+import (
+	"sort"
+	"time"
+)
+
+// QueueInfo describes the jobs that have not finished.
+type QueueInfo struct {
+	Running *QueueEntry  // the job running or held, if any
+	Queued  []QueueEntry // jobs waiting to run or continue, in the order they will
+}
+
+// QueueEntry describes a job that has not finished.
+type QueueEntry struct {
+	ID        string
+	State     string
+	Submitter string // remote address of the client that submitted the job
+	Submitted time.Time
+	Batch     Batch // the job's parameters, with Select expanded into Runs
+	Done      int   // number of runs performed so far
+
+	// Start is when the job started or, for queued jobs, when it is
+	// expected to start. Estimate is the expected time to perform
+	// the rest of the job: the Validate estimate for the batch,
+	// in proportion to the runs not yet performed, or what remains
+	// of the Budget of a campaign.
+	// Partial reports that Estimate leaves out runs with no earlier
+	// results, so that it and the start of later jobs are lower bounds.
+	// Estimates assume that runs are not held by Pause or
+	// -test.benchserve.window.
+	Start    time.Time
+	Estimate time.Duration
+	Partial  bool `json:",omitempty"`
+}
+
+// Queue reports the running and queued jobs, with the expected
+// start times of those that are waiting, so that a client waiting
+// behind other work can tell what it is waiting for and how long.
+func (s *Server) Queue(args struct{}, reply *QueueInfo) error {
+	s.mu.Lock()
+	// Jobs that gave way to ones of higher priority continue,
+	// most recently started first, once the running job finishes.
+	var started []*job
+	for _, j := range s.jobs {
+		if j.status.State == JobRunning || j.status.State == JobHeld {
+			started = append(started, j)
+		}
+	}
+	sort.Slice(started, func(i, k int) bool { return started[i].started.After(started[k].started) })
+	// Each continues after the queued jobs of higher priority than its own.
+	var order []*job
+	queue := s.jobQueue
+	for i, j := range started {
+		for i > 0 && len(queue) > 0 && queue[0].batch.Priority > j.batch.Priority {
+			order, queue = append(order, queue[0]), queue[1:]
+		}
+		order = append(order, j)
+	}
+	order = append(order, queue...)
+	var entries []QueueEntry
+	for _, j := range order {
+		e := j.entry()
+		e.Start = j.started
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+
+	// Estimating takes s.mu.
+	next := time.Now()
+	for i := range entries {
+		e := &entries[i]
+		e.Estimate, e.Partial = s.estimateJob(e.Batch)
+		switch {
+		case e.Start.IsZero():
+			e.Start = next
+		case e.Batch.Budget > 0:
+			// A campaign's budget runs out on time, even while it gives way.
+			if e.Estimate = e.Start.Add(e.Batch.Budget).Sub(next); e.Estimate < 0 {
+				e.Estimate = 0
+			}
+		case e.Done < len(e.Batch.Runs):
+			n := time.Duration(len(e.Batch.Runs))
+			e.Estimate = e.Estimate * (n - time.Duration(e.Done)) / n
+		default:
+			e.Estimate = 0
+		}
+		if i == 0 && len(started) > 0 {
+			reply.Running = e
+		} else {
+			reply.Queued = append(reply.Queued, *e)
+		}
+		next = next.Add(e.Estimate)
+	}
+	return nil
+}
+
+// entry returns the QueueEntry for j, without its estimates.
+// The caller must hold server.mu.
+func (j *job) entry() QueueEntry {
+	return QueueEntry{
+		ID:        j.status.ID,
+		State:     j.status.State,
+		Submitter: j.status.Submitter,
+		Submitted: j.status.Submitted,
+		Batch:     j.batch,
+		Done:      len(j.status.Runs),
+	}
+}
+
+// estimateJob returns the expected time to perform b and whether
+// the estimate leaves out runs with no earlier results.
+func (s *Server) estimateJob(b Batch) (time.Duration, bool) {
+	if b.Budget > 0 {
+		return b.Budget, false
+	}
+	v := s.validate(b)
+	return v.Estimate, len(v.Unknown) > 0
+}
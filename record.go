@@ -0,0 +1,160 @@
+package benchserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// A Record is a completed run, as written to the run log.
+type Record struct {
+	Time    time.Time // when the run completed
+	Binary  string    // hex-encoded SHA-256 hash of the test binary
+	Options Options   // server options in effect
+	Run     Run       // the run as requested
+	Result  Result
+	Error   string `json:",omitempty"` // why the run failed, if it did
+}
+
+// runLog appends records to the file named by -test.benchserve.log.
+type runLog struct {
+	mu     sync.Mutex
+	f      *os.File
+	format string            // "json" or "benchfmt"
+	labels map[string]string // labels in effect in a benchfmt log
+}
+
+// openRunLog opens the run log requested by flags, if any.
+func openRunLog() (*runLog, error) {
+	if *benchServeLog == "" {
+		return nil, nil
+	}
+	format := *benchServeLogFormat
+	if format != "json" && format != "benchfmt" {
+		return nil, fmt.Errorf("unknown -test.benchserve.logformat %q", format)
+	}
+	f, err := os.OpenFile(*benchServeLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &runLog{f: f, format: format}
+	if format == "benchfmt" {
+		// Configuration lines apply to the results that follow them,
+		// so repeat them each time the log is opened.
+		benchfmtHeader(f)
+	}
+	return l, nil
+}
+
+// benchfmtHeader writes the configuration lines that begin
+// the server's results in the Go benchmark format.
+func benchfmtHeader(w io.Writer) {
+	fmt.Fprintf(w, "goos: %s\ngoarch: %s\n", runtime.GOOS, runtime.GOARCH)
+	if v := virtualization(); v != "" {
+		fmt.Fprintf(w, "virtualization: %s\n", v)
+	}
+	for _, u := range registeredUnits() {
+		fmt.Fprintf(w, "Unit %s better=%s\n", u.Name, u.Better)
+	}
+}
+
+// close flushes the log to stable storage and closes it.
+func (l *runLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.f.Sync(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// write appends rec to the log.
+func (l *runLog) write(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var buf []byte
+	switch l.format {
+	case "json":
+		var err error
+		buf, err = json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, '\n')
+	case "benchfmt":
+		if rec.Error != "" {
+			// benchfmt has no way to represent failed runs.
+			return nil
+		}
+		var b bytes.Buffer
+		benchfmtLabels(&b, l.labels, rec.Run.Labels)
+		l.labels = rec.Run.Labels
+		b.Write(benchfmtLine(rec.Run, rec.Result))
+		buf = b.Bytes()
+	}
+	// A single write per record, so that each record is
+	// either entirely present or entirely absent.
+	_, err := l.f.Write(buf)
+	return err
+}
+
+// benchfmtLine formats r in the Go benchmark format,
+// as 'go test -bench' would print it.
+func benchfmtLine(run Run, r Result) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(run.Name)
+	if run.Procs != 1 {
+		fmt.Fprintf(&buf, "-%d", run.Procs)
+	}
+	fmt.Fprintf(&buf, "\t%s", r.BenchmarkResult.String())
+	if r.ReportAllocs {
+		fmt.Fprintf(&buf, "\t%s", r.MemString())
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// record logs a completed run.
+func (s *Server) record(run Run, r Result, err error) {
+	s.mu.Lock()
+	s.runs++
+	s.lastRun = time.Now()
+	s.benchTime += r.T
+	if err == nil {
+		if s.latest == nil {
+			s.latest = make(map[runKey]float64)
+		}
+		s.latest[runKey{run.Name, run.Procs}] = nsPerOp(r)
+	}
+	rec := Record{Time: time.Now(), Binary: binaryHash(), Options: s.sess().opt, Run: run, Result: r}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if len(s.completed) >= maxCompleted {
+		s.completed = s.completed[1:]
+	}
+	s.completed = append(s.completed, rec)
+	s.mu.Unlock()
+	if s.runLog != nil {
+		if err := s.runLog.write(rec); err != nil {
+			logger.Warn("write run log", "err", err)
+		}
+	}
+	if s.history != nil {
+		if err := s.history.add(rec); err != nil {
+			logger.Warn("write history", "err", err)
+		}
+	}
+	if s.stream != nil {
+		s.stream.send(rec)
+	}
+	if s.export != nil && err == nil {
+		s.export(rec)
+	}
+}
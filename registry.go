@@ -0,0 +1,93 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultRegistry is the default directory in which servers register
+// themselves, so that all servers run by a user on a host can be found.
+// It can be changed with the -test.benchserve.registry flag.
+var DefaultRegistry = filepath.Join(os.TempDir(), "benchserve-"+strconv.Itoa(os.Getuid()))
+
+// registryFile returns the registry entry for this process, if registration is enabled.
+func registryFile() string {
+	if *benchServeRegistry == "" {
+		return ""
+	}
+	return filepath.Join(*benchServeRegistry, strconv.Itoa(os.Getpid())+".json")
+}
+
+// register adds a to the registry.
+func register(a Announcement) error {
+	file := registryFile()
+	if file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	// Write and rename, so that no one sees a partial file.
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// unregister removes this process's registry entry, if any.
+func unregister() {
+	if file := registryFile(); file != "" {
+		os.Remove(file)
+	}
+}
+
+// Registered returns the servers registered in the registry directory dir,
+// usually DefaultRegistry, sorted by address.
+// Entries left behind by servers that are no longer listening are removed.
+func Registered(dir string) ([]Announcement, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var list []Announcement
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			continue // removed concurrently
+		}
+		var a Announcement
+		if err := json.Unmarshal(buf, &a); err != nil || !listening(a.Addr) {
+			os.Remove(file)
+			continue
+		}
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Addr < list[j].Addr })
+	return list, nil
+}
+
+// listening reports whether something accepts connections at addr.
+func listening(addr string) bool {
+	// Dial the loopback address for servers listening on all interfaces.
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			addr = net.JoinHostPort("localhost", port)
+		}
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
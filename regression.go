@@ -0,0 +1,108 @@
+package benchserve
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CheckRegression requests a check of a benchmark against a baseline,
+// for use as a CI gate.
+type CheckRegression struct {
+	Run Run // the run to check; each sample runs N iterations
+
+	// Baseline is the name of a baseline saved by SaveBaseline or,
+	// failing that, the hash of a baseline test binary, as reported by
+	// History. The baseline's runs of the same benchmark and procs,
+	// or the binary's in the history store, are the baseline samples.
+	Baseline string
+
+	// Threshold is the largest acceptable slowdown of the median ns/op,
+	// as a fraction, default 0.05 (5%). Smaller significant slowdowns pass.
+	Threshold float64
+
+	Count int     // number of samples to take, default 10
+	Alpha float64 // significance level, default 0.05
+}
+
+// RegressionVerdict is the result of a CheckRegression request.
+type RegressionVerdict struct {
+	Comparison // of the baseline (Old) with the new samples (New)
+
+	// Regressed reports whether the benchmark is significantly slower
+	// than the baseline, by more than the Threshold.
+	// Improved reports whether it is significantly faster,
+	// by more than the Threshold.
+	Regressed bool
+	Improved  bool
+
+	// Pass reports whether the check passed: whether the benchmark did not regress.
+	Pass bool
+}
+
+// CheckRegression runs a benchmark, compares its samples with those
+// of a baseline binary in the history store, as Compare does,
+// and returns a pass or fail verdict with the change and its significance.
+func (s *Server) CheckRegression(args CheckRegression, reply *RegressionVerdict) error {
+	if args.Baseline == "" {
+		return errors.New("no baseline")
+	}
+	threshold := args.Threshold
+	if threshold <= 0 {
+		threshold = 0.05
+	}
+	var bl Baseline
+	var ok bool
+	if s.baselines != nil {
+		var err error
+		if bl, ok, err = s.baselines.get(args.Baseline); err != nil {
+			return err
+		}
+	}
+	if ok {
+		if err := s.compareBaseline(bl, args, &reply.Comparison); err != nil {
+			return err
+		}
+	} else {
+		cmp := Compare{Old: args.Run, New: args.Run, Count: args.Count, OldBinary: args.Baseline, Alpha: args.Alpha}
+		if err := s.Compare(cmp, &reply.Comparison); err != nil {
+			return err
+		}
+	}
+	reply.Regressed = reply.Significant && reply.Delta > threshold
+	reply.Improved = reply.Significant && reply.Delta < -threshold
+	reply.Pass = !reply.Regressed
+	return nil
+}
+
+// compareBaseline compares new samples of args.Run with those in bl,
+// as Compare does with OldBinary.
+func (s *Server) compareBaseline(bl Baseline, args CheckRegression, reply *Comparison) error {
+	count := args.Count
+	if count <= 0 {
+		count = 10
+	}
+	alpha := args.Alpha
+	if alpha <= 0 {
+		alpha = 0.05
+	}
+	for _, rec := range bl.Records {
+		if rec.Run.Name == args.Run.Name && rec.Run.Procs == args.Run.Procs {
+			reply.Old = append(reply.Old, nsPerOp(rec.Result))
+		}
+	}
+	if len(reply.Old) < 2 {
+		return fmt.Errorf("baseline %s has %d runs of %s; need at least 2", bl.Name, len(reply.Old), args.Run.Name)
+	}
+	if len(reply.Old) > count {
+		reply.Old = reply.Old[len(reply.Old)-count:]
+	}
+	for i := 0; i < count; i++ {
+		r, err := s.run(args.Run)
+		if err != nil {
+			return err
+		}
+		reply.New = append(reply.New, nsPerOp(r))
+	}
+	reply.analyze(alpha)
+	return nil
+}
@@ -0,0 +1,146 @@
+package benchserve
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Reload requests replacing the server's test binary.
+type Reload struct {
+	Path string // slash-separated path of the new test binary, relative to the file sandbox
+}
+
+// Reload replaces the server with the test binary at args.Path
+// in the file sandbox, typically uploaded first with PutFile.
+// It checks that the new binary is a test binary that supports benchserve,
+// then waits for any running benchmark to finish and replies.
+// Shortly afterwards the server re-executes itself as the new binary,
+// with the same flags and process ID, and resumes serving on the same address.
+//
+// All client connections are closed; clients should reconnect.
+// Changes made by Setenv, Unsetenv, and Chdir are undone,
+// and jobs that have not finished are lost, unless they are
+// persisted with -test.benchserve.jobs.
+// Reload is only supported on Unix systems.
+func (s *Server) Reload(args Reload, reply *struct{}) error {
+	if err := checkReadOnly("Reload"); err != nil {
+		return err
+	}
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	path, err := sandboxPath(args.Path)
+	if err != nil {
+		return err
+	}
+	// PutFile does not preserve modes.
+	if err := os.Chmod(path, 0o755); err != nil {
+		return err
+	}
+	if err := verifyBinary(path); err != nil {
+		return err
+	}
+	return s.reexec(path)
+}
+
+// Restart re-executes the running test binary, so that the server
+// continues in a completely fresh process: a new heap, runtime,
+// and package state. As with Reload, the server keeps its flags,
+// process ID, and address; Restart replies first, and all client
+// connections are then closed.
+// Restart is only supported on Unix systems.
+func (s *Server) Restart(args struct{}, reply *struct{}) error {
+	if err := checkReadOnly("Restart"); err != nil {
+		return err
+	}
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return s.reexec(exe)
+}
+
+// verifyBinary checks that path is a test binary that supports benchserve,
+// by checking that its usage message mentions -test.benchserve.
+func verifyBinary(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, path, "-h").CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s: timed out checking binary", path)
+	}
+	if !bytes.Contains(out, []byte("-test.benchserve")) {
+		return fmt.Errorf("%s is not a benchserve test binary", path)
+	}
+	return nil
+}
+
+// restartDelay is how long reexec waits before replacing the process,
+// to give the reply to the requesting client time to be sent.
+const restartDelay = 100 * time.Millisecond
+
+// reexec arranges to replace the server process with the binary at path,
+// once any running benchmark has finished.
+func (s *Server) reexec(path string) error {
+	if !canExec {
+		return errors.New("re-executing the server is not supported on this system")
+	}
+	s.runMu.Lock()
+	// Never unlocked on success: nothing else may run before the exec.
+	// Sessions' changes to the environment apply only during runs,
+	// so the environment is the server's own.
+	env := os.Environ()
+	if dir := tempArtifactDir(); dir != "" {
+		// Keep serving the artifacts of earlier runs.
+		env = append(env, artifactDirEnv+"="+dir)
+	}
+
+	time.AfterFunc(restartDelay, func() {
+		teardownFixtures()
+		err := execServer(path, s.tcp, env)
+		logger.Error("restart", "err", err)
+		s.runMu.Unlock()
+	})
+	return nil
+}
+
+// listenerEnv is the environment variable through which
+// a server passes its listener's file descriptor to its replacement.
+const listenerEnv = "BENCHSERVE_LISTENER_FD"
+
+// inheritedListener returns the listener passed by a predecessor
+// that re-executed itself, if any.
+func inheritedListener() (*net.TCPListener, error) {
+	v, ok := os.LookupEnv(listenerEnv)
+	if !ok {
+		return nil, nil
+	}
+	// Keep the variable from leaking into test processes.
+	os.Unsetenv(listenerEnv)
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s=%q", listenerEnv, v)
+	}
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("inherited listener: %v", err)
+	}
+	tcp, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("inherited listener is not TCP")
+	}
+	return tcp, nil
+}
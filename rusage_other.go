@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package benchserve
+
+import "time"
+
+// processCPUTime returns the CPU time used by the process.
+// It is not implemented on this system.
+func processCPUTime() time.Duration { return 0 }
+
+// processBlockIO returns the block I/O operations performed by the process.
+// It is not implemented on this system.
+func processBlockIO() (in, out int64) { return 0, 0 }
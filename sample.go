@@ -0,0 +1,283 @@
+package benchserve
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample requests repeated runs of a single benchmark,
+// stopping once the results are precise enough or time runs out.
+type Sample struct {
+	Run // the benchmark run to repeat; each sample runs N iterations
+
+	// Precision is the target half-width of the 95% confidence interval
+	// for ns/op, as a fraction of the mean. For example, 0.01 requests
+	// sampling until the mean is known to within ±1%.
+	// Zero means sample until another limit is hit.
+	Precision float64
+
+	Budget     time.Duration // maximum total time to spend sampling; zero means no limit
+	MinSamples int           // minimum number of samples to take, default 3
+	MaxSamples int           // maximum number of samples to take; zero means no limit, or 100 without a Budget
+
+	Retry RetryPolicy // which samples to take again; by default, none
+}
+
+// SampleStats summarizes the ns/op of some samples.
+type SampleStats struct {
+	N        int // number of samples
+	Mean     float64
+	Median   float64
+	Stddev   float64
+	Min, Max float64
+}
+
+// RetryPolicy selects samples to retry, so that one failed or noisy sample
+// does not cost a driver on a slow link a round trip to replace.
+type RetryPolicy struct {
+	// Failed retries samples whose runs fail, instead of failing
+	// the request. Cancellation by Server.Cancel still stops sampling.
+	Failed bool
+
+	// MADs, if positive, retries samples whose ns/op is more than
+	// this many median absolute deviations from the median of the
+	// samples kept so far, including it. Outliers are only detected
+	// once there are at least three samples.
+	MADs float64
+
+	// Max is the maximum number of retries for the whole request,
+	// default 3. Once it is reached, samples are kept as they are.
+	Max int
+}
+
+// Reasons for which samples are retried.
+const (
+	RetryFailed  = "failed"  // the run failed
+	RetryOutlier = "outlier" // the run was too far from the median
+)
+
+// RetriedSample describes a sample that was retried.
+type RetriedSample struct {
+	Index  int    // index of the sample in SampleResult.Samples
+	Reason string // RetryFailed or RetryOutlier
+	Err    string `json:",omitempty"` // the error, for failed runs
+}
+
+// defaultMaxSamples is the MaxSamples of a Sample limited only by Precision.
+const defaultMaxSamples = 100
+
+// Reasons for which Sample stops.
+const (
+	StopPrecision = "precision" // the Precision target was reached
+	StopBudget    = "budget"    // another sample would have exceeded the Budget
+	StopSamples   = "samples"   // MaxSamples samples were taken
+	StopCanceled  = "canceled"  // the last sample was canceled by Server.Cancel
+)
+
+// SampleResult is the result of a Sample request.
+type SampleResult struct {
+	Samples   []Result // all samples, in the order they were taken
+	Mean      float64  // mean ns/op across samples
+	HalfWidth float64  // half-width of the 95% confidence interval for Mean, in ns/op, or zero if unknown
+	Stop      string   // why sampling stopped; one of the Stop constants
+
+	// Retried lists the samples that were retried under Sample.Retry.
+	// They are left out of Mean, HalfWidth, and LayoutStddev, and do
+	// not count toward MinSamples or MaxSamples.
+	Retried []RetriedSample `json:",omitempty"`
+
+	// Outliers lists, by index in Samples, the samples kept whose ns/op
+	// lies more than 1.5 interquartile ranges below the first quartile
+	// or above the third, by Tukey's rule, once there are at least four.
+	// The server does not discard them: Mean and HalfWidth include them.
+	// All and Inliers summarize the samples kept with and without them,
+	// so that drivers can apply their own policy.
+	Outliers []int `json:",omitempty"`
+	All      SampleStats
+	Inliers  SampleStats
+
+	// LayoutStddev is, for isolated runs with RandomizeLayout,
+	// the estimated standard deviation of ns/op due to memory layout alone,
+	// or zero if unknown. It is estimated by taking samples in pairs
+	// that share a layout, and comparing the variation between pairs
+	// to that within them.
+	LayoutStddev float64
+}
+
+// Sample runs a benchmark repeatedly until the 95% confidence interval
+// of its ns/op is narrow enough or a limit is reached.
+func (s *Server) Sample(args Sample, reply *SampleResult) error {
+	if err := args.setDefaults(); err != nil {
+		return err
+	}
+	maxRetries := args.Retry.Max
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+
+	var ns []float64 // of the samples kept
+	var kept []int   // indices of the samples kept
+	var layout int   // of the last sample kept
+	start := time.Now()
+	pairLayouts := args.Isolate && args.RandomizeLayout
+	for {
+		run := args.Run
+		if pairLayouts && len(ns)%2 == 1 {
+			// Repeat the previous sample's layout.
+			run.RandomizeLayout = false
+			run.Layout = layout
+		}
+		r, err := s.run(run)
+		reply.Samples = append(reply.Samples, r)
+		if err == errCanceled {
+			reply.Stop = StopCanceled
+			return nil
+		}
+		retry := len(reply.Retried) < maxRetries
+		if err != nil && args.Retry.Failed && retry {
+			reply.Retried = append(reply.Retried, RetriedSample{Index: len(reply.Samples) - 1, Reason: RetryFailed, Err: err.Error()})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		x := nsPerOp(r)
+		if args.Retry.MADs > 0 && retry && outlier(append(ns, x), x, args.Retry.MADs) {
+			reply.Retried = append(reply.Retried, RetriedSample{Index: len(reply.Samples) - 1, Reason: RetryOutlier})
+			continue
+		}
+		ns = append(ns, x)
+		kept = append(kept, len(reply.Samples)-1)
+		layout = r.Layout
+		reply.annotate(ns, kept)
+
+		mean, hw := ci95(ns)
+		reply.Mean = mean
+		if !math.IsInf(hw, 0) {
+			reply.HalfWidth = hw
+		}
+		if pairLayouts {
+			reply.LayoutStddev = layoutStddev(ns)
+		}
+		if reply.Stop = args.stop(ns, len(reply.Samples), time.Since(start)); reply.Stop != "" {
+			return nil
+		}
+	}
+}
+
+// setDefaults sets the defaults of sa's limits,
+// or returns an error if it has none.
+func (sa *Sample) setDefaults() error {
+	if sa.Precision <= 0 && sa.Budget <= 0 && sa.MaxSamples <= 0 {
+		return fmt.Errorf("Sample requires a Precision, Budget, or MaxSamples limit")
+	}
+	if sa.MinSamples <= 0 {
+		sa.MinSamples = 3
+	}
+	if sa.Budget <= 0 && sa.MaxSamples <= 0 {
+		// A noisy benchmark might never reach the Precision.
+		sa.MaxSamples = defaultMaxSamples
+	}
+	return nil
+}
+
+// stop returns the reason to stop sampling, one of the Stop constants,
+// once the samples ns are kept out of taken samples in all, taken
+// in elapsed time, or "" to take another. Its defaults must be set.
+func (sa *Sample) stop(ns []float64, taken int, elapsed time.Duration) string {
+	mean, hw := ci95(ns)
+	n := len(ns)
+	if n >= sa.MinSamples && sa.Precision > 0 && hw <= sa.Precision*mean {
+		return StopPrecision
+	}
+	if sa.MaxSamples > 0 && n >= sa.MaxSamples {
+		return StopSamples
+	}
+	// Stop if another sample of the same length would exceed the budget.
+	if sa.Budget > 0 && elapsed+elapsed/time.Duration(taken) > sa.Budget {
+		return StopBudget
+	}
+	return ""
+}
+
+// layoutStddev estimates the standard deviation due to layout
+// of samples taken in pairs sharing a layout: x[0] and x[1], x[2] and x[3], and so on.
+// By one-way analysis of variance, the variance of the pair means
+// is the layout variance plus half the variance within a layout.
+func layoutStddev(x []float64) float64 {
+	pairs := len(x) / 2
+	if pairs < 2 {
+		return 0
+	}
+	means := make([]float64, pairs)
+	var within float64
+	for i := range means {
+		a, b := x[2*i], x[2*i+1]
+		means[i] = (a + b) / 2
+		within += (a - b) * (a - b) / 2
+	}
+	within /= float64(pairs)
+	_, sd := meanStddev(means)
+	if v := sd*sd - within/2; v > 0 {
+		return math.Sqrt(v)
+	}
+	return 0
+}
+
+// outlier reports whether x is more than k median absolute deviations
+// from the median of samples, which include x.
+func outlier(samples []float64, x, k float64) bool {
+	if len(samples) < 3 {
+		return false
+	}
+	med, dev := medianAbsDev(samples)
+	return dev > 0 && math.Abs(x-med) > k*dev
+}
+
+// annotate sets r's Outliers, All, and Inliers from the ns/op values
+// of the samples kept and their indices in r.Samples.
+func (r *SampleResult) annotate(ns []float64, kept []int) {
+	var outliers []int
+	outliers, r.All, r.Inliers = tukey(ns)
+	r.Outliers = nil
+	for _, i := range outliers {
+		r.Outliers = append(r.Outliers, kept[i])
+	}
+}
+
+// tukey returns the indices in ns of the values that lie more than
+// 1.5 interquartile ranges outside the quartiles, once there are
+// at least four values, and the statistics of ns with and without them.
+func tukey(ns []float64) (outliers []int, all, inliers SampleStats) {
+	in := ns
+	if len(ns) >= 4 {
+		sorted := append([]float64(nil), ns...)
+		sort.Float64s(sorted)
+		q1, q3 := quantile(sorted, 0.25), quantile(sorted, 0.75)
+		lo, hi := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+		in = nil
+		for i, x := range ns {
+			if x < lo || x > hi {
+				outliers = append(outliers, i)
+			} else {
+				in = append(in, x)
+			}
+		}
+	}
+	return outliers, sampleStats(ns), sampleStats(in)
+}
+
+// sampleStats summarizes the ns/op values x.
+func sampleStats(x []float64) SampleStats {
+	if len(x) == 0 {
+		return SampleStats{}
+	}
+	st := SampleStats{N: len(x)}
+	st.Mean, st.Stddev = meanStddev(x)
+	sorted := append([]float64(nil), x...)
+	st.Median = median(sorted)
+	st.Min, st.Max = sorted[0], sorted[len(sorted)-1]
+	return st
+}
@@ -0,0 +1,117 @@
+package benchserve
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSampleDefaults(t *testing.T) {
+	if err := new(Sample).setDefaults(); err == nil {
+		t.Errorf("Sample with no limits: no error")
+	}
+	for _, tt := range []struct {
+		in       Sample
+		min, max int
+	}{
+		// Precision alone might never be reached.
+		{Sample{Precision: 0.01}, 3, defaultMaxSamples},
+		{Sample{Precision: 0.01, Budget: time.Minute}, 3, 0},
+		{Sample{Precision: 0.01, MaxSamples: 500}, 3, 500},
+		{Sample{MaxSamples: 5, MinSamples: 2}, 2, 5},
+	} {
+		sa := tt.in
+		if err := sa.setDefaults(); err != nil || sa.MinSamples != tt.min || sa.MaxSamples != tt.max {
+			t.Errorf("%+v: MinSamples %d, MaxSamples %d, %v; want %d, %d", tt.in, sa.MinSamples, sa.MaxSamples, err, tt.min, tt.max)
+		}
+	}
+}
+
+func TestSampleStop(t *testing.T) {
+	steady := []float64{100, 100.5, 99.5, 100, 100.2}
+	noisy := []float64{100, 150, 60, 130, 80}
+	for _, tt := range []struct {
+		name    string
+		sa      Sample
+		ns      []float64
+		taken   int
+		elapsed time.Duration
+		want    string
+	}{
+		{"precise", Sample{Precision: 0.01}, steady, 5, time.Second, StopPrecision},
+		{"too few to be precise", Sample{Precision: 0.01}, steady[:2], 2, time.Second, ""},
+		{"MinSamples", Sample{Precision: 0.01, MinSamples: 10}, steady, 5, time.Second, ""},
+		{"imprecise", Sample{Precision: 0.01}, noisy, 5, time.Second, ""},
+		{"imprecise at the default cap", Sample{Precision: 0.01}, repeat(noisy, 20), 100, time.Second, StopSamples},
+		{"MaxSamples", Sample{MaxSamples: 5}, noisy, 5, time.Second, StopSamples},
+		{"retries do not count toward MaxSamples", Sample{MaxSamples: 6}, noisy, 6, time.Second, ""},
+		// Each sample took a second; another would end at 6s.
+		{"within budget", Sample{Budget: 6 * time.Second}, noisy, 5, 5 * time.Second, ""},
+		{"over budget", Sample{Budget: 5500 * time.Millisecond}, noisy, 5, 5 * time.Second, StopBudget},
+		// Retried samples count toward the time per sample.
+		{"budget with retries", Sample{Budget: 6 * time.Second}, noisy[:4], 5, 5 * time.Second, ""},
+		{"precision before budget", Sample{Precision: 0.01, Budget: time.Second}, steady, 5, 5 * time.Second, StopPrecision},
+	} {
+		sa := tt.sa
+		if err := sa.setDefaults(); err != nil {
+			t.Fatal(err)
+		}
+		if got := sa.stop(tt.ns, tt.taken, tt.elapsed); got != tt.want {
+			t.Errorf("%s: stop = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// repeat returns n copies of x, concatenated.
+func repeat(x []float64, n int) []float64 {
+	var y []float64
+	for i := 0; i < n; i++ {
+		y = append(y, x...)
+	}
+	return y
+}
+
+func TestOutlier(t *testing.T) {
+	kept := []float64{100, 101, 99, 102}
+	for _, tt := range []struct {
+		samples []float64
+		x       float64
+		want    bool
+	}{
+		// Median 101, MAD 1.
+		{append(kept, 150), 150, true},
+		{append(kept, 103), 103, false},
+		{append(kept, 104), 104, true},
+		// Too few samples to tell.
+		{[]float64{100, 150}, 150, false},
+		// No spread.
+		{[]float64{100, 100, 100, 100}, 100, false},
+	} {
+		if got := outlier(tt.samples, tt.x, 2); got != tt.want {
+			t.Errorf("outlier(%v, %v, 2) = %v, want %v", tt.samples, tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	var r SampleResult
+	// Quartiles 11 and 12.75, so the fences are 8.375 and 15.375.
+	ns := []float64{10, 11, 50, 12, 11, 13}
+	kept := []int{0, 2, 3, 4, 5, 7}
+	r.annotate(ns, kept)
+	if want := []int{3}; !reflect.DeepEqual(r.Outliers, want) {
+		t.Errorf("Outliers = %v, want %v", r.Outliers, want)
+	}
+	if want := (SampleStats{N: 6, Mean: 107.0 / 6, Median: 11.5, Stddev: r.All.Stddev, Min: 10, Max: 50}); r.All != want {
+		t.Errorf("All = %+v, want %+v", r.All, want)
+	}
+	if want := (SampleStats{N: 5, Mean: 11.4, Median: 11, Stddev: r.Inliers.Stddev, Min: 10, Max: 13}); r.Inliers != want || !near(r.Inliers.Stddev, 1.140175, 1e-6) {
+		t.Errorf("Inliers = %+v, want %+v with Stddev 1.140175", r.Inliers, want)
+	}
+
+	// Outliers are only marked among four or more samples.
+	r.annotate(ns[:3], kept[:3])
+	if r.Outliers != nil || r.All != r.Inliers || r.All.N != 3 {
+		t.Errorf("with 3 samples: Outliers %v, All %+v, Inliers %+v", r.Outliers, r.All, r.Inliers)
+	}
+}
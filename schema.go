@@ -0,0 +1,170 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is a machine-readable description of the server's methods
+// and the fields of their arguments and results, for writing clients
+// in languages other than Go. It is an OpenRPC document.
+type Schema struct {
+	OpenRPC string `json:"openrpc"`
+	Info    struct {
+		Title   string `json:"title"`
+		Version string `json:"version"` // hash of the test binary
+	} `json:"info"`
+	Methods    []MethodSchema `json:"methods"`
+	Components struct {
+		Schemas map[string]*TypeSchema `json:"schemas"` // by Go type name
+	} `json:"components"`
+}
+
+// MethodSchema describes a method of the server.
+type MethodSchema struct {
+	Name   string              `json:"name"` // such as "Server.Run"
+	Params []ContentDescriptor `json:"params"`
+	Result ContentDescriptor   `json:"result"`
+}
+
+// ContentDescriptor describes a parameter or result of a method.
+type ContentDescriptor struct {
+	Name   string      `json:"name"`
+	Schema *TypeSchema `json:"schema"`
+}
+
+// TypeSchema is a JSON Schema describing the encoding of a Go type.
+type TypeSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]*TypeSchema `json:"properties,omitempty"`
+	Items                *TypeSchema            `json:"items,omitempty"`
+	AdditionalProperties *TypeSchema            `json:"additionalProperties,omitempty"`
+}
+
+// Schema describes the server's methods.
+// Each takes a single parameter and returns a single result. In JSON-RPC,
+// the parameter is sent as the sole element of the params array;
+// in the JSON-lines protocol, it is the params object of a LineRequest.
+// The same description is served as /openapi.json on -test.benchserve.http.
+func (s *Server) Schema(args struct{}, reply *Schema) error {
+	*reply = newSchema()
+	return nil
+}
+
+// newSchema describes the RPC methods of Server.
+func newSchema() Schema {
+	var sc Schema
+	sc.OpenRPC = "1.2.6"
+	sc.Info.Title = "benchserve"
+	sc.Info.Version = binaryHash()
+	sc.Components.Schemas = make(map[string]*TypeSchema)
+
+	for _, m := range rpcMethods() {
+		sc.Methods = append(sc.Methods, MethodSchema{
+			Name:   "Server." + m.name,
+			Params: []ContentDescriptor{{"args", sc.typeSchema(m.args)}},
+			Result: ContentDescriptor{"reply", sc.typeSchema(m.reply)},
+		})
+	}
+	sort.Slice(sc.Methods, func(i, j int) bool { return sc.Methods[i].Name < sc.Methods[j].Name })
+	return sc
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// typeSchema returns the schema of t as encoded by encoding/json,
+// adding named struct types to sc's components.
+func (sc *Schema) typeSchema(t reflect.Type) *TypeSchema {
+	switch t {
+	case timeType:
+		return &TypeSchema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &TypeSchema{Type: "integer", Format: "int64", Description: "duration in nanoseconds"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &TypeSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &TypeSchema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &TypeSchema{Type: "integer", Format: "int32"}
+	case reflect.Float32, reflect.Float64:
+		return &TypeSchema{Type: "number"}
+	case reflect.String:
+		return &TypeSchema{Type: "string"}
+	case reflect.Pointer:
+		return sc.typeSchema(t.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &TypeSchema{Type: "string", Format: "byte"}
+		}
+		return &TypeSchema{Type: "array", Items: sc.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &TypeSchema{Type: "object", AdditionalProperties: sc.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sc.structSchema(t)
+		}
+		if _, ok := sc.Components.Schemas[t.Name()]; !ok {
+			sc.Components.Schemas[t.Name()] = nil // guard against recursion
+			sc.Components.Schemas[t.Name()] = sc.structSchema(t)
+		}
+		return &TypeSchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	// Interfaces may hold anything.
+	return &TypeSchema{}
+}
+
+// structSchema returns the schema of struct type t,
+// with the fields that encoding/json encodes.
+func (sc *Schema) structSchema(t reflect.Type) *TypeSchema {
+	ts := &TypeSchema{Type: "object", Properties: make(map[string]*TypeSchema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// Encoded as if its fields were t's.
+				for k, v := range sc.structSchema(ft).Properties {
+					if _, ok := ts.Properties[k]; !ok {
+						ts.Properties[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ts.Properties[name] = sc.typeSchema(f.Type)
+	}
+	return ts
+}
+
+// serveSchema serves the Schema as JSON.
+func serveSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	buf, err := json.MarshalIndent(newSchema(), "", "\t")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf)
+}
@@ -0,0 +1,38 @@
+package benchserve
+
+import "time"
+
+// Stats describes the server's workload since it started.
+type Stats struct {
+	Uptime time.Duration // time since the server started
+
+	Runs          int64         // number of completed benchmark runs
+	BenchmarkTime time.Duration // total measured time of those runs, the sum of their T
+	BusyTime      time.Duration // total time spent running benchmarks and tests, including overhead
+	CPUTime       time.Duration // CPU time used by the server process, if known
+	LastRun       time.Time     // when the most recent run completed, or zero if none
+
+	Running    string // name of the benchmark or test currently running, or empty if idle
+	QueueDepth int    // runs, lease requests, and jobs waiting for the server
+}
+
+// Stats reports the server's Stats, for schedulers choosing
+// the least busy of several servers or watching for hung ones.
+func (s *Server) Stats(args struct{}, reply *Stats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*reply = Stats{
+		Uptime:        time.Since(s.startTime),
+		Runs:          s.runs,
+		BenchmarkTime: s.benchTime,
+		BusyTime:      s.busyTime,
+		CPUTime:       processCPUTime(),
+		LastRun:       s.lastRun,
+		Running:       s.running,
+		QueueDepth:    s.waiting + len(s.lease.queue) + len(s.jobQueue),
+	}
+	if s.running != "" {
+		reply.BusyTime += time.Since(s.started)
+	}
+	return nil
+}
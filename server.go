@@ -22,11 +22,95 @@
 // flags, including the usual benchmarking and profiling flags,
 // and instead start the benchmark server.
 //
-// The benchmark server uses JSON-RPC.
-// By default, it listens on :52525. Use the -test.benchserve.addr
-// flag to set a different host:port.
-// The server only serves a single request at a time.
-// Serving requests concurrency could skew benchmark results.
+// The benchmark server speaks a simple protocol of newline-delimited JSON,
+// described at LineRequest, whose errors carry codes and retry hints.
+// For existing drivers it also speaks JSON-RPC, as implemented by
+// net/rpc/jsonrpc, on the same port; clients for which JSON is too costly
+// may instead speak MessagePack-RPC. Server.Schema describes the server's
+// methods and their arguments and results as an OpenRPC document,
+// also served as /openapi.json by -test.benchserve.http.
+// By default, it listens on 127.0.0.1:52525, so only local programs
+// can connect. Use the -test.benchserve.expose flag to listen on
+// port 52525 of all interfaces instead, or the -test.benchserve.addr
+// flag to set a different host:port. Use port 0 to pick any free port.
+// The HTTP endpoints of -test.benchserve.http, which are unauthenticated,
+// likewise listen only on localhost when given just a port, such as :8080,
+// unless -test.benchserve.expose is set.
+// Once listening, the server prints an Announcement as a single line
+// of JSON to stdout, and writes it to the file named by the
+// -test.benchserve.portfile flag, if set.
+// The server can also be started by systemd socket activation,
+// in which case it serves the socket it is passed; with
+// -test.benchserve.exitidle, it exits when idle, to be started
+// again on the next connection. With -test.benchserve.daemon, the
+// server detaches from the terminal and runs in the background,
+// the starting process exiting once it has printed the Announcement;
+// -test.benchserve.pidfile names a file to which to write its process ID.
+//
+// The server also registers itself in a per-user directory on the host,
+// so that the servers of several test binaries, which must use
+// different ports, can be listed with Registered or cmd/benchls.
+// To make the server findable from other machines with Discover,
+// use the -test.benchserve.announce flag to name it; it then
+// multicasts its Announcement on the local network.
+//
+// To serve over TLS, set -test.benchserve.tlscert and -test.benchserve.tlskey.
+// To additionally require client certificates,
+// set -test.benchserve.tlsclientca to a file of PEM-encoded CA certificates.
+//
+// The -test.benchserve.allow and -test.benchserve.deny flags
+// restrict the benchmarks that the server exposes.
+// They accept patterns with the same semantics as -test.bench.
+// The -test.benchserve.readonly flag grants clients measurement
+// without control of the process: Kill, Restart, Reload,
+// the environment RPCs such as Setenv, file transfer, and webhooks
+// other than -test.benchserve.webhook are disabled.
+// To keep a runaway client from piling up work, -test.benchserve.maxqueue
+// bounds the number of queued jobs and -test.benchserve.ratelimit the
+// requests per minute from each client host; requests beyond the limits
+// fail with a Busy error saying when to try again.
+// As a backstop against requests for far too many iterations,
+// -test.benchserve.maxrun limits the duration of any single run,
+// whatever the client asks for.
+//
+// Runs can be held, for example while the machine is in use, with
+// Server.Pause and Server.Resume, or restricted to quiet hours with
+// -test.benchserve.window. While runs are held, direct requests
+// for them fail with a Busy error and jobs wait.
+//
+// Completed runs can be pushed to InfluxDB or an OpenTelemetry collector
+// with -test.benchserve.export, given once per destination as
+// influx=URL (a line protocol write endpoint) or otlp=URL
+// (an OTLP/HTTP metrics endpoint). Exported results are labeled
+// with the host name, any labels set by -test.benchserve.labels,
+// and the run's own Run.Labels.
+// For pipelines that consume results as they land, such as with tail -f,
+// -test.benchserve.stream also writes each completed run as a line
+// of JSON to a file or FIFO, an inherited file descriptor (fd:N),
+// or every client connected to a separate TCP address (tcp:host:port).
+//
+// The server logs problems and lifecycle events to standard error,
+// or to the file named by -test.benchserve.logfile.
+// With -test.benchserve.v, it also logs every request it serves.
+// Separately, it keeps an audit trail of recent requests, their callers,
+// and their outcomes, for Server.Audit; -test.benchserve.audit
+// appends every entry to a file as well.
+//
+// On SIGINT or SIGTERM, the server finishes the current run, if any,
+// and exits with status ExitSignaled. On SIGQUIT or SIGUSR1, it writes
+// the status of its jobs and its goroutine stacks to standard error.
+//
+// The server accepts concurrent connections,
+// but only runs a single benchmark at a time.
+// Running benchmarks concurrently could skew benchmark results.
+// A driver that needs exclusive use of the server for a series of runs
+// can take a lease with Server.Lock.
+// A driver that does not want to stay connected during a long series
+// of runs can submit them as a background job with Server.Submit.
+// Options set with Server.Set and changes made by Server.Setenv and
+// Server.Chdir apply only to the runs of the connection that made them,
+// or of the connections that share its session (see Server.Session),
+// so that one driver's settings never alter another's results.
 //
 // Benchserve relies on unexported details of the testing package,
 // which may change at any time. A request to officially support
@@ -34,24 +118,74 @@
 package benchserve
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"net"
 	"net/rpc"
-	"net/rpc/jsonrpc"
 	"os"
 	"reflect"
 	"runtime"
+	"runtime/pprof"
+	"sort"
 	"sync"
 	"testing"
 	"time"
-	"unsafe"
 )
 
 var (
-	benchServe     = flag.Bool("test.benchserve", false, "run a JSON-RPC benchmark server")
-	benchServeAddr = flag.String("test.benchserve.addr", ":52525", "`host:port` for the JSON-RPC benchmark server")
+	benchServe            = flag.Bool("test.benchserve", false, "run a JSON-RPC benchmark server")
+	benchServeAddr        = flag.String("test.benchserve.addr", "", "`host:port` for the JSON-RPC benchmark server (default 127.0.0.1:52525)")
+	benchServeExpose      = flag.Bool("test.benchserve.expose", false, "listen on all interfaces by default instead of only localhost")
+	benchServeExitIdle    = flag.Duration("test.benchserve.exitidle", 0, "exit after `duration` with no clients, runs, or jobs, as for systemd socket activation; zero disables")
+	benchServeIdleTimeout = flag.Duration("test.benchserve.idletimeout", 5*time.Minute, "drop client connections that send nothing for `duration`; zero disables")
+	benchServeKeepAlive   = flag.Duration("test.benchserve.keepalive", 15*time.Second, "TCP keep-alive period for client connections; negative disables keep-alives")
+	benchServePortfile    = flag.String("test.benchserve.portfile", "", "write the server's address as JSON to `file` once listening")
+	benchServeRegistry    = flag.String("test.benchserve.registry", DefaultRegistry, "register the server in `dir`, for Registered and benchls; empty disables")
+	benchServeAnnounce    = flag.String("test.benchserve.announce", "", "periodically announce the server on the local network under `name`, for Discover")
+	benchServeAllow       = flag.String("test.benchserve.allow", "", "only serve benchmarks matching `regexp`")
+	benchServeDeny        = flag.String("test.benchserve.deny", "", "do not serve benchmarks matching `regexp`")
+
+	benchServeLog          = flag.String("test.benchserve.log", "", "append every completed run to `file`")
+	benchServeLogFormat    = flag.String("test.benchserve.logformat", "json", "`format` of -test.benchserve.log: json (one Record per line) or benchfmt")
+	benchServeHistory      = flag.String("test.benchserve.history", "", "keep a history of all runs, queryable with Server.History, in `file`")
+	benchServeStream       = flag.String("test.benchserve.stream", "", "also write every completed run as a line of JSON to `target`: a file or FIFO, fd:N for an inherited file descriptor, or tcp:host:port to serve connecting clients")
+	benchServeCache        = flag.Bool("test.benchserve.cache", false, "answer repeated Run requests from a cache of earlier results, including those in -test.benchserve.history")
+	benchServeExport       listFlag // see init in export.go
+	benchServeJobs         = flag.String("test.benchserve.jobs", "", "persist submitted jobs in `dir`, resuming unfinished ones when the server restarts")
+	benchServeWebhook      = flag.String("test.benchserve.webhook", "", "POST the status of each finished job to `URL`, unless the job sets its own webhook")
+	benchServeWebhookHosts = flag.String("test.benchserve.webhookhosts", "", "comma-separated `hosts` to which jobs may set their own webhook; by default, only -test.benchserve.webhook is used")
+	benchServeLabels       = flag.String("test.benchserve.labels", "", "comma-separated `key=value` labels, such as commit=abc123, attached to exported results")
+
+	benchServeHTTP         = flag.String("test.benchserve.http", "", "serve HTTP endpoints, such as artifact downloads, on `host:port`; a bare :port means localhost unless -test.benchserve.expose is set")
+	benchServeDashboard    = flag.Bool("test.benchserve.dashboard", false, "serve a web dashboard for browsing and running benchmarks on -test.benchserve.http")
+	benchServeDebug        = flag.Bool("test.benchserve.debug", false, "serve pprof and expvar-style endpoints for the server process under /debug/ on -test.benchserve.http")
+	benchServeArtifacts    = flag.String("test.benchserve.artifacts", "", "store profiles and other artifacts in `dir` (default a temporary directory, removed when the server exits)")
+	benchServeMaxArtifacts = flag.Int("test.benchserve.maxartifacts", 1000, "keep only the newest `n` artifacts, removing older ones; zero means no limit")
+
+	benchServeFiles   = flag.String("test.benchserve.files", "", "allow clients to transfer files to and from `dir`")
+	benchServeMaxFile = flag.Int64("test.benchserve.maxfile", 64<<20, "maximum size in `bytes` of files transferred by clients")
+
+	benchServeMaxQueue  = flag.Int("test.benchserve.maxqueue", 0, "decline jobs with a Busy error while `n` are queued; zero means no limit")
+	benchServeReadOnly  = flag.Bool("test.benchserve.readonly", false, "disable RPCs that control the server process, change its environment, or transfer files")
+	benchServeStrict    = flag.Bool("test.benchserve.strict", false, "fail every run that leaves global state, such as GOMAXPROCS or the environment, changed, as with Run.Strict")
+	benchServeMaxRun    = flag.Duration("test.benchserve.maxrun", 0, "stop any run that takes longer than `duration`, and decline runs expected to; zero means no limit")
+	benchServeWindow    = flag.String("test.benchserve.window", "", "only run benchmarks between the local times `hh:mm-hh:mm`, such as 22:00-06:00, holding jobs until then")
+	benchServeRateLimit = flag.Int("test.benchserve.ratelimit", 0, "decline requests with a Busy error beyond `n` per minute from each client host; zero means no limit")
+
+	benchServeTLSCert     = flag.String("test.benchserve.tlscert", "", "serve TLS using the certificate in `file`")
+	benchServeTLSKey      = flag.String("test.benchserve.tlskey", "", "private key `file` for -test.benchserve.tlscert")
+	benchServeTLSClientCA = flag.String("test.benchserve.tlsclientca", "", "require TLS client certificates signed by a CA in `file`")
+
+	benchServeAudit   = flag.String("test.benchserve.audit", "", "append a record of every request served to `file`")
+	benchServeRecord  = flag.String("test.benchserve.record", "", "append every request and its response to `file`, for replay with benchreplay")
+	benchServeDaemon  = flag.Bool("test.benchserve.daemon", false, "run the server in the background, detached from the terminal, once it is listening")
+	benchServePIDFile = flag.String("test.benchserve.pidfile", "", "write the server's process ID to `file`")
+	benchServeV       = flag.Bool("test.benchserve.v", false, "log every request, with its duration and outcome")
+	benchServeLogfile = flag.String("test.benchserve.logfile", "", "write the server's log to `file` instead of standard error")
+
+	benchServeChild = flag.String("test.benchserve.child", "", "internal use only: perform the isolated run requested in `file`")
 )
 
 // Main runs a test binary.
@@ -89,15 +223,94 @@ func Serve(m *testing.M) {
 	if !*benchServe {
 		return
 	}
-	newServer(m).serve()
+	if *benchServeDaemon && *benchServeChild == "" {
+		daemonize()
+	}
+	if err := setupLogger(); err != nil {
+		fatal("bad -test.benchserve.logfile", "err", err)
+	}
+	s := newServer(m)
+	if *benchServeChild != "" {
+		if err := (&Server{server: s}).runChild(*benchServeChild); err != nil {
+			fatal("isolated run", "err", err)
+		}
+		os.Exit(0)
+	}
+	s.serve()
 	os.Exit(0)
 }
 
 // Server is a benchmark server.
 // It handles JSON-RPC requests.
+// Each client connection is handled by its own Server,
+// which shares benchmarks and run state with all the others.
 type Server struct {
-	m   map[string]testing.InternalBenchmark
-	opt Options
+	*server
+	client *client // the connection being served
+	job    *job    // the job on whose behalf runs are requested, if any
+}
+
+// server is the state shared by all connections.
+type server struct {
+	m     map[string]testing.InternalBenchmark
+	tests []testing.InternalTest
+	fuzz  []testing.InternalFuzzTarget
+
+	runLog    *runLog        // log of completed runs, if any
+	history   *history       // store of past runs, if any
+	baselines *baselineStore // saved baselines, if the history store is enabled
+	cache     *resultCache   // cached results of Run calls, if enabled
+	export    func(Record)   // queues a record for the exporters, if any
+	stream    *resultStream  // streams completed runs, if enabled
+	audit     *auditLog      // record of requests served
+	limiter   *rateLimiter   // limits clients' request rates, if enabled
+
+	startTime time.Time        // when the server started
+	tcp       *net.TCPListener // listener for JSON-RPC connections, for Reload
+
+	runMu sync.Mutex // held while running a benchmark
+
+	mu      sync.Mutex         // guards the following
+	running string             // name of the benchmark or test currently running, if any
+	started time.Time          // when it started
+	cancel  func()             // cancels the running benchmark or test
+	lease   lease              // exclusive use of the server, if any
+	waiting int                // number of runs waiting for runMu
+	runs    int64              // number of completed benchmark runs
+	latest  map[runKey]float64 // ns/op of the latest successful run of each benchmark
+
+	sessions  map[string]*session // sessions with tokens, by token
+	completed []Record            // recent completed runs, for Export
+
+	lastRun   time.Time     // when the most recent run completed
+	benchTime time.Duration // sum of the T of completed runs
+	busyTime  time.Duration // total time spent running, not counting the current run
+
+	conns      int       // number of connected clients
+	lastActive time.Time // when the server was last seen busy, for -test.benchserve.exitidle
+
+	heapLive map[string][]uint64 // live heap after recent runs of each benchmark, oldest first
+
+	jobs       map[string]*job // submitted and restored jobs, by ID; nil until there are any
+	jobQueue   []*job          // jobs waiting to run, in order
+	jobCond    *sync.Cond      // signaled when jobQueue grows or runs are resumed
+	jobStore   *jobStore       // persisted jobs, if enabled
+	runningJob *job            // the job whose run is running, if any
+
+	paused bool    // runs are held by Pause
+	window *window // hours in which runs may happen; nil means all day
+}
+
+// runKey identifies a benchmark run configuration.
+type runKey struct {
+	name  string
+	procs int
+}
+
+// A client is a connection to the server.
+type client struct {
+	addr string   // remote address
+	sess *session // the session the connection belongs to; guarded by server.mu
 }
 
 // Options control benchmarking behavior.
@@ -110,128 +323,924 @@ type Run struct {
 	Name  string // name of the benchmark to run
 	Procs int    // GOMAXPROCS value, equivalent to -test.cpu
 	N     int    // number of iterations to run, equivalent to b.N
+
+	CPUProfile bool // capture a CPU profile of the run, like -test.cpuprofile
+	Trace      bool // capture an execution trace of the run, like -test.trace
+
+	// BlockProfile and MutexProfile capture profiles of the run's
+	// blocking and mutex contention, like -test.blockprofile and
+	// -test.mutexprofile, recording every event. They enable the profiles
+	// only for the duration of the run, overriding any rate set by the
+	// benchmark. The profiles are in the legacy text format,
+	// which go tool pprof reads.
+	BlockProfile bool `json:",omitempty"`
+	MutexProfile bool `json:",omitempty"`
+
+	// LeakStacks requests the stacks of any goroutines leaked by the run,
+	// in Result.LeakedStacks.
+	LeakStacks bool
+
+	// Strict fails the run if the benchmark leaves GOMAXPROCS, GOGC,
+	// GOMEMLIMIT, the environment, or the working directory changed,
+	// or goroutines running, which would silently skew later runs.
+	// The error lists the changes, as does Result.Mutations, and the
+	// server undoes those it can. -test.benchserve.strict makes every
+	// run strict. Without it, the server only checks GOMAXPROCS.
+	Strict bool `json:",omitempty"`
+
+	// MinTime, if positive, repeats the run of N iterations until
+	// the repetitions have taken at least MinTime in total,
+	// for clocks too coarse to time N iterations precisely.
+	// Result.N is then the total, a multiple of N.
+	// It cannot be combined with Batches.
+	MinTime time.Duration
+
+	// Batches, if positive, splits the N iterations into this many batches,
+	// timed separately, and reports their distribution in Result.Latency.
+	// The mean alone hides, for example, bimodal costs caused by
+	// garbage collection or lock contention.
+	Batches int
+
+	// Parallelism, if positive, calls b.SetParallelism(Parallelism)
+	// before the benchmark runs, so that b.RunParallel starts
+	// Parallelism*Procs goroutines. The benchmark may still change it;
+	// Result.Config.Parallelism reports the value in effect.
+	Parallelism int `json:",omitempty"`
+
+	// CompareGC measures the run a second time, for N iterations,
+	// with the garbage collector off, and reports the second sample
+	// in Result.GCOff, so that the share of the cost due to garbage
+	// collection is explicit. The second sample is skipped if the run
+	// allocates more than can safely accumulate without collection.
+	// Profiles, IO counters, and the like cover both samples.
+	CompareGC bool `json:",omitempty"`
+
+	// Fresh requests a new run even if the server's result cache
+	// holds a result for an identical request.
+	Fresh bool
+
+	// Isolate runs the benchmark in a fresh child copy of the test binary,
+	// so that it is unaffected by state left behind by earlier runs.
+	Isolate bool
+
+	// Layout, for isolated runs, pads the child's environment by
+	// this many bytes, which shifts the addresses of its stack.
+	// RandomizeLayout instead picks a random padding for each run,
+	// so that repeated runs sample many memory layouts rather than
+	// all sharing the luck of one. Result.Layout reports the padding used.
+	Layout          int
+	RandomizeLayout bool
+
+	// Params holds parameters for the benchmark to read with Param,
+	// such as payload sizes or concurrency levels, so that drivers
+	// can sweep a parameter space without pre-enumerated sub-benchmarks.
+	Params map[string]string `json:",omitempty"`
+
+	// Fixtures names the fixtures registered with RegisterFixture
+	// that must be set up for the run. Fixtures set up for earlier runs
+	// but not named here are torn down first.
+	Fixtures []string `json:",omitempty"`
+
+	// Seed is the random seed for the run, returned by Seed.
+	// Drivers can repeat a seed to reproduce a run, or vary it
+	// to measure sensitivity to inputs. If zero, the server picks
+	// a random seed and reports it in Result.Seed.
+	Seed int64 `json:",omitempty"`
+
+	// Labels are arbitrary key-value pairs, such as commit=abc123
+	// or experiment=gc-tuning, that the server echoes in Result.Labels,
+	// the run log, and exported results, for joining results
+	// with the driver's own metadata. Keys follow the rules
+	// of benchfmt configuration keys, such as "commit".
+	// The benchmark's goroutines also carry them as pprof labels,
+	// along with benchmark, n, and procs, to attribute samples in
+	// profiles of the whole process to runs.
+	Labels map[string]string `json:",omitempty"`
+
+	// DropCaches syncs the disks and drops the operating system's
+	// page cache before the run, for benchmarks of cold I/O paths.
+	// It is only supported on Linux, requires the server to run as root,
+	// and is disabled by -test.benchserve.readonly, since it affects
+	// the whole machine.
+	DropCaches bool `json:",omitempty"`
+
+	// NUMANode, if set, binds an isolated run's threads to the CPUs
+	// of the given NUMA node and its memory to the node's memory,
+	// as numactl --cpunodebind=N --membind=N does, so that results
+	// do not vary with cross-node memory traffic. It requires Isolate
+	// and is only supported on Linux.
+	NUMANode *int `json:",omitempty"`
+
+	// Cores, if set, restricts the run's threads to some of the CPUs:
+	// PerformanceCores or EfficiencyCores, for the fastest or slowest
+	// cores of a machine with heterogeneous cores, such as an ARM
+	// big.LITTLE system, or a Linux CPU list such as "4-7".
+	// The cores are classified by the kernel's cpu_capacity or, failing
+	// that, their maximum frequency. Cores is only supported on Linux.
+	Cores string `json:",omitempty"`
 }
 
 // Result is the result of a single benchmark run.
 type Result struct {
 	testing.BenchmarkResult
 
+	// NsPerOp, AllocsPerOp, AllocedBytesPerOp, and MBPerSec are
+	// derived from the counters in BenchmarkResult, without rounding.
+	// MBPerSec is zero unless the benchmark called b.SetBytes.
+	// They shadow the BenchmarkResult methods of the same names.
+	NsPerOp           float64
+	AllocsPerOp       float64
+	AllocedBytesPerOp float64
+	MBPerSec          float64
+
+	// Labels are the Run.Labels of the run.
+	Labels map[string]string `json:",omitempty"`
+
+	// NUMANode is the Run.NUMANode of an isolated run, if any, and
+	// CPUs the CPUs on which the process could run, as a Linux CPU list
+	// such as "0-3,8", if known.
+	NUMANode *int   `json:",omitempty"`
+	CPUs     string `json:",omitempty"`
+
+	// Cluster is the cluster of cores to which CPUs belong on a machine
+	// with heterogeneous cores: PerformanceCores, EfficiencyCores,
+	// or "mixed". It is empty if the cores are all alike or unknown.
+	Cluster string `json:",omitempty"`
+
+	// DroppedCaches reports whether the page cache was dropped
+	// before the run, as requested by Run.DropCaches.
+	DroppedCaches bool `json:",omitempty"`
+
+	// Units describes the units of the metrics in Extra
+	// that were registered with RegisterUnit.
+	Units []Unit `json:",omitempty"`
+
 	// ReportAllocs reports whether allocations should be reported for this run.
 	// This might be set as a result of the current Options
 	// or because the benchmark called b.ReportAllocs.
 	ReportAllocs bool
 
+	// Loop reports whether the benchmark used b.Loop rather than b.N.
+	// Either way, it ran exactly N iterations.
+	Loop bool
+
+	// SetupTime is the time the benchmark spent before calling
+	// b.ResetTimer (or b.Loop, which calls it), excluded from T.
+	// If the benchmark later stopped and restarted the timer,
+	// it extends to the last restart. It is zero if the benchmark
+	// did not reset the timer, or if the server cannot tell,
+	// as on Windows.
+	SetupTime time.Duration
+
+	// Seed is the random seed used for the run. See Run.Seed.
+	Seed int64
+
+	// Config is the configuration with which the run was performed.
+	Config Config
+
+	// Artifacts holds the IDs of artifacts captured during the run,
+	// keyed by kind: "cpu" for CPU profiles, "trace" for execution traces,
+	// and "block" and "mutex" for contention profiles.
+	// Use Server.FetchArtifact to retrieve them.
+	Artifacts map[string]string
+
+	// Cached reports whether the result came from the server's cache
+	// rather than a new run.
+	Cached bool
+
+	// Layout is the environment padding used by an isolated run.
+	Layout int
+
+	// Latency is the distribution of ns/op across batches,
+	// if requested by Run.Batches.
+	Latency *Latency `json:",omitempty"`
+
+	// GCOff is the sample taken with the garbage collector off,
+	// if requested by Run.CompareGC, and GCFraction the fraction
+	// of NsPerOp attributable to garbage collection:
+	// 1 - GCOff.NsPerOp/NsPerOp. GCOffSkipped is the reason
+	// the sample was skipped, if it was.
+	GCOff        *Result `json:",omitempty"`
+	GCFraction   float64 `json:",omitempty"`
+	GCOffSkipped string  `json:",omitempty"`
+
+	// Start and End are the wall-clock times at which the run began and ended,
+	// for correlating results with other events on the machine.
+	// T is measured with the monotonic clock regardless.
+	Start, End time.Time
+
+	// Clock is the operating system's clock source, such as "tsc"
+	// on Linux, if known. TimerResolution is the smallest observed
+	// step of the clock; runs that take only a few steps are imprecise.
+	Clock           string
+	TimerResolution time.Duration
+
+	// Imprecise reports whether T is shorter than minClockSteps steps
+	// of TimerResolution, so that the clock's quantization may dominate
+	// the result. Use more iterations or Run.MinTime to avoid it.
+	Imprecise bool
+
+	// Before and After describe the machine's load immediately
+	// before and after the run. Drivers can use them to discard runs
+	// taken while the machine was busy or throttling.
+	Before, After SystemSnapshot
+
+	// Throttled reports whether the CPU was thermally throttled during
+	// the run, as far as Before and After show: throttling was in effect
+	// at either, or throttling events occurred between them.
+	// Throttled results, common on laptops, understate the code's speed.
+	Throttled bool `json:",omitempty"`
+
+	// Virtualization is Info.Virtualization: the emulator or hypervisor
+	// under which the run was performed, if any. Aggregators should not
+	// compare results from different environments, especially emulated
+	// ones, with native results.
+	Virtualization string `json:",omitempty"`
+
+	// IO is the I/O performed by the process during the run,
+	// for context on the throughput of I/O-bound benchmarks.
+	IO IOCounters
+
+	// Goroutines is the number of goroutines started but not finished
+	// by the run. Leaked goroutines can skew all later runs in the server.
+	// The count covers the whole process, so clients connecting
+	// during the run can perturb it.
+	// LeakedStacks holds their stacks, if requested by Run.LeakStacks.
+	Goroutines   int
+	LeakedStacks string `json:",omitempty"`
+
+	// Mutations describes the changes to global state made by
+	// a strict run, one per line, such as "GOGC: 100 -> off".
+	Mutations []string `json:",omitempty"`
+
+	// HeapLive is the size in bytes of the server's live heap after the run,
+	// measured after a garbage collection. HeapGrowing reports whether
+	// it grew after each of the last several runs of this benchmark,
+	// which suggests that the benchmark accumulates state across runs.
+	// They are not set for isolated runs.
+	HeapLive    uint64
+	HeapGrowing bool
+
+	// Canceled reports whether the run was interrupted by Server.Cancel
+	// or by -test.benchserve.maxrun.
+	// T then covers the time until the benchmark returned,
+	// which may have been after fewer than N iterations.
+	Canceled bool
+
 	// failed reports whether the benchmark run failed.
 	failed bool
+
+	// hasSub reports whether the benchmark called b.Run.
+	hasSub bool
 }
 
-func newServer(m *testing.M) *Server {
-	v := reflect.ValueOf(m).Elem().FieldByName("benchmarks")
-	benchmarks := *(*[]testing.InternalBenchmark)(unsafe.Pointer(v.UnsafeAddr())) // :(((
+func newServer(m *testing.M) *server {
+	if err := Compatible(); err != nil {
+		fatal("incompatible Go release", "err", err)
+	}
+	tests, benchmarks, fuzz := testFuncs(m)
+
+	allow, err := newMatcher(*benchServeAllow)
+	if err != nil {
+		fatal("bad -test.benchserve.allow", "err", err)
+	}
+	deny, err := newMatcher(*benchServeDeny)
+	if err != nil {
+		fatal("bad -test.benchserve.deny", "err", err)
+	}
 
-	s := Server{m: make(map[string]testing.InternalBenchmark)}
+	s := server{m: make(map[string]testing.InternalBenchmark), tests: tests, fuzz: fuzz, startTime: time.Now()}
+	s.lastActive = s.startTime
+	if s.runLog, err = openRunLog(); err != nil {
+		fatal("bad -test.benchserve.log", "err", err)
+	}
+	if s.audit, err = openAuditLog(); err != nil {
+		fatal("bad -test.benchserve.audit", "err", err)
+	}
+	if s.audit.traffic, err = openTrafficLog(); err != nil {
+		fatal("bad -test.benchserve.record", "err", err)
+	}
+	s.limiter = newRateLimiter()
+	if *benchServeHistory != "" {
+		s.history = &history{path: *benchServeHistory}
+		s.baselines = &baselineStore{path: *benchServeHistory + ".baselines"}
+	}
+	if *benchServeCache {
+		if s.cache, err = newResultCache(s.history); err != nil {
+			fatal("load cache from history", "err", err)
+		}
+	}
+	if s.export, err = startExporters(); err != nil {
+		fatal("bad -test.benchserve.export", "err", err)
+	}
+	if s.stream, err = openResultStream(); err != nil {
+		fatal("bad -test.benchserve.stream", "err", err)
+	}
+	s.lease.cond = sync.NewCond(&s.mu)
+	s.jobCond = sync.NewCond(&s.mu)
+	if s.window, err = parseWindow(*benchServeWindow); err != nil {
+		fatal("bad -test.benchserve.window", "err", err)
+	}
 	for _, b := range benchmarks {
+		if !allow.matches(b.Name) || deny != nil && deny.matches(b.Name) {
+			// Fenced off by the operator.
+			// Pretend the benchmark does not exist.
+			continue
+		}
 		if _, ok := s.m[b.Name]; ok {
 			// It is possible to define a benchmark with the same name
 			// twice in a single test binary, by defining it once
 			// in a regular test package and once in an external test package.
 			// Don't do that.
-			log.Fatalf("found two benchmarks named %s", b.Name)
+			fatal("found two benchmarks with the same name", "benchmark", b.Name)
 		}
 		s.m[b.Name] = b
 	}
+	if err := s.openJobStore(); err != nil {
+		fatal("bad -test.benchserve.jobs", "err", err)
+	}
 
 	return &s
 }
 
 // Serve starts the server. It blocks.
-func (s *Server) serve() {
-	rpc.Register(s)
-
-	l, err := net.Listen("tcp", *benchServeAddr)
+func (s *server) serve() {
+	l, tcp, err := listen()
 	if err != nil {
-		log.Fatalf("listen %v: %v", *benchServeAddr, err)
+		fatal("listen", "err", err)
 	}
 	defer l.Close()
+	s.tcp = tcp
+
+	if err := writePIDFile(); err != nil {
+		fatal("bad -test.benchserve.pidfile", "err", err)
+	}
+	a := s.announcement(l)
+	if err := announce(a); err != nil {
+		fatal("announce", "err", err)
+	}
+	if err := register(a); err != nil {
+		logger.Warn("register server", "err", err)
+	}
+	logger.Info("serving", "addr", a.Addr, "package", a.Package, "benchmarks", len(s.m))
+	if a.Name != "" {
+		go multicast(a)
+	}
+
+	if *benchServeHTTP != "" {
+		go s.serveHTTP()
+	}
+	go s.handleSignals()
+	if *benchServeExitIdle > 0 {
+		go s.exitWhenIdle(*benchServeExitIdle)
+	}
 
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			log.Fatalf("accept: %v", err)
+			fatal("accept", "err", err)
 		}
-		jsonrpc.ServeConn(conn)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn serves RPCs from conn until the client disconnects.
+func (s *server) serveConn(conn net.Conn) {
+	s.mu.Lock()
+	s.conns++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.conns--
+		s.lastActive = time.Now()
+		s.mu.Unlock()
+	}()
+	c := &client{addr: conn.RemoteAddr().String()}
+	srv := &Server{server: s, client: c}
+	if *benchServeIdleTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(*benchServeIdleTimeout))
+	}
+	r, proto := sniff(conn)
+	if proto == protoLines {
+		s.serveLines(srv, conn, r)
 		conn.Close()
+	} else {
+		rs := rpc.NewServer()
+		rs.Register(srv)
+		rs.ServeCodec(newServerCodec(conn, r, proto, s.audit, s.limiter))
 	}
+	s.disconnect(c)
+}
+
+// List requests the names of available benchmarks.
+type List struct {
+	// Pattern is a regular expression selecting benchmarks,
+	// with the same semantics as -test.bench.
+	// The empty pattern selects all benchmarks.
+	Pattern string
+
+	// Tags, if non-empty, selects only benchmarks
+	// with all of these tags, attached by Tag.
+	Tags []string `json:",omitempty"`
 }
 
-// List returns an unordered list of the available benchmark names.
-func (s *Server) List(args struct{}, names *[]string) error {
-	for _, b := range s.m {
-		*names = append(*names, b.Name)
+// List returns the sorted names of the available benchmarks
+// selected by args.
+func (s *Server) List(args List, names *[]string) error {
+	sel, err := s.selected(args)
+	// Keep the empty list allocated by net/rpc, which JSON-RPC
+	// clients distinguish from a missing result.
+	*names = append(*names, sel...)
+	return err
+}
+
+// names returns the sorted names of the benchmarks matching pattern.
+func (s *Server) names(pattern string) ([]string, error) {
+	m, err := newMatcher(pattern)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	var names []string
+	for name := range s.m {
+		if m.matches(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
 // Kill stops the benchmark server and its process.
 func (s *Server) Kill(args struct{}, reply *struct{}) error {
+	if err := checkReadOnly("Kill"); err != nil {
+		return err
+	}
+	teardownFixtures()
+	unregister()
+	removePIDFile()
+	removeArtifactDir()
 	os.Exit(0)
 	return nil
 }
 
-// Set sets the server's Options.
+// checkReadOnly returns an error for method, which controls
+// the server process or its host, if -test.benchserve.readonly is set.
+func checkReadOnly(method string) error {
+	if *benchServeReadOnly {
+		return fmt.Errorf("%s is disabled by -test.benchserve.readonly", method)
+	}
+	return nil
+}
+
+// Status describes what the server is doing.
+type Status struct {
+	Running string        // name of the benchmark or test currently running, or empty if idle
+	Elapsed time.Duration // how long it has been running
+
+	Leased       bool      // whether some client holds a lease on the server
+	LeaseHolder  string    // address of the client holding the lease
+	LeaseExpires time.Time // when the lease expires unless renewed
+	LeaseWaiters int       // number of clients waiting for a lease
+
+	Held string // why runs are held, by Pause or -test.benchserve.window, or empty if they are not
+}
+
+// Ping reports the server's Status.
+// It responds even while a benchmark is running,
+// so drivers can use it as a heartbeat during long runs.
+func (s *Server) Ping(args struct{}, reply *Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply.Running = s.running
+	if s.running != "" {
+		reply.Elapsed = time.Since(s.started)
+	}
+	if h := s.lease.holder; h != nil {
+		reply.Leased = true
+		reply.LeaseHolder = h.addr
+		reply.LeaseExpires = s.lease.expires
+	}
+	reply.LeaseWaiters = len(s.lease.queue)
+	if b := s.held(time.Now()); b != nil {
+		reply.Held = b.Reason
+	}
+	return nil
+}
+
+// Cancel cancels the running benchmark or test, if any.
+// Cancellation of benchmarks is cooperative: it cancels the benchmark's
+// b.Context, and the run ends when the benchmark notices and returns.
+// Benchmarks that ignore b.Context run to completion.
+// Tests and isolated benchmark runs run in a separate process, which is killed.
+func (s *Server) Cancel(args struct{}, reply *struct{}) error {
+	if err := s.checkLease(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return errors.New("no benchmark running")
+	}
+	s.cancel()
+	return nil
+}
+
+// Set sets the Options of the session's subsequent runs.
 func (s *Server) Set(args Options, reply *struct{}) error {
-	s.opt = args
+	s.mu.Lock()
+	s.sess().opt = args
+	s.mu.Unlock()
 	return nil
 }
 
 // Run runs a single benchmark.
+// If the run is canceled, Run succeeds with a Result marked Canceled.
+//
+// If the -test.benchserve.cache flag is set, Run returns the cached result
+// of an earlier identical request, if any, unless args.Fresh is set.
+// Requests are identical if they have the same binary, Options, and Run fields.
+// Requests with a zero Seed or with RandomizeLayout are never identical,
+// since each run picks its own. A cached result is returned only
+// once the request would otherwise have started to run.
 func (s *Server) Run(args Run, reply *Result) error {
+	r, err := s.runCached(args, s.cache)
+	*reply = r
+	if err == errCanceled {
+		return nil
+	}
+	return err
+}
+
+// acquire waits until nothing else is running and marks name as running.
+// The returned context is canceled by Server.Cancel.
+// The caller must call done when finished.
+func (s *Server) acquire(name string) (ctx context.Context, done func(), err error) {
+	if err := s.checkLease(); err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	s.waiting++
+	s.mu.Unlock()
+	s.runMu.Lock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.waiting--
+	if b := s.held(time.Now()); b != nil {
+		s.mu.Unlock()
+		s.runMu.Unlock()
+		cancel()
+		return nil, nil, b
+	}
+	s.mu.Unlock()
+	applied, undo, err := s.applySession()
+	if err != nil {
+		s.runMu.Unlock()
+		cancel()
+		return nil, nil, err
+	}
+	ctx = context.WithValue(ctx, sessionKey{}, applied)
+	s.mu.Lock()
+	s.running, s.started, s.cancel = name, time.Now(), cancel
+	s.runningJob = s.job
+	s.mu.Unlock()
+	done = func() {
+		s.mu.Lock()
+		s.busyTime += time.Since(s.started)
+		s.running, s.cancel = "", nil
+		s.runningJob = nil
+		s.mu.Unlock()
+		cancel()
+		undo()
+		s.runMu.Unlock()
+	}
+	return ctx, done, nil
+}
+
+// errCanceled is returned by run when Server.Cancel interrupts it.
+var errCanceled = errors.New("canceled")
+
+// run runs a single benchmark as requested by args.
+func (s *Server) run(args Run) (Result, error) {
+	return s.runCached(args, nil)
+}
+
+// runCached is like run, but first looks for a result in cache, if non-nil,
+// and adds the result to it if the run succeeds.
+func (s *Server) runCached(args Run, cache *resultCache) (Result, error) {
 	b, ok := s.m[args.Name]
 	if !ok {
-		return fmt.Errorf("%s not found", args.Name)
+		return Result{}, fmt.Errorf("%s not found", args.Name)
+	}
+
+	if err := s.checkMaxRun(args); err != nil {
+		return Result{}, err
+	}
+	if err := checkLabels(args.Labels); err != nil {
+		return Result{}, err
+	}
+	if args.NUMANode != nil && !args.Isolate {
+		return Result{}, fmt.Errorf("%s: NUMANode requires Isolate", args.Name)
+	}
+	if args.Parallelism < 0 {
+		return Result{}, fmt.Errorf("%s: negative Parallelism", args.Name)
+	}
+	if args.Cores != "" {
+		if _, err := selectCores(args.Cores); err != nil {
+			return Result{}, fmt.Errorf("%s: Cores: %v", args.Name, err)
+		}
+	}
+	if args.DropCaches {
+		if err := checkReadOnly("Run.DropCaches"); err != nil {
+			return Result{}, err
+		}
 	}
 
+	ctx, done, err := s.acquire(b.Name)
+	if err != nil {
+		return Result{}, err
+	}
+	defer done()
+
+	var key string
+	if cache != nil && cacheable(args) {
+		key = cacheKey(binaryHash(), args, s.options())
+		if r, ok := cache.get(key); ok && !args.Fresh {
+			r.Cached = true
+			r.Labels = args.Labels
+			return r, nil
+		}
+	}
+
+	if *benchServeMaxRun > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, *benchServeMaxRun)
+		defer cancel()
+	}
+
+	var r Result
+	if args.Isolate {
+		r, err = s.measureIsolated(ctx, args, s.options())
+	} else {
+		r, err = s.measure(ctx, b, args)
+		if r.N > 0 {
+			r.HeapLive, r.HeapGrowing = s.heapTrend(b.Name)
+		}
+	}
+	r.perOp()
+	if r.GCOff != nil && r.NsPerOp > 0 {
+		r.GCFraction = 1 - r.GCOff.NsPerOp/r.NsPerOp
+	}
+	r.Units = customUnits(r.Extra)
+	r.Labels = args.Labels
+	r.Config.Isolate = args.Isolate
+	r.Config.setSession(appliedSession(ctx))
+	if err == errCanceled && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%s stopped after -test.benchserve.maxrun of %v", args.Name, *benchServeMaxRun)
+	}
+	if r.N > 0 {
+		// The benchmark ran; record it, even if it failed.
+		s.record(args, r, err)
+	}
+	if err == nil && key != "" {
+		cache.put(key, r)
+	}
+	return r, err
+}
+
+// checkMaxRun returns an error if run is expected to take longer
+// than -test.benchserve.maxrun, judging by MinTime and by
+// the benchmark's ns/op in earlier runs, if any.
+func (s *Server) checkMaxRun(run Run) error {
+	max := *benchServeMaxRun
+	if max <= 0 {
+		return nil
+	}
+	if run.MinTime > max {
+		return fmt.Errorf("%s: MinTime %v exceeds -test.benchserve.maxrun of %v", run.Name, run.MinTime, max)
+	}
+	if ns, ok := s.lastNsPerOp(run); ok {
+		if d := time.Duration(ns * float64(run.N)); d > max {
+			return fmt.Errorf("%s: N=%d is expected to take %v, exceeding -test.benchserve.maxrun of %v", run.Name, run.N, d.Round(time.Millisecond), max)
+		}
+	}
+	return nil
+}
+
+// measure runs b as requested by args.
+// The caller must have acquired the server.
+func (s *Server) measure(ctx context.Context, b testing.InternalBenchmark, args Run) (Result, error) {
+	if err := useFixtures(args.Fixtures); err != nil {
+		return Result{}, err
+	}
+	seed := args.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	setParams(args.Params, seed)
+	defer setParams(nil, 0)
+	beforeRun(args.Name)
+	defer afterRun(args.Name)
+	if args.DropCaches {
+		if err := dropPageCache(); err != nil {
+			return Result{}, err
+		}
+	}
+	if args.Cores != "" {
+		cpus, err := selectCores(args.Cores)
+		if err != nil {
+			return Result{}, err
+		}
+		restore, err := pinProcess(cpus)
+		if err != nil {
+			return Result{}, err
+		}
+		defer restore()
+	}
 	runtime.GOMAXPROCS(args.Procs)
-	*reply = runBenchmark(b, args.N)
+	gogc, limit := gcSettings()
+	stop, err := startCapture(args)
+	if err != nil {
+		return Result{}, err
+	}
+	var stacks []byte
+	if args.LeakStacks {
+		stacks = allStacks()
+	}
+	strict := args.Strict || *benchServeStrict
+	var state globals
+	if strict {
+		state = snapshotGlobals()
+	}
+	goroutines := runtime.NumGoroutine()
+	before := snapshotSystem()
+	ioBefore := readIOCounters()
+	start := time.Now()
+	var r Result
+	// The benchmark's goroutines inherit the labels.
+	pprof.Do(ctx, profileLabels(args), func(ctx context.Context) {
+		if args.Batches > 0 {
+			r = runBatches(ctx, b, args.N, args.Parallelism, args.Batches)
+			return
+		}
+		r = runBenchmark(ctx, b, args.N, args.Parallelism, true)
+		for r.T < args.MinTime && !r.failed && !r.hasSub && ctx.Err() == nil {
+			r.add(runBenchmark(ctx, b, args.N, args.Parallelism, true))
+		}
+	})
+	if args.CompareGC && !r.failed && !r.hasSub && ctx.Err() == nil {
+		pprof.Do(ctx, profileLabels(args), func(ctx context.Context) {
+			r.GCOff, r.GCOffSkipped = measureGCOff(ctx, b, args, r)
+		})
+	}
+	r.Seed = seed
+	r.Config.N, r.Config.Procs = args.N, args.Procs
+	r.Config.MinTime, r.Config.Batches = args.MinTime, args.Batches
+	r.Config.GOGC, r.Config.MemoryLimit = gogc, limit
+	r.Config.GODEBUG = os.Getenv("GODEBUG")
+	r.DroppedCaches = args.DropCaches
+	r.CPUs = allowedCPUs()
+	r.Cluster = coreCluster(r.CPUs)
+	r.Start, r.End = start, time.Now()
+	r.Before, r.After = before, snapshotSystem()
+	r.Throttled = throttled(r.Before, r.After)
+	r.Virtualization = virtualization()
+	r.IO = readIOCounters().sub(ioBefore)
+	r.Goroutines = goroutineDelta(goroutines)
+	if args.LeakStacks && r.Goroutines > 0 {
+		r.LeakedStacks = newStacks(stacks, allStacks())
+	}
+	r.Clock, r.TimerResolution = clockInfo()
+	r.Imprecise = r.T < minClockSteps*r.TimerResolution
+	r.Canceled = ctx.Err() != nil
+	if strict {
+		now := snapshotGlobals()
+		r.Mutations = state.diff(now)
+		if r.Goroutines > 0 {
+			r.Mutations = append(r.Mutations, fmt.Sprintf("goroutines: %d -> %d", goroutines, goroutines+r.Goroutines))
+		}
+		state.restore(now)
+	}
+	if r.Artifacts, err = stop(); err != nil {
+		return r, err
+	}
 
-	if reply.failed {
-		return fmt.Errorf("%s failed", args.Name)
+	if r.hasSub {
+		// As with go test, the benchmark's own measurement is meaningless.
+		return r, fmt.Errorf("%s has sub-benchmarks, which the server does not run separately", args.Name)
+	}
+	if r.failed {
+		return r, fmt.Errorf("%s failed", args.Name)
+	}
+	if r.Canceled {
+		return r, errCanceled
+	}
+	if len(r.Mutations) > 0 {
+		return r, errMutated(args.Name, r.Mutations)
 	}
 
 	if p := runtime.GOMAXPROCS(-1); p != args.Procs {
-		return fmt.Errorf("%s left GOMAXPROCS set to %d\n", b.Name, p)
+		return r, fmt.Errorf("%s left GOMAXPROCS set to %d\n", b.Name, p)
 	}
 
-	return nil
+	return r, nil
 }
 
-// runBenchmark runs b for the specified number of iterations.
-func runBenchmark(b testing.InternalBenchmark, n int) Result {
+// minClockSteps is the number of steps of the clock a run must span to
+// keep the error due to the clock's resolution to about 1%.
+const minClockSteps = 100
+
+// perOp sets r's per-iteration values, as testing computes them
+// but in floating point.
+func (r *Result) perOp() {
+	r.NsPerOp, r.AllocsPerOp, r.AllocedBytesPerOp, r.MBPerSec = 0, 0, 0, 0
+	if r.N <= 0 {
+		return
+	}
+	n := float64(r.N)
+	r.NsPerOp = float64(r.T.Nanoseconds()) / n
+	r.AllocsPerOp = float64(r.MemAllocs) / n
+	r.AllocedBytesPerOp = float64(r.MemBytes) / n
+	if r.Bytes > 0 && r.T > 0 {
+		r.MBPerSec = float64(r.Bytes) * n / 1e6 / r.T.Seconds()
+	}
+}
+
+// add adds the counts of the run x, of the same benchmark, to r.
+func (r *Result) add(x Result) {
+	r.N += x.N
+	r.T += x.T
+	r.Bytes = x.Bytes
+	r.Config.Parallelism = x.Config.Parallelism
+	r.MemAllocs += x.MemAllocs
+	r.MemBytes += x.MemBytes
+	r.ReportAllocs = r.ReportAllocs || x.ReportAllocs
+	r.Loop = r.Loop || x.Loop
+	r.SetupTime += x.SetupTime
+	r.failed = r.failed || x.failed
+	r.hasSub = r.hasSub || x.hasSub
+}
+
+// runBenchmark runs b for the specified number of iterations,
+// with the given b.SetParallelism value, if positive.
+// ctx is made available to the benchmark as b.Context.
+// If gc is set, it first collects garbage left by earlier runs.
+func runBenchmark(ctx context.Context, b testing.InternalBenchmark, n, par int, gc bool) Result {
 	var wg sync.WaitGroup
 	wg.Add(1)
 	tb := testing.B{N: n}
-	tb.SetParallelism(1)
+	if par <= 0 {
+		par = 1
+	}
+	tb.SetParallelism(par)
+	v := reflect.ValueOf(&tb).Elem()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	setContext(v, ctx, cancel)
+	setFixedN(v, n)
+	discardOutput(v)
 
+	var setup time.Duration
+	holdBenchmarkLock()
 	go func() {
 		defer wg.Done()
+		// Run cleanups even if the benchmark calls b.Fatal or b.SkipNow.
+		defer runCleanups(v)
 		// Try to get a comparable environment for each run
 		// by clearing garbage from previous runs.
-		runtime.GC()
+		if gc {
+			runtime.GC()
+		}
+		start := timerStart(v)
 		tb.ResetTimer()
+		markReset(v)
 		tb.StartTimer()
+		// Only plain reads while the timer runs,
+		// so that benchserve's own work is not measured.
+		var entry time.Time
+		if start != nil {
+			entry = *start
+		}
 		b.F(&tb)
 		tb.StopTimer()
+		// b.ResetTimer, and b.Loop's first call to it,
+		// mark the end of the benchmark's setup.
+		// StopTimer leaves the start time in place.
+		if wasReset(v) && start != nil {
+			setup = start.Sub(entry)
+		}
 	}()
 	wg.Wait()
 
-	v := reflect.ValueOf(tb)
-	var r Result
+	r := benchResult(v)
 	r.N = n
-	r.T = time.Duration(v.FieldByName("duration").Int())
-	r.Bytes = v.FieldByName("bytes").Int()
-	r.MemAllocs = v.FieldByName("netAllocs").Uint()
-	r.MemBytes = v.FieldByName("netBytes").Uint()
-	r.ReportAllocs = v.FieldByName("showAllocResult").Bool()
-	r.failed = v.FieldByName("failed").Bool()
+	r.SetupTime = setup
+	r.hasSub = hasSubBenchmarks(v)
+	if used, done := loopState(v); used {
+		r.Loop = true
+		// A benchmark that leaves a b.Loop loop early
+		// did not run all n iterations.
+		r.failed = r.failed || !done
+	}
 	return r
 }
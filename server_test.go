@@ -0,0 +1,53 @@
+package benchserve
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+// nop is a benchmark that does nothing.
+var nop = testing.InternalBenchmark{
+	Name: "BenchmarkNop",
+	F: func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+		}
+	},
+}
+
+// Batches after the first are not separated by garbage collections.
+func TestRunBatchesGC(t *testing.T) {
+	if os.Getenv("BENCHSERVE_TEST_CHILD") == "" {
+		// runBenchmark leaves testing's benchmarkLock held,
+		// which would block benchmarks run later by this process.
+		cmd := exec.Command(os.Args[0], "-test.run=^TestRunBatchesGC$")
+		cmd.Env = append(os.Environ(), "BENCHSERVE_TEST_CHILD=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	ctx := context.Background()
+	// The first run takes the lock, which costs a garbage collection.
+	runBenchmark(ctx, nop, 1, 1, false)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 10; i++ {
+		runBenchmark(ctx, nop, 100, 1, false)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.NumGC - before.NumGC; n != 0 {
+		t.Errorf("10 runs with gc=false: %d garbage collections, want 0", n)
+	}
+
+	runtime.ReadMemStats(&before)
+	runBatches(ctx, nop, 1000, 1, 10)
+	runtime.ReadMemStats(&after)
+	if n := after.NumGC - before.NumGC; n != 1 {
+		t.Errorf("10 batches: %d garbage collections, want 1", n)
+	}
+}
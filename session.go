@@ -0,0 +1,186 @@
+package benchserve
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"time"
+)
+
+// A session holds the Options, environment changes, and working directory
+// that apply to the runs requested by a client, so that clients
+// do not affect each other's results. Its fields are guarded by server.mu.
+type session struct {
+	token string             // handshake token; empty for a connection's own session
+	conns int                // number of connections using the session
+	opt   Options            // set by Set
+	env   map[string]*string // set by Setenv and Unsetenv; nil values unset the variable
+	dir   string             // absolute working directory set by Chdir, if any
+	timer *time.Timer        // ends the session once its last connection has closed
+}
+
+// sessionLinger is how long a session with a token outlives its last
+// connection, so that a client that reconnects finds its settings intact.
+const sessionLinger = 5 * time.Minute
+
+// Session requests joining a session.
+type Session struct {
+	// Token identifies the session to join. Connections that join
+	// with the same token share Options, environment changes, and
+	// working directory. An empty Token starts a new session
+	// with a random token.
+	Token string
+}
+
+// SessionInfo describes a session.
+type SessionInfo struct {
+	Token   string
+	Conns   int                // number of connections in the session
+	Options Options            // as set by Set
+	Env     map[string]*string // environment changes; null values unset the variable
+	Dir     string             // working directory set by Chdir, if any
+}
+
+// Session joins the connection to a session, keyed by a token, leaving
+// the one it was in. Each connection starts in a session of its own,
+// which ends when it disconnects; a session with a token ends
+// sessionLinger after its last connection disconnects, so that
+// a driver can reconnect to it. Ending a session discards its settings;
+// the server's own process state is never changed by them.
+// Jobs use the settings of the session of the connection that submitted
+// them, as they were at submission.
+func (s *Server) Session(args Session, reply *SessionInfo) error {
+	token := args.Token
+	if token == "" {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		token = "session-" + hex.EncodeToString(b[:])
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.sess()
+	sess := s.sessions[token]
+	if sess == nil {
+		sess = &session{token: token}
+		if s.sessions == nil {
+			s.sessions = make(map[string]*session)
+		}
+		s.sessions[token] = sess
+	}
+	if sess != old {
+		s.leave(old)
+		sess.conns++
+		if sess.timer != nil {
+			sess.timer.Stop()
+			sess.timer = nil
+		}
+		s.client.sess = sess
+	}
+	*reply = SessionInfo{Token: sess.token, Conns: sess.conns, Options: sess.opt, Env: sess.env, Dir: sess.dir}
+	return nil
+}
+
+// sess returns the connection's session, starting one if it has none.
+// The caller must hold s.mu.
+func (s *Server) sess() *session {
+	if s.client == nil {
+		s.client = &client{}
+	}
+	if s.client.sess == nil {
+		s.client.sess = &session{conns: 1}
+	}
+	return s.client.sess
+}
+
+// jobClient returns a client for a job submitted by the connection,
+// with a copy of its session, so that later changes to the session
+// do not affect the job.
+func (s *Server) jobClient() *client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sess()
+	c := &client{addr: s.client.addr, sess: &session{conns: 1, opt: sess.opt, dir: sess.dir}}
+	if len(sess.env) > 0 {
+		c.sess.env = make(map[string]*string, len(sess.env))
+		for k, v := range sess.env {
+			c.sess.env[k] = v
+		}
+	}
+	return c
+}
+
+// options returns the Options of the connection's session.
+func (s *Server) options() Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sess().opt
+}
+
+// leave removes a connection from sess. The caller must hold s.mu.
+func (s *server) leave(sess *session) {
+	if sess.conns--; sess.conns > 0 || sess.token == "" {
+		return
+	}
+	sess.timer = time.AfterFunc(sessionLinger, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if sess.conns == 0 && s.sessions[sess.token] == sess {
+			delete(s.sessions, sess.token)
+		}
+	})
+}
+
+// applySession applies the environment changes and working directory
+// of the connection's session to the server process, for a run,
+// and returns a copy of the settings it applied.
+// The caller must hold runMu, and must call undo when the run is done.
+func (s *Server) applySession() (applied session, undo func(), err error) {
+	s.mu.Lock()
+	sess := s.sess()
+	env := make(map[string]*string, len(sess.env))
+	for k, v := range sess.env {
+		env[k] = v
+	}
+	dir := sess.dir
+	applied = session{opt: sess.opt, dir: dir}
+	if len(env) > 0 {
+		applied.env = env
+	}
+	s.mu.Unlock()
+
+	var undos []func()
+	undo = func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+	for key, v := range env {
+		orig, had := os.LookupEnv(key)
+		if v == nil {
+			err = os.Unsetenv(key)
+		} else {
+			err = os.Setenv(key, *v)
+		}
+		if err != nil {
+			undo()
+			return session{}, nil, err
+		}
+		undos = append(undos, func() {
+			if had {
+				os.Setenv(key, orig)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			undo()
+			return session{}, nil, err
+		}
+		undos = append(undos, func() { os.Chdir(startDir) })
+	}
+	return applied, undo, nil
+}
@@ -0,0 +1,84 @@
+package benchserve
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+)
+
+// ExitSignaled is the exit status of a server shut down by a signal,
+// such as SIGINT or SIGTERM.
+const ExitSignaled = 3
+
+// handleSignals handles signals to the server process, forever.
+// The first shutdown signal makes the server finish the current run,
+// if any, and exit with status ExitSignaled; a second one makes it exit at once.
+// Dump signals, where the system has them, make it write the status
+// of its jobs and the stacks of its goroutines to standard error.
+func (s *server) handleSignals() {
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, shutdownSignals...)
+	dump := make(chan os.Signal, 1)
+	if len(dumpSignals) > 0 {
+		signal.Notify(dump, dumpSignals...)
+	}
+	stopping := false
+	for {
+		select {
+		case sig := <-shutdown:
+			if stopping {
+				logger.Warn("exiting without waiting for the current run", "signal", sig)
+				removeArtifactDir()
+				os.Exit(ExitSignaled)
+			}
+			stopping = true
+			logger.Info("shutting down after the current run", "signal", sig)
+			go s.shutdown(ExitSignaled)
+		case <-dump:
+			s.dump(os.Stderr)
+		}
+	}
+}
+
+// shutdown waits for the current run, if any, to finish,
+// then cleans up and exits with the given status.
+func (s *server) shutdown(code int) {
+	s.runMu.Lock()
+	// Never unlocked: nothing else may run before the exit.
+	teardownFixtures()
+	if s.runLog != nil {
+		if err := s.runLog.close(); err != nil {
+			logger.Warn("close run log", "err", err)
+		}
+	}
+	s.audit.close()
+	unregister()
+	removePIDFile()
+	removeArtifactDir()
+	logger.Info("exiting")
+	os.Exit(code)
+}
+
+// dump writes the status of the server and its jobs,
+// and the stacks of all goroutines, to w.
+func (s *server) dump(w io.Writer) {
+	s.mu.Lock()
+	fmt.Fprintf(w, "benchserve: up %v, %d runs\n", time.Since(s.startTime).Round(time.Second), s.runs)
+	if s.running != "" {
+		fmt.Fprintf(w, "running %s for %v\n", s.running, time.Since(s.started).Round(time.Millisecond))
+	}
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].status.Submitted.Before(jobs[k].status.Submitted) })
+	for _, j := range jobs {
+		st := j.status
+		fmt.Fprintf(w, "job %s: %s, %d of %d runs, submitted %s\n", st.ID, st.State, len(st.Runs), len(j.batch.Runs), st.Submitted.Format(time.RFC3339))
+	}
+	s.mu.Unlock()
+	fmt.Fprintf(w, "\n%s\n", allStacks())
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package benchserve
+
+import "os"
+
+var (
+	shutdownSignals = []os.Signal{os.Interrupt}
+	dumpSignals     []os.Signal
+)
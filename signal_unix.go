@@ -0,0 +1,13 @@
+//go:build unix
+
+package benchserve
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	dumpSignals     = []os.Signal{syscall.SIGQUIT, syscall.SIGUSR1}
+)
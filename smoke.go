@@ -0,0 +1,78 @@
+package benchserve
+
+import (
+	"strings"
+	"time"
+)
+
+// Smoke requests a smoke check of the benchmarks.
+type Smoke struct {
+	List // selects the benchmarks to check; all of them by default
+
+	Timeout time.Duration // for each benchmark, equivalent to -test.timeout; zero means no timeout
+}
+
+// Smoke check outcomes.
+const (
+	SmokeOK       = "ok"       // the benchmark ran
+	SmokeFailed   = "failed"   // the benchmark failed, as with b.Fatal
+	SmokePanicked = "panicked" // the benchmark panicked or timed out, or the test binary crashed
+	SmokeSkipped  = "skipped"  // the benchmark skipped itself, as with b.Skip
+)
+
+// SmokeRun is the outcome of the smoke check of a benchmark.
+type SmokeRun struct {
+	Name    string
+	Outcome string // SmokeOK, SmokeFailed, SmokePanicked, or SmokeSkipped
+
+	// Duration, Output, and OutputArtifact are as in TestResult.
+	Duration       time.Duration
+	Output         string
+	OutputArtifact string `json:",omitempty"`
+}
+
+// SmokeResult is the result of a Smoke check.
+type SmokeResult struct {
+	Runs []SmokeRun // in order of name
+
+	// Passed reports whether every benchmark ran or skipped itself.
+	Passed bool
+}
+
+// Smoke runs each selected benchmark for exactly one iteration,
+// to check that the whole suite can run at all before committing
+// a machine to a long campaign. As with RunTest, each benchmark runs
+// in a new copy of the test binary, so that failures and panics do not
+// affect the server or the other benchmarks, and its output is captured.
+func (s *Server) Smoke(args Smoke, reply *SmokeResult) error {
+	names, err := s.selected(args.List)
+	if err != nil {
+		return err
+	}
+	reply.Passed = true
+	for _, name := range names {
+		r, err := s.runTest(name, "^$", args.Timeout, "-test.bench="+exactPattern(name), "-test.benchtime=1x")
+		if err != nil {
+			return err
+		}
+		run := SmokeRun{Name: name, Duration: r.Duration, Output: r.Output, OutputArtifact: r.OutputArtifact}
+		switch {
+		case !r.Passed && (strings.HasPrefix(r.Output, "panic: ") || strings.Contains(r.Output, "\npanic: ")):
+			run.Outcome = SmokePanicked
+		case !r.Passed && strings.Contains(r.Output, "--- FAIL: "+name):
+			run.Outcome = SmokeFailed
+		case !r.Passed:
+			// Exited without reporting a failure, as with os.Exit.
+			run.Outcome = SmokePanicked
+		case strings.Contains(r.Output, "--- SKIP: "+name):
+			run.Outcome = SmokeSkipped
+		default:
+			run.Outcome = SmokeOK
+		}
+		if run.Outcome == SmokeFailed || run.Outcome == SmokePanicked {
+			reply.Passed = false
+		}
+		reply.Runs = append(reply.Runs, run)
+	}
+	return nil
+}
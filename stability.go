@@ -0,0 +1,114 @@
+package benchserve
+
+import (
+	"math"
+	"time"
+)
+
+// Stability requests a check of how repeatable some benchmarks' results are.
+type Stability struct {
+	Pattern string // benchmarks to check, with the same semantics as -test.bench
+	Procs   int    // GOMAXPROCS value, equivalent to -test.cpu
+
+	// N is the number of iterations of each run.
+	// If N is zero, it is chosen so that each run takes about Time,
+	// default 100ms.
+	N    int
+	Time time.Duration
+
+	Count int // number of runs of each benchmark, default 5
+
+	// Tolerance is the largest coefficient of variation
+	// of ns/op considered stable, default 0.05 (5%).
+	Tolerance float64
+}
+
+// StabilityResult describes the repeatability of a benchmark.
+type StabilityResult struct {
+	Name     string
+	N        int       // iterations per run
+	NsPerOp  []float64 // ns/op of each run, in order
+	Mean     float64   // mean ns/op
+	CV       float64   // coefficient of variation: standard deviation / Mean
+	Min, Max float64   // fastest and slowest ns/op
+	Spread   float64   // (Max - Min) / Min
+
+	// Outliers, All, and Inliers are as in SampleResult,
+	// with Outliers indexing NsPerOp.
+	Outliers []int `json:",omitempty"`
+	All      SampleStats
+	Inliers  SampleStats
+
+	// Stable reports whether CV is within the requested Tolerance.
+	// Unstable benchmarks make poor regression gates.
+	Stable bool
+
+	Err string // non-empty if the benchmark could not be run
+}
+
+// Stability runs each requested benchmark Count times and reports
+// the variation of its results, sorted by name.
+func (s *Server) Stability(args Stability, reply *[]StabilityResult) error {
+	count := args.Count
+	if count <= 0 {
+		count = 5
+	}
+	tol := args.Tolerance
+	if tol <= 0 {
+		tol = 0.05
+	}
+	d := args.Time
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	names, err := s.names(args.Pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		sr := StabilityResult{Name: name, N: args.N}
+		if sr.N <= 0 {
+			c := s.estimate(name, args.Procs, d)
+			if c.Err == errCanceled.Error() {
+				return errCanceled
+			}
+			if c.Err != "" {
+				sr.Err = c.Err
+				*reply = append(*reply, sr)
+				continue
+			}
+			sr.N = c.N
+		}
+		for i := 0; i < count; i++ {
+			r, err := s.run(Run{Name: name, Procs: args.Procs, N: sr.N})
+			if err == errCanceled {
+				return err
+			}
+			if err != nil {
+				sr.Err = err.Error()
+				break
+			}
+			sr.NsPerOp = append(sr.NsPerOp, nsPerOp(r))
+		}
+		if sr.Err == "" {
+			var sd float64
+			sr.Mean, sd = meanStddev(sr.NsPerOp)
+			sr.Min, sr.Max = math.Inf(1), math.Inf(-1)
+			for _, v := range sr.NsPerOp {
+				sr.Min = math.Min(sr.Min, v)
+				sr.Max = math.Max(sr.Max, v)
+			}
+			if sr.Mean > 0 {
+				sr.CV = sd / sr.Mean
+			}
+			if sr.Min > 0 {
+				sr.Spread = (sr.Max - sr.Min) / sr.Min
+			}
+			sr.Stable = sr.CV <= tol
+			sr.Outliers, sr.All, sr.Inliers = tukey(sr.NsPerOp)
+		}
+		*reply = append(*reply, sr)
+	}
+	return nil
+}
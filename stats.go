@@ -0,0 +1,283 @@
+package benchserve
+
+import (
+	"math"
+	"sort"
+)
+
+// nsPerOp returns r's time per iteration in nanoseconds.
+func nsPerOp(r Result) float64 {
+	if r.N <= 0 {
+		return 0
+	}
+	return float64(r.T.Nanoseconds()) / float64(r.N)
+}
+
+// meanStddev returns the mean and sample standard deviation of x.
+func meanStddev(x []float64) (mean, stddev float64) {
+	if len(x) == 0 {
+		return 0, 0
+	}
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	if len(x) < 2 {
+		return mean, 0
+	}
+	var ss float64
+	for _, v := range x {
+		ss += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(x)-1))
+}
+
+// t95 holds two-sided 95% critical values of Student's t distribution,
+// indexed by degrees of freedom.
+var t95 = [...]float64{
+	math.Inf(1),
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tCritical95 returns the two-sided 95% critical value of Student's t
+// distribution with df degrees of freedom.
+func tCritical95(df int) float64 {
+	switch {
+	case df < len(t95):
+		return t95[df]
+	case df <= 60:
+		return 2.000
+	case df <= 120:
+		return 1.980
+	}
+	return 1.960
+}
+
+// ci95 returns the mean of x and the half-width of its 95% confidence interval.
+// The half-width is +Inf when there are fewer than two values.
+func ci95(x []float64) (mean, halfWidth float64) {
+	mean, stddev := meanStddev(x)
+	if len(x) < 2 {
+		return mean, math.Inf(1)
+	}
+	return mean, tCritical95(len(x)-1) * stddev / math.Sqrt(float64(len(x)))
+}
+
+// median returns the median of x, which it sorts.
+func median(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sort.Float64s(x)
+	n := len(x)
+	if n%2 == 1 {
+		return x[n/2]
+	}
+	return (x[n/2-1] + x[n/2]) / 2
+}
+
+// quantile returns the p-quantile of the sorted values x,
+// interpolating linearly between the closest ranks.
+func quantile(x []float64, p float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	h := p * float64(len(x)-1)
+	i := int(h)
+	if i+1 >= len(x) {
+		return x[len(x)-1]
+	}
+	return x[i] + (h-float64(i))*(x[i+1]-x[i])
+}
+
+// medianAbsDev returns the median of x and the median absolute deviation
+// of x from it, without scaling, leaving x unchanged.
+func medianAbsDev(x []float64) (med, dev float64) {
+	y := append([]float64(nil), x...)
+	med = median(y)
+	for i, v := range x {
+		y[i] = math.Abs(v - med)
+	}
+	return med, median(y)
+}
+
+// normalCDF returns the standard normal cumulative distribution function at z.
+func normalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+// welchTTest returns the two-sided p-value of Welch's t-test
+// of the hypothesis that x and y have equal means.
+func welchTTest(x, y []float64) float64 {
+	if len(x) < 2 || len(y) < 2 {
+		return 1
+	}
+	mx, sx := meanStddev(x)
+	my, sy := meanStddev(y)
+	nx, ny := float64(len(x)), float64(len(y))
+	vx, vy := sx*sx/nx, sy*sy/ny
+	if vx+vy == 0 {
+		if mx == my {
+			return 1
+		}
+		return 0
+	}
+	t := (mx - my) / math.Sqrt(vx+vy)
+	df := (vx + vy) * (vx + vy) / (vx*vx/(nx-1) + vy*vy/(ny-1))
+	// P(|T| > |t|) = I_{df/(df+t²)}(df/2, 1/2).
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test
+// of the hypothesis that x and y come from the same distribution.
+// It uses the exact distribution of U for small samples without ties,
+// and otherwise the normal approximation with a tie correction.
+func mannWhitneyU(x, y []float64) float64 {
+	nx, ny := len(x), len(y)
+	if nx == 0 || ny == 0 {
+		return 1
+	}
+
+	// Rank the combined samples, averaging the ranks of ties.
+	type obs struct {
+		v   float64
+		inX bool
+	}
+	all := make([]obs, 0, nx+ny)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	var rankX, tieSum float64
+	ties := false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // mean of ranks i+1 through j
+		for k := i; k < j; k++ {
+			if all[k].inX {
+				rankX += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieSum += t*t*t - t
+		}
+		i = j
+	}
+	u := rankX - float64(nx*(nx+1))/2
+	mn := float64(nx * ny)
+
+	if !ties && nx+ny <= 40 {
+		// P(U <= u) and P(U >= u) from the exact distribution.
+		dist := uDistribution(nx, ny)
+		var lo, hi, total float64
+		for k, c := range dist {
+			total += c
+			if float64(k) <= u {
+				lo += c
+			}
+			if float64(k) >= u {
+				hi += c
+			}
+		}
+		return math.Min(1, 2*math.Min(lo, hi)/total)
+	}
+
+	n := float64(nx + ny)
+	sigma := math.Sqrt(mn / 12 * (n + 1 - tieSum/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	// Continuity correction.
+	z := (math.Abs(u-mn/2) - 0.5) / sigma
+	return math.Min(1, 2*(1-normalCDF(math.Max(z, 0))))
+}
+
+// uDistribution returns the number of orderings of samples of sizes m and n
+// giving each value of the Mann-Whitney U statistic, from 0 to m*n.
+func uDistribution(m, n int) []float64 {
+	// f[i][j][u] counts orderings of i x-values and j y-values with statistic u:
+	// the largest value is either an x, exceeding all j y-values,
+	// or a y, exceeding nothing in x.
+	f := make([][][]float64, m+1)
+	for i := range f {
+		f[i] = make([][]float64, n+1)
+		for j := range f[i] {
+			f[i][j] = make([]float64, i*j+1)
+			if i == 0 || j == 0 {
+				f[i][j][0] = 1
+				continue
+			}
+			for u := range f[i][j] {
+				if u >= j && u-j < len(f[i-1][j]) {
+					f[i][j][u] += f[i-1][j][u-j]
+				}
+				if u < len(f[i][j-1]) {
+					f[i][j][u] += f[i][j-1][u]
+				}
+			}
+		}
+	}
+	return f[m][n]
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b).
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly for x < (a+1)/(a+b+2).
+	if x < (a+1)/(a+b+2) {
+		return front * betaCF(a, b, x) / a
+	}
+	return 1 - front*betaCF(b, a, 1-x)/b
+}
+
+// betaCF evaluates the continued fraction for the incomplete beta function
+// by the modified Lentz method.
+func betaCF(a, b, x float64) float64 {
+	const tiny = 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		for _, num := range [2]float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,169 @@
+package benchserve
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether x and y differ by at most tol.
+func near(x, y, tol float64) bool {
+	return math.Abs(x-y) <= tol
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		x, y []float64
+		p    float64
+	}{
+		// Exact: 2 of the 20 orderings are as extreme.
+		{"3v3 separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"3v3 separated reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 0.1},
+		// Exact: 2 of 70.
+		{"4v4 separated", []float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 2.0 / 70},
+		// Exact: U = 1, and P(U <= 1) = 2/20.
+		{"3v3 overlapping", []float64{1, 2, 4}, []float64{3, 5, 6}, 0.2},
+		{"3v3 interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		// Normal approximation with tie and continuity corrections:
+		// U = 2.5, σ = 3.3594, z = 1.4884.
+		{"ties", []float64{1, 2, 2, 3}, []float64{2, 3, 4, 5}, 0.136658},
+		{"all tied", []float64{7, 7, 7}, []float64{7, 7, 7}, 1},
+		{"empty", nil, []float64{1, 2}, 1},
+	} {
+		if p := mannWhitneyU(tt.x, tt.y); !near(p, tt.p, 1e-6) {
+			t.Errorf("%s: mannWhitneyU(%v, %v) = %v, want %v", tt.name, tt.x, tt.y, p, tt.p)
+		}
+	}
+}
+
+func TestMannWhitneyULarge(t *testing.T) {
+	// Beyond 40 values, the normal approximation is used even without ties.
+	var x, y []float64
+	for i := 0; i < 21; i++ {
+		x = append(x, float64(i))
+		y = append(y, float64(i)+0.5)
+	}
+	// U = 210 of 441, σ = 39.752, z = 0.2516.
+	if p := mannWhitneyU(x, y); !near(p, 0.801383, 1e-6) {
+		t.Errorf("mannWhitneyU of interleaved samples = %v, want 0.801383", p)
+	}
+}
+
+func TestUDistribution(t *testing.T) {
+	want := []float64{1, 1, 2, 3, 3, 3, 3, 2, 1, 1}
+	got := uDistribution(3, 3)
+	if len(got) != len(want) {
+		t.Fatalf("uDistribution(3, 3) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("uDistribution(3, 3) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWelchTTest(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		x, y []float64
+		p    float64
+		tol  float64
+	}{
+		// The examples of the Wikipedia article on Welch's t-test,
+		// which gives p to two significant figures.
+		{
+			"equal sizes",
+			[]float64{27.5, 21.0, 19.0, 23.6, 17.0, 17.9, 16.9, 20.1, 21.9, 22.6, 23.1, 19.6, 19.0, 21.7, 21.4},
+			[]float64{27.1, 22.0, 20.8, 23.4, 23.4, 23.5, 25.8, 22.0, 24.8, 20.2, 21.9, 22.1, 22.9, 20.5, 24.4},
+			0.021, 0.0005,
+		},
+		{
+			"unequal sizes",
+			[]float64{19.8, 20.4, 19.6, 17.8, 18.5, 18.9, 18.3, 18.9, 19.5, 22.0},
+			[]float64{28.2, 26.6, 20.1, 23.3, 25.2, 22.1, 17.7, 27.6, 20.6, 13.7, 23.2, 17.5, 20.6, 18.0, 23.9, 21.6, 24.3, 20.4, 23.9, 13.3},
+			0.035, 0.001,
+		},
+		// With 2 degrees of freedom, p = 1 - |t|/sqrt(t²+2).
+		{"df 2", []float64{0, 2}, []float64{1, 3}, 1 - 1/math.Sqrt(5), 1e-9},
+		{"zero variance, equal", []float64{5, 5, 5}, []float64{5, 5}, 1, 0},
+		{"zero variance, unequal", []float64{5, 5, 5}, []float64{6, 6}, 0, 0},
+		{"too few", []float64{1}, []float64{2, 3}, 1, 0},
+	} {
+		if p := welchTTest(tt.x, tt.y); !near(p, tt.p, tt.tol) {
+			t.Errorf("%s: welchTTest = %v, want %v", tt.name, p, tt.p)
+		}
+	}
+}
+
+func TestRegIncBeta(t *testing.T) {
+	for _, tt := range []struct {
+		a, b, x, want float64
+	}{
+		{1, 1, 0.3, 0.3},
+		{2, 1, 0.3, 0.09},            // x^a
+		{1, 3, 0.3, 1 - 0.7*0.7*0.7}, // 1-(1-x)^b
+		{4.5, 4.5, 0.5, 0.5},         // symmetry
+		{0.5, 0.5, 0.25, 1.0 / 3},    // 2/π asin(√x)
+		{2, 3, 0.9, 0.9963},          // P(Binomial(4, x) >= 2)
+		{3, 2, 0, 0},
+		{3, 2, 1, 1},
+	} {
+		if got := regIncBeta(tt.a, tt.b, tt.x); !near(got, tt.want, 1e-10) {
+			t.Errorf("regIncBeta(%v, %v, %v) = %v, want %v", tt.a, tt.b, tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestTCritical95(t *testing.T) {
+	for _, tt := range []struct {
+		df   int
+		want float64
+	}{
+		{1, 12.706},
+		{10, 2.228},
+		{30, 2.042},
+		{31, 2.000},
+		{60, 2.000},
+		{61, 1.980},
+		{120, 1.980},
+		{121, 1.960},
+	} {
+		if got := tCritical95(tt.df); got != tt.want {
+			t.Errorf("tCritical95(%d) = %v, want %v", tt.df, got, tt.want)
+		}
+	}
+	if !math.IsInf(tCritical95(0), 1) {
+		t.Errorf("tCritical95(0) = %v, want +Inf", tCritical95(0))
+	}
+}
+
+func TestCI95(t *testing.T) {
+	mean, hw := ci95([]float64{1, 2, 3, 4, 5})
+	// stddev √2.5, t 2.776 for 4 degrees of freedom.
+	if want := 2.776 * math.Sqrt(2.5) / math.Sqrt(5); mean != 3 || !near(hw, want, 1e-12) {
+		t.Errorf("ci95 = %v ± %v, want 3 ± %v", mean, hw, want)
+	}
+	if mean, hw := ci95([]float64{7}); mean != 7 || !math.IsInf(hw, 1) {
+		t.Errorf("ci95 of one value = %v ± %v, want 7 ± +Inf", mean, hw)
+	}
+}
+
+func TestQuantiles(t *testing.T) {
+	x := []float64{4, 1, 3, 2}
+	if m := median(x); m != 2.5 {
+		t.Errorf("median = %v, want 2.5", m)
+	}
+	// median sorts x.
+	for _, tt := range []struct{ p, want float64 }{{0, 1}, {0.25, 1.75}, {0.5, 2.5}, {0.75, 3.25}, {1, 4}} {
+		if q := quantile(x, tt.p); q != tt.want {
+			t.Errorf("quantile(%v, %v) = %v, want %v", x, tt.p, q, tt.want)
+		}
+	}
+	y := []float64{1, 2, 3, 4, 100}
+	if med, dev := medianAbsDev(y); med != 3 || dev != 1 {
+		t.Errorf("medianAbsDev(%v) = %v, %v, want 3, 1", y, med, dev)
+	}
+	if y[4] != 100 {
+		t.Errorf("medianAbsDev changed its argument to %v", y)
+	}
+}
@@ -0,0 +1,116 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// streamQueue is the number of lines buffered per stream reader.
+// Lines are dropped when a reader falls further behind.
+const streamQueue = 1000
+
+// A resultStream writes every completed run, as a Record encoded
+// as a single line of JSON, to the target of -test.benchserve.stream,
+// independently of the clients whose requests performed the runs.
+type resultStream struct {
+	mu    sync.Mutex
+	sinks map[chan []byte]string // queues of lines for each reader, to its name
+}
+
+// openResultStream opens the stream requested by flags, if any.
+// The target is a file, such as a FIFO, "fd:N" for an inherited
+// file descriptor, or "tcp:host:port" to serve the stream to every
+// client that connects there, from the time it connects.
+func openResultStream() (*resultStream, error) {
+	target := *benchServeStream
+	if target == "" {
+		return nil, nil
+	}
+	st := &resultStream{sinks: make(map[chan []byte]string)}
+	if addr, ok := strings.CutPrefix(target, "tcp:"); ok {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("streaming results", "addr", l.Addr())
+		go st.accept(l)
+		return st, nil
+	}
+	var f *os.File
+	if fd, ok := strings.CutPrefix(target, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad file descriptor in %q", target)
+		}
+		f = os.NewFile(uintptr(n), target)
+	} else {
+		// O_RDWR, so that opening a FIFO does not wait for a reader.
+		var err error
+		f, err = os.OpenFile(target, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+	}
+	go st.drain(st.add(target), f)
+	return st, nil
+}
+
+// accept streams to each client that connects to l.
+func (st *resultStream) accept(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			logger.Error("result stream", "err", err)
+			return
+		}
+		go st.drain(st.add(c.RemoteAddr().String()), c)
+	}
+}
+
+// add adds a reader to the stream, returning its queue.
+func (st *resultStream) add(name string) chan []byte {
+	q := make(chan []byte, streamQueue)
+	st.mu.Lock()
+	st.sinks[q] = name
+	st.mu.Unlock()
+	return q
+}
+
+// drain writes the lines queued in q to w, until writing fails.
+func (st *resultStream) drain(q chan []byte, w io.WriteCloser) {
+	for line := range q {
+		if _, err := w.Write(line); err != nil {
+			st.mu.Lock()
+			logger.Info("result stream closed", "to", st.sinks[q], "err", err)
+			delete(st.sinks, q)
+			st.mu.Unlock()
+			w.Close()
+			return
+		}
+	}
+}
+
+// send queues rec for all the stream's readers.
+func (st *resultStream) send(rec Record) {
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		logger.Warn("result stream", "err", err)
+		return
+	}
+	buf = append(buf, '\n')
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for q, name := range st.sinks {
+		select {
+		case q <- buf:
+		default:
+			logger.Warn("result stream full, dropping run", "to", name, "benchmark", rec.Run.Name)
+		}
+	}
+}
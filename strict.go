@@ -0,0 +1,121 @@
+package benchserve
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// globals is a snapshot of the process-wide state that a benchmark
+// can change and that affects later runs, for Run.Strict.
+type globals struct {
+	procs int
+	gogc  int
+	limit int64
+	env   map[string]string
+	dir   string
+}
+
+// snapshotGlobals returns the current global state.
+func snapshotGlobals() globals {
+	g := globals{procs: runtime.GOMAXPROCS(-1), env: make(map[string]string)}
+	g.gogc, g.limit = gcSettings()
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		g.env[k] = v
+	}
+	g.dir, _ = os.Getwd()
+	return g
+}
+
+// diff describes the changes from g to now, one per line,
+// such as "GOGC: 100 -> off".
+func (g globals) diff(now globals) []string {
+	var d []string
+	if g.procs != now.procs {
+		d = append(d, fmt.Sprintf("GOMAXPROCS: %d -> %d", g.procs, now.procs))
+	}
+	if g.gogc != now.gogc {
+		d = append(d, fmt.Sprintf("GOGC: %s -> %s", gogcString(g.gogc), gogcString(now.gogc)))
+	}
+	if g.limit != now.limit {
+		d = append(d, fmt.Sprintf("GOMEMLIMIT: %s -> %s", limitString(g.limit), limitString(now.limit)))
+	}
+	var keys []string
+	for k, v := range g.env {
+		if w, ok := now.env[k]; !ok || v != w {
+			keys = append(keys, k)
+		}
+	}
+	for k := range now.env {
+		if _, ok := g.env[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		d = append(d, fmt.Sprintf("env %s: %s -> %s", k, envString(g.env, k), envString(now.env, k)))
+	}
+	if g.dir != now.dir {
+		d = append(d, fmt.Sprintf("working directory: %s -> %s", g.dir, now.dir))
+	}
+	return d
+}
+
+// restore undoes the changes from g to now.
+func (g globals) restore(now globals) {
+	runtime.GOMAXPROCS(g.procs)
+	if g.gogc != now.gogc {
+		debug.SetGCPercent(g.gogc)
+	}
+	if g.limit != now.limit {
+		debug.SetMemoryLimit(g.limit)
+	}
+	for k := range now.env {
+		if _, ok := g.env[k]; !ok {
+			os.Unsetenv(k)
+		}
+	}
+	for k, v := range g.env {
+		if w, ok := now.env[k]; !ok || v != w {
+			os.Setenv(k, v)
+		}
+	}
+	if g.dir != now.dir {
+		if err := os.Chdir(g.dir); err != nil {
+			logger.Warn("restore working directory", "dir", g.dir, "err", err)
+		}
+	}
+}
+
+func gogcString(gogc int) string {
+	if gogc < 0 {
+		return "off"
+	}
+	return strconv.Itoa(gogc)
+}
+
+func limitString(limit int64) string {
+	if limit == math.MaxInt64 {
+		return "none"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+func envString(env map[string]string, k string) string {
+	if v, ok := env[k]; ok {
+		return strconv.Quote(v)
+	}
+	return "unset"
+}
+
+// errMutated returns the error for a run of the named benchmark
+// that made the changes in diff.
+func errMutated(name string, diff []string) error {
+	return fmt.Errorf("%s mutated global state:\n\t%s", name, strings.Join(diff, "\n\t"))
+}
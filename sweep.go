@@ -0,0 +1,65 @@
+package benchserve
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sweep requests runs of a benchmark over every combination
+// of GOMAXPROCS and b.SetParallelism values, for studying how
+// a benchmark that uses b.RunParallel scales with concurrency.
+type Sweep struct {
+	Run Run // the run to repeat; its Procs and Parallelism are ignored
+
+	Procs       []int // GOMAXPROCS values
+	Parallelism []int // b.SetParallelism values, default 1
+}
+
+// SweepResult is the result of a Sweep.
+type SweepResult struct {
+	Procs       []int
+	Parallelism []int
+
+	// Results holds the result for each combination:
+	// Results[i][j] is the run with Procs[i] and Parallelism[j].
+	Results [][]Result
+}
+
+// Sweep runs a benchmark once for each combination of the requested
+// GOMAXPROCS and parallelism values, one row of Procs at a time, and
+// returns the results as a matrix. It stops at the first failed run.
+func (s *Server) Sweep(args Sweep, reply *SweepResult) error {
+	if len(args.Procs) == 0 {
+		return errors.New("no Procs")
+	}
+	pars := args.Parallelism
+	if len(pars) == 0 {
+		pars = []int{1}
+	}
+	for _, p := range args.Procs {
+		if p <= 0 {
+			return fmt.Errorf("invalid Procs %d", p)
+		}
+	}
+	for _, p := range pars {
+		if p <= 0 {
+			return fmt.Errorf("invalid Parallelism %d", p)
+		}
+	}
+
+	reply.Procs, reply.Parallelism = args.Procs, pars
+	for _, procs := range args.Procs {
+		row := make([]Result, 0, len(pars))
+		for _, par := range pars {
+			run := args.Run
+			run.Procs, run.Parallelism = procs, par
+			r, err := s.run(run)
+			if err != nil {
+				return err
+			}
+			row = append(row, r)
+		}
+		reply.Results = append(reply.Results, row)
+	}
+	return nil
+}
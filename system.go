@@ -0,0 +1,86 @@
+package benchserve
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A SystemSnapshot describes the state of the machine at an instant.
+// Fields are zero where the information is unavailable;
+// currently it is gathered on Linux, and Throttling also on macOS.
+type SystemSnapshot struct {
+	Load1      float64 // 1-minute load average
+	CPUMHz     float64 // mean current frequency of online CPUs, in MHz
+	Throttles  int64   // total thermal throttling events across CPUs since boot
+	Throttling bool    // the CPU is being slowed to shed heat
+}
+
+// snapshotSystem returns a SystemSnapshot of the current state of the machine.
+func snapshotSystem() SystemSnapshot {
+	var snap SystemSnapshot
+	if buf, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if fields := strings.Fields(string(buf)); len(fields) > 0 {
+			snap.Load1, _ = strconv.ParseFloat(fields[0], 64)
+		}
+	}
+
+	freqs, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq")
+	var khz float64
+	n := 0
+	for _, file := range freqs {
+		if v, ok := readInt(file); ok {
+			khz += float64(v)
+			n++
+		}
+	}
+	if n > 0 {
+		snap.CPUMHz = khz / float64(n) / 1000
+	}
+
+	counts, _ := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/thermal_throttle/*_throttle_count")
+	for _, file := range counts {
+		if v, ok := readInt(file); ok {
+			snap.Throttles += v
+		}
+	}
+	snap.Throttling = coolingCPU() || thermalThrottling()
+	return snap
+}
+
+// coolingCPU reports whether any of Linux's thermal cooling devices
+// that slow the CPU, such as by capping its frequency, is engaged.
+func coolingCPU() bool {
+	devs, _ := filepath.Glob("/sys/class/thermal/cooling_device[0-9]*")
+	for _, dev := range devs {
+		typ, err := os.ReadFile(filepath.Join(dev, "type"))
+		if err != nil {
+			continue
+		}
+		t := strings.ToLower(string(typ))
+		if !strings.Contains(t, "processor") && !strings.Contains(t, "cpu") {
+			continue
+		}
+		if v, ok := readInt(filepath.Join(dev, "cur_state")); ok && v > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// throttled reports whether the CPU was thermally throttled
+// at any point between snapshots a and b.
+func throttled(a, b SystemSnapshot) bool {
+	return a.Throttling || b.Throttling || b.Throttles > a.Throttles
+}
+
+// readInt reads a file containing a single decimal integer.
+func readInt(file string) (int64, bool) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64)
+	return v, err == nil
+}
@@ -0,0 +1,115 @@
+package benchserve
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var tags struct {
+	sync.Mutex
+	m map[string][]string // benchmark name -> sorted tags
+}
+
+// Tag attaches tags, such as "encoding" or "slow", to the named benchmark,
+// so that drivers can select groups of benchmarks with List.Tags
+// and Batch.Select. It may be called more than once for a benchmark.
+//
+// Tag should be called in TestMain, before Main or Serve.
+func Tag(benchmark string, tag ...string) {
+	tags.Lock()
+	defer tags.Unlock()
+	if tags.m == nil {
+		tags.m = make(map[string][]string)
+	}
+	t := tags.m[benchmark]
+	for _, x := range tag {
+		if !contains(t, x) {
+			t = append(t, x)
+		}
+	}
+	sort.Strings(t)
+	tags.m[benchmark] = t
+}
+
+// benchmarkTags returns the tags of the named benchmark.
+func benchmarkTags(name string) []string {
+	tags.Lock()
+	defer tags.Unlock()
+	return tags.m[name]
+}
+
+// hasTags reports whether the named benchmark has all of want.
+func hasTags(name string, want []string) bool {
+	return containsAll(benchmarkTags(name), want)
+}
+
+// containsAll reports whether tags includes all of want.
+func containsAll(tags, want []string) bool {
+	for _, x := range want {
+		if !contains(tags, x) {
+			return false
+		}
+	}
+	return true
+}
+
+// selected returns the sorted names of the benchmarks selected by l.
+func (s *Server) selected(l List) ([]string, error) {
+	names, err := s.names(l.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	var sel []string
+	for _, name := range names {
+		if hasTags(name, l.Tags) {
+			sel = append(sel, name)
+		}
+	}
+	return sel, nil
+}
+
+// Matches reports whether l selects a benchmark with the given name and tags,
+// as List and Batch.Select do, for fakes of a server such as benchservetest.
+// It returns an error if l.Pattern is not a valid pattern.
+func (l List) Matches(name string, tags []string) (bool, error) {
+	m, err := newMatcher(l.Pattern)
+	if err != nil {
+		return false, err
+	}
+	return m.matches(name) && containsAll(tags, l.Tags), nil
+}
+
+// A Select adds runs of a group of benchmarks to a Batch.
+type Select struct {
+	List     // benchmarks to run
+	Run  Run // template for each run, with Name ignored
+}
+
+// expand returns b with a run added to b.Runs, after those already there,
+// for each benchmark selected by each of b.Select.
+func (s *Server) expand(b Batch) (Batch, error) {
+	if len(b.Select) == 0 && len(b.Labels) == 0 {
+		return b, nil
+	}
+	runs := append([]Run(nil), b.Runs...)
+	for _, sel := range b.Select {
+		names, err := s.selected(sel.List)
+		if err != nil {
+			return b, err
+		}
+		if len(names) == 0 {
+			return b, fmt.Errorf("select pattern %q tags %q: no benchmarks", sel.Pattern, sel.Tags)
+		}
+		for _, name := range names {
+			run := sel.Run
+			run.Name = name
+			runs = append(runs, run)
+		}
+	}
+	for i, run := range runs {
+		runs[i] = withLabels(run, b.Labels)
+	}
+	b.Runs, b.Select = runs, nil
+	return b, nil
+}
@@ -0,0 +1,140 @@
+package benchserve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListTests returns the sorted names of the tests in the binary.
+func (s *Server) ListTests(args struct{}, names *[]string) error {
+	for _, t := range s.tests {
+		*names = append(*names, t.Name)
+	}
+	sort.Strings(*names)
+	return nil
+}
+
+// RunTest requests a single test run.
+type RunTest struct {
+	// Name is the name of the test to run.
+	// It may name a subtest, as in TestFoo/bar.
+	Name string
+
+	Timeout time.Duration // equivalent to -test.timeout; zero means no timeout
+}
+
+// TestResult is the result of a single test run.
+type TestResult struct {
+	Passed  bool
+	Skipped bool
+
+	// Duration is the wall time taken by the test process,
+	// including process startup and any TestMain setup.
+	Duration time.Duration
+
+	// Output is the combined stdout and stderr of the test process,
+	// as with -test.v. Output longer than 1MB is truncated to its last 1MB,
+	// and the full output is saved as an artifact.
+	Output string
+
+	// OutputArtifact is the ID of the artifact holding the full output,
+	// if Output was truncated. Use Server.FetchArtifact to retrieve it.
+	OutputArtifact string
+}
+
+// RunTest runs a single test.
+// The test runs in a new copy of the test binary,
+// so that failures and panics do not affect the server.
+// A test failure is reported in the TestResult, not as an error.
+func (s *Server) RunTest(args RunTest, reply *TestResult) error {
+	if !s.hasTest(args.Name) {
+		return fmt.Errorf("%s not found", args.Name)
+	}
+	var err error
+	*reply, err = s.runTest(args.Name, exactPattern(args.Name), args.Timeout)
+	return err
+}
+
+// runTest runs the tests matching the -test.run pattern in a new copy
+// of the test binary, passing it the given extra flags.
+// The run is reported as running name.
+func (s *Server) runTest(name, pattern string, timeout time.Duration, flags ...string) (TestResult, error) {
+	ctx, done, err := s.acquire(name)
+	if err != nil {
+		return TestResult{}, err
+	}
+	defer done()
+
+	args := []string{"-test.run=" + pattern, "-test.v"}
+	if timeout > 0 {
+		args = append(args, "-test.timeout="+timeout.String())
+	}
+	cmd, err := selfCommand(ctx, append(args, flags...)...)
+	if err != nil {
+		return TestResult{}, err
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	var r TestResult
+	start := time.Now()
+	err = cmd.Run()
+	r.Duration = time.Since(start)
+	r.Output = out.String()
+	if out.Len() > maxChunk {
+		id, err := saveArtifact("output", out.Bytes())
+		if err != nil {
+			return r, err
+		}
+		r.Output = string(out.Bytes()[out.Len()-maxChunk:])
+		r.OutputArtifact = id
+	}
+	if ctx.Err() != nil {
+		return r, errCanceled
+	}
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return r, err
+	}
+	r.Passed = err == nil
+	r.Skipped = r.Passed && strings.Contains(r.Output, "--- SKIP: "+name+" (")
+	return r, nil
+}
+
+// hasTest reports whether name is a test in the binary, or a subtest of one.
+func (s *Server) hasTest(name string) bool {
+	top := strings.SplitN(name, "/", 2)[0]
+	for _, t := range s.tests {
+		if t.Name == top {
+			return true
+		}
+	}
+	return false
+}
+
+// exactPattern returns a -test.run or -test.bench pattern
+// that matches only the slash-separated name.
+func exactPattern(name string) string {
+	elems := strings.Split(name, "/")
+	for i, e := range elems {
+		elems[i] = "^" + regexp.QuoteMeta(e) + "$"
+	}
+	return strings.Join(elems, "/")
+}
+
+// selfCommand returns a command that runs a new copy of the test binary
+// with the given flags, killed when ctx is done.
+func selfCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return exec.CommandContext(ctx, exe, args...), nil
+}
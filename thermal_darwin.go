@@ -0,0 +1,36 @@
+package benchserve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// thermalThrottling reports whether macOS is limiting the CPU to shed heat,
+// according to pmset: a CPU speed or scheduler limit below 100%,
+// or a recorded thermal warning level.
+func thermalThrottling() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "pmset", "-g", "therm").Output()
+	if err != nil {
+		return false
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if key, v, ok := strings.Cut(line, "="); ok && strings.HasSuffix(strings.TrimSpace(key), "_Limit") {
+			if pct, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && pct < 100 {
+				return true
+			}
+		}
+		if strings.Contains(strings.ToLower(line), "thermal warning level set to") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,7 @@
+//go:build !darwin
+
+package benchserve
+
+// thermalThrottling reports whether the CPU is being limited to shed heat,
+// if the system reports it other than through sysfs.
+func thermalThrottling() bool { return false }
@@ -0,0 +1,89 @@
+package benchserve
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// An Exchange is a request and its response, as recorded by
+// -test.benchserve.record. A recording is a file of Exchanges,
+// encoded as JSON, one per line, in the order the responses were sent.
+// The benchreplay command serves the responses in a recording
+// to clients that repeat its requests.
+type Exchange struct {
+	Time     time.Time     // when the request arrived
+	Client   string        // address of the client
+	Method   string        // name of the method, such as "Server.Run"
+	Duration time.Duration // time taken to serve the request
+
+	// Params holds the arguments, encoded as JSON: as sent, for the
+	// JSON-lines protocol, and as decoded by the server otherwise.
+	// Result holds the results, unless the request failed with Error.
+	Params json.RawMessage `json:",omitempty"`
+	Result json.RawMessage `json:",omitempty"`
+	Error  *Error          `json:",omitempty"`
+}
+
+// A trafficLog records Exchanges in the file named by -test.benchserve.record.
+type trafficLog struct {
+	mu     sync.Mutex
+	f      *os.File
+	closed bool // once the server is shutting down
+}
+
+// openTrafficLog opens the recording requested by flags, if any.
+func openTrafficLog() (*trafficLog, error) {
+	if *benchServeRecord == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(*benchServeRecord, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &trafficLog{f: f}, nil
+}
+
+// add records x, with the given result unless x failed.
+// It does nothing if t is nil or closed.
+func (t *trafficLog) add(x Exchange, result interface{}) {
+	if t == nil {
+		return
+	}
+	var err error
+	if x.Error == nil {
+		x.Result, err = json.Marshal(result)
+	}
+	var buf []byte
+	if err == nil {
+		buf, err = json.Marshal(x)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	if err == nil {
+		_, err = t.f.Write(append(buf, '\n'))
+	}
+	if err != nil {
+		logger.Warn("write recording", "err", err)
+	}
+}
+
+// close closes the recording, if any.
+func (t *trafficLog) close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	if err := t.f.Close(); err != nil {
+		logger.Warn("close recording", "err", err)
+	}
+}
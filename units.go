@@ -0,0 +1,85 @@
+package benchserve
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Unit describes the unit of a benchmark metric,
+// such as one reported with b.ReportMetric, so that comparison tools
+// know which direction is an improvement.
+type Unit struct {
+	Name   string // such as "requests/s"
+	Better string // HigherIsBetter or LowerIsBetter
+}
+
+// Directions of improvement for Unit.Better.
+const (
+	HigherIsBetter = "higher"
+	LowerIsBetter  = "lower"
+)
+
+var units = struct {
+	sync.Mutex
+	m map[string]Unit
+}{m: map[string]Unit{
+	"ns/op":     {"ns/op", LowerIsBetter},
+	"B/op":      {"B/op", LowerIsBetter},
+	"allocs/op": {"allocs/op", LowerIsBetter},
+	"MB/s":      {"MB/s", HigherIsBetter},
+}}
+
+// RegisterUnit records which direction is an improvement
+// for a custom metric's unit, such as "requests/s" (HigherIsBetter)
+// or "p99-ns" (LowerIsBetter). Server.ListUnits lists registered units,
+// results carry those of the metrics they report, and the benchfmt
+// run log declares them in Unit lines.
+//
+// RegisterUnit should be called in TestMain, before Main or Serve.
+// It panics if better is invalid or the unit is already registered,
+// as are the standard units ns/op, B/op, allocs/op, and MB/s.
+func RegisterUnit(name, better string) {
+	if better != HigherIsBetter && better != LowerIsBetter {
+		panic(fmt.Sprintf("benchserve: unit %s: better must be %q or %q, not %q", name, HigherIsBetter, LowerIsBetter, better))
+	}
+	units.Lock()
+	defer units.Unlock()
+	if _, dup := units.m[name]; dup {
+		panic("benchserve: unit " + name + " registered twice")
+	}
+	units.m[name] = Unit{name, better}
+}
+
+// ListUnits returns the registered units, including the standard ones,
+// sorted by name.
+func (s *Server) ListUnits(args struct{}, reply *[]Unit) error {
+	*reply = registeredUnits()
+	return nil
+}
+
+// registeredUnits returns the registered units, sorted by name.
+func registeredUnits() []Unit {
+	units.Lock()
+	defer units.Unlock()
+	var list []Unit
+	for _, name := range sortedKeys(units.m) {
+		list = append(list, units.m[name])
+	}
+	return list
+}
+
+// customUnits returns the registered units of the metrics in extra,
+// sorted by name.
+func customUnits(extra map[string]float64) []Unit {
+	units.Lock()
+	defer units.Unlock()
+	var list []Unit
+	for name := range extra {
+		if u, ok := units.m[name]; ok {
+			list = append(list, u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,170 @@
+package benchserve
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Validation is the result of validating a Batch.
+type Validation struct {
+	// Problems lists the reasons the batch would be rejected or fail.
+	// Submit rejects batches with problems.
+	Problems []string
+
+	// Estimate is the estimated time to perform the batch,
+	// based on earlier runs of the same benchmarks.
+	// For campaigns, it covers the first round of samples.
+	// Runs with no earlier results are listed in Unknown
+	// and excluded from Estimate.
+	Estimate time.Duration
+	Unknown  []string
+
+	// Fits reports whether Estimate is within the batch's Budget.
+	// It is always true for batches without a Budget.
+	// A campaign that does not fit still runs,
+	// but skips runs once they no longer fit.
+	Fits bool
+}
+
+// Validate checks a batch without running anything: that its benchmarks
+// exist, that its runs and options are coherent, and, for campaigns,
+// that the first round of samples is expected to fit in the budget.
+func (s *Server) Validate(args Batch, reply *Validation) error {
+	b, err := s.expand(args)
+	if err != nil {
+		reply.Problems = []string{err.Error()}
+		return nil
+	}
+	*reply = s.validate(b)
+	return nil
+}
+
+// validate implements Validate.
+func (s *Server) validate(b Batch) Validation {
+	var v Validation
+	problem := func(format string, args ...interface{}) {
+		v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+	}
+	if len(b.Runs) == 0 {
+		problem("empty batch")
+	}
+	if b.Budget < 0 {
+		problem("negative budget %v", b.Budget)
+	}
+	if b.Webhook != "" {
+		if u, err := url.Parse(b.Webhook); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			problem("webhook %q is not an http or https URL", b.Webhook)
+		} else if b.Webhook != *benchServeWebhook {
+			// The server POSTs from inside its own network,
+			// so only the operator decides where.
+			if *benchServeReadOnly {
+				problem("per-job webhooks are disabled by -test.benchserve.readonly")
+			} else if !webhookHostAllowed(u.Hostname()) {
+				problem("webhook host %q is not allowed by -test.benchserve.webhookhosts", u.Hostname())
+			}
+		}
+	}
+
+	if _, err := b.plan(); err != nil {
+		problem("%v", err)
+	}
+
+	rounds := 1
+	if b.Budget > 0 {
+		rounds = campaignFirstRound
+	}
+	for i, run := range b.Runs {
+		name := run.Name
+		if name == "" {
+			name = fmt.Sprintf("run %d", i)
+		}
+		if _, ok := s.m[run.Name]; !ok {
+			problem("%s not found", name)
+			continue
+		}
+		switch {
+		case run.N <= 0:
+			problem("%s: N must be positive", name)
+		case run.Procs <= 0:
+			problem("%s: Procs must be positive", name)
+		case run.Batches < 0 || run.Batches > run.N:
+			problem("%s: Batches must be between 0 and N", name)
+		case run.MinTime < 0:
+			problem("%s: negative MinTime", name)
+		case run.Parallelism < 0:
+			problem("%s: negative Parallelism", name)
+		case run.MinTime > 0 && run.Batches > 0:
+			problem("%s: MinTime cannot be combined with Batches", name)
+		case run.Layout < 0:
+			problem("%s: negative Layout", name)
+		case !run.Isolate && (run.Layout != 0 || run.RandomizeLayout):
+			problem("%s: Layout and RandomizeLayout require Isolate", name)
+		case run.NUMANode != nil && !run.Isolate:
+			problem("%s: NUMANode requires Isolate", name)
+		case run.NUMANode != nil && *run.NUMANode < 0:
+			problem("%s: negative NUMANode", name)
+		}
+		if err := s.checkMaxRun(run); err != nil {
+			problem("%v", err)
+		}
+		if err := checkLabels(run.Labels); err != nil {
+			problem("%s: %v", name, err)
+		}
+		if run.Cores != "" {
+			if _, err := selectCores(run.Cores); err != nil {
+				problem("%s: Cores: %v", name, err)
+			}
+		}
+		for _, f := range run.Fixtures {
+			if !hasFixture(f) {
+				problem("%s: fixture %s not found", name, f)
+			}
+		}
+		if ns, ok := s.lastNsPerOp(run); ok {
+			v.Estimate += time.Duration(ns * float64(run.N) * float64(rounds))
+		} else {
+			v.Unknown = append(v.Unknown, name)
+		}
+	}
+	v.Fits = b.Budget <= 0 || v.Estimate <= b.Budget
+	return v
+}
+
+// lastNsPerOp returns the ns/op of the most recent successful run
+// of run's benchmark and procs, from this server or, failing that,
+// from the history store for this binary.
+func (s *Server) lastNsPerOp(run Run) (float64, bool) {
+	s.mu.Lock()
+	ns, ok := s.latest[runKey{run.Name, run.Procs}]
+	s.mu.Unlock()
+	if ok || s.history == nil {
+		return ns, ok
+	}
+	binary := binaryHash()
+	s.history.scan(func(rec Record) {
+		if rec.Binary == binary && rec.Error == "" && rec.Run.Name == run.Name && rec.Run.Procs == run.Procs {
+			ns, ok = nsPerOp(rec.Result), true
+		}
+	})
+	return ns, ok
+}
+
+// err returns v's problems as an error, or nil if there are none.
+func (v Validation) err() error {
+	if len(v.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid batch: %s", strings.Join(v.Problems, "; "))
+}
+
+// webhookHostAllowed reports whether host is listed in -test.benchserve.webhookhosts.
+func webhookHostAllowed(host string) bool {
+	for _, h := range strings.Split(*benchServeWebhookHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" && strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
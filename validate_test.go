@@ -0,0 +1,43 @@
+package benchserve
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	defer func(webhook, hosts string, readOnly bool) {
+		*benchServeWebhook, *benchServeWebhookHosts, *benchServeReadOnly = webhook, hosts, readOnly
+	}(*benchServeWebhook, *benchServeWebhookHosts, *benchServeReadOnly)
+	*benchServeWebhook = "http://ci.example/hook"
+
+	for _, tt := range []struct {
+		webhook  string
+		hosts    string
+		readOnly bool
+		ok       bool
+	}{
+		{"", "", false, true},
+		{"http://ci.example/hook", "", false, true},
+		{"http://ci.example/hook", "", true, true},
+		{"http://ci.example/other", "", false, false},
+		{"http://169.254.169.254/latest", "", false, false},
+		{"https://hooks.example:8443/x", "hooks.example", false, true},
+		{"https://HOOKS.example/x", "a.example, hooks.example", false, true},
+		{"https://evil.example/x", "hooks.example", false, false},
+		{"https://hooks.example/x", "hooks.example", true, false},
+		{"ftp://hooks.example/x", "hooks.example", false, false},
+	} {
+		*benchServeWebhookHosts, *benchServeReadOnly = tt.hosts, tt.readOnly
+		s := &Server{server: &server{}}
+		var problems []string
+		for _, p := range s.validate(Batch{Webhook: tt.webhook}).Problems {
+			if strings.Contains(p, "webhook") {
+				problems = append(problems, p)
+			}
+		}
+		if ok := len(problems) == 0; ok != tt.ok {
+			t.Errorf("webhook %q with hosts %q, readonly %v: problems %q, want ok %v", tt.webhook, tt.hosts, tt.readOnly, problems, tt.ok)
+		}
+	}
+}
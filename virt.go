@@ -0,0 +1,18 @@
+package benchserve
+
+import "sync"
+
+var (
+	virtualizationOnce sync.Once
+	virtualizationName string
+)
+
+// virtualization describes the environment in which the server runs,
+// if it is not native hardware: "rosetta" or "qemu" for binaries
+// translated from another architecture, or the hypervisor of
+// a virtual machine, such as "kvm", "vmware", or just "vm" if unknown.
+// It is empty on native hardware, or where detection is unsupported.
+func virtualization() string {
+	virtualizationOnce.Do(func() { virtualizationName = detectVirtualization() })
+	return virtualizationName
+}
@@ -0,0 +1,13 @@
+package benchserve
+
+import "syscall"
+
+func detectVirtualization() string {
+	if v, err := syscall.SysctlUint32("sysctl.proc_translated"); err == nil && v == 1 {
+		return "rosetta"
+	}
+	if v, err := syscall.SysctlUint32("kern.hv_vmm_present"); err == nil && v == 1 {
+		return "vm"
+	}
+	return ""
+}
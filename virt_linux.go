@@ -0,0 +1,93 @@
+package benchserve
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// kernelArch maps the machine names reported by uname
+// to the GOARCH values that run natively on them.
+var kernelArch = map[string][]string{
+	"x86_64":  {"amd64", "386"},
+	"i686":    {"386"},
+	"aarch64": {"arm64", "arm"},
+	"armv7l":  {"arm"},
+	"ppc64le": {"ppc64le"},
+	"s390x":   {"s390x"},
+	"riscv64": {"riscv64"},
+}
+
+// hypervisorVendors maps substrings of the DMI system vendor and product
+// names to hypervisors.
+var hypervisorVendors = []struct{ match, name string }{
+	{"qemu", "qemu"},
+	{"kvm", "kvm"},
+	{"vmware", "vmware"},
+	{"virtualbox", "virtualbox"},
+	{"xen", "xen"},
+	{"bochs", "qemu"},
+	{"parallels", "parallels"},
+	{"apple virtualization", "apple"},
+	{"virtual machine", "hyperv"}, // Microsoft's product name
+}
+
+func detectVirtualization() string {
+	// User-mode translation of another architecture's binary,
+	// such as by Rosetta in a Linux VM on Apple silicon.
+	// qemu-user reports the emulated machine, so it goes undetected.
+	var u syscall.Utsname
+	if syscall.Uname(&u) == nil {
+		machine := utsString(u.Machine[:])
+		if native, ok := kernelArch[machine]; ok && !contains(native, runtime.GOARCH) {
+			if binfmt, err := os.ReadFile("/proc/sys/fs/binfmt_misc/rosetta"); err == nil && bytes.HasPrefix(binfmt, []byte("enabled")) {
+				return "rosetta"
+			}
+			return "qemu"
+		}
+	}
+
+	var dmi []byte
+	for _, file := range []string{"/sys/class/dmi/id/sys_vendor", "/sys/class/dmi/id/product_name"} {
+		buf, _ := os.ReadFile(file)
+		dmi = append(dmi, bytes.ToLower(buf)...)
+	}
+	for _, v := range hypervisorVendors {
+		if bytes.Contains(dmi, []byte(v.match)) {
+			return v.name
+		}
+	}
+	if buf, err := os.ReadFile("/sys/hypervisor/type"); err == nil && len(bytes.TrimSpace(buf)) > 0 {
+		return strings.TrimSpace(string(buf))
+	}
+	if buf, err := os.ReadFile("/proc/device-tree/compatible"); err == nil && bytes.Contains(buf, []byte("dummy-virt")) {
+		return "qemu"
+	}
+	// The CPUID hypervisor bit, on x86.
+	if buf, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(buf), "\n") {
+			if key, flags, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "flags" {
+				if contains(strings.Fields(flags), "hypervisor") {
+					return "vm"
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// utsString converts a NUL-terminated field of syscall.Utsname to a string.
+// The fields are int8 on some architectures and uint8 on others.
+func utsString[T int8 | uint8](field []T) string {
+	var b []byte
+	for _, c := range field {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
@@ -0,0 +1,5 @@
+//go:build !darwin && !linux
+
+package benchserve
+
+func detectVirtualization() string { return "" }